@@ -0,0 +1,108 @@
+package bank
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Acceptance are the criteria a run of a scenario must meet, read from the
+// optional acceptance.txt of the test folder, one criterion per line:
+//
+//	max-duration=5s
+//	max-messages=400
+//	non-negative-balances
+//	no-failures
+//
+// Zero limits are not checked. Under a CreditLineRule the balances may go
+// down to the credit line.
+type Acceptance struct {
+	MaxDuration         time.Duration
+	MaxMessages         int64
+	NonNegativeBalances bool
+	NoFailures          bool // neither failed nor rejected transactions
+}
+
+// AcceptanceResult is the outcome of checking a run against its criteria
+type AcceptanceResult struct {
+	Passed bool     `json:"passed"`
+	Failed []string `json:"failed,omitempty"`
+}
+
+// LoadAcceptance reads the acceptance criteria of a test folder; it returns
+// nil without error when the folder declares none
+func LoadAcceptance(storage Storage, folder_name string) (*Acceptance, error) {
+	file, err := storage.Open(folder_name + "/acceptance.txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	acceptance := &Acceptance{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "max-duration":
+			acceptance.MaxDuration, err = time.ParseDuration(value)
+		case "max-messages":
+			acceptance.MaxMessages, err = strconv.ParseInt(value, 10, 64)
+		case "non-negative-balances":
+			acceptance.NonNegativeBalances = true
+		case "no-failures":
+			acceptance.NoFailures = true
+		default:
+			err = fmt.Errorf("unknown criterion %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s/acceptance.txt: %v", folder_name, err)
+		}
+	}
+	return acceptance, scanner.Err()
+}
+
+// Check evaluates the criteria on a finished run and its metrics
+func (run *Simulation) Check(acceptance Acceptance, metrics Metrics) AcceptanceResult {
+	failed := make([]string, 0)
+	if acceptance.MaxDuration > 0 && time.Duration(metrics.Duration)*time.Millisecond > acceptance.MaxDuration {
+		failed = append(failed, fmt.Sprintf("duration %d ms exceeds %s", metrics.Duration, acceptance.MaxDuration))
+	}
+	if acceptance.MaxMessages > 0 && metrics.TotalMessages > acceptance.MaxMessages {
+		failed = append(failed, fmt.Sprintf("%d messages exceed %d", metrics.TotalMessages, acceptance.MaxMessages))
+	}
+	if acceptance.NonNegativeBalances {
+		// a credit line lets the balances go below zero
+		floor := BalanceFloor(run.config.Funds)
+		balances := run.ledger.Balances()
+		for i := 0; i < run.scenario.Accounts; i++ {
+			switch balance := balances[i]; {
+			case balance >= floor:
+			case floor == 0:
+				failed = append(failed, fmt.Sprintf("participant %d has a negative balance of %s", i, balance))
+			default:
+				failed = append(failed, fmt.Sprintf("participant %d has a balance of %s, beyond its credit line of %s", i, balance, -floor))
+			}
+		}
+	}
+	if acceptance.NoFailures {
+		count := int64(metrics.Validation.Rejected)
+		for _, n := range metrics.Failures {
+			count += n
+		}
+		if count > 0 {
+			failed = append(failed, fmt.Sprintf("%d transactions failed or were rejected", count))
+		}
+	}
+	return AcceptanceResult{Passed: len(failed) == 0, Failed: failed}
+}
@@ -0,0 +1,100 @@
+package bank
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ArchivedAccount is the state of an account when it was archived: taken out
+// of the network after its last transaction
+type ArchivedAccount struct {
+	Account   int     `json:"account"`
+	At        float64 `json:"atMs"` // since the start of the run
+	Balance   Money   `json:"balance"`
+	Committed int     `json:"committed"` // transactions it ran that committed
+	Failed    int     `json:"failed"`
+	Clock     int     `json:"clock"` // its Lamport clock
+}
+
+// MembershipSample is the number of accounts taking part in the protocol
+// from a point of the run on
+type MembershipSample struct {
+	At       float64 `json:"atMs"`
+	Accounts int     `json:"accounts"`
+}
+
+func (run *Simulation) archive(id int) {
+	// archive the accounts done with their transactions, draining the CS first
+	// like a membership change. An account whose leaving would break the
+	// intersection of the quorums left stays until an account done later is
+	// archived.
+	defer run.switching.Done()
+	run.gate.Lock()
+	defer run.gate.Unlock()
+	candidates := append(run.archiving, id)
+	run.archiving = nil
+	for _, candidate := range candidates {
+		if run.network.HasLeft(candidate) {
+			continue
+		}
+		if !run.network.CanLeave(candidate) {
+			run.archiving = append(run.archiving, candidate)
+			continue
+		}
+		if err := run.network.Leave(candidate); err != nil {
+			fmt.Fprintln(run.config.Output, "Error archiving participant", candidate, err)
+			continue
+		}
+		archived := run.archived(candidate)
+		run.archivedAccounts = append(run.archivedAccounts, archived)
+		fmt.Fprintf(run.config.Output, "Participant %d archived after its last transaction (balance %s)\n", candidate, archived.Balance)
+		run.emit(Event{Kind: AccountLeaves, Account: candidate, Peer: -1, Reason: "archived"})
+		run.sampleMembership()
+	}
+}
+
+func (run *Simulation) archived(id int) ArchivedAccount {
+	// the snapshot of an account leaving
+	archived := ArchivedAccount{
+		Account: id,
+		At:      milliseconds(run.clock.Since(run.start)),
+		Balance: run.ledger.Balance(id),
+		Clock:   run.network.Clock(id),
+	}
+	for _, transaction := range run.transactions[run.scenario.Funding:] {
+		if transaction.From != id {
+			continue
+		}
+		switch run.ledger.state(transaction.ID) {
+		case committed:
+			archived.Committed++
+		case failed:
+			archived.Failed++
+		}
+	}
+	return archived
+}
+
+func (run *Simulation) sampleMembership() {
+	// record the accounts in the network now; the caller holds the gate
+	failed := make(map[int]bool)
+	for _, id := range run.network.Failed() {
+		failed[id] = true
+	}
+	accounts := 0
+	for id := 0; id < run.network.Len(); id++ {
+		if !failed[id] && !run.network.HasLeft(id) {
+			accounts++
+		}
+	}
+	run.membershipSize = append(run.membershipSize, MembershipSample{At: milliseconds(run.clock.Since(run.start)), Accounts: accounts})
+}
+
+func describeMembershipSize(samples []MembershipSample) string {
+	parts := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		parts = append(parts, fmt.Sprintf("%d at %s", sample.Accounts, time.Duration(sample.At*float64(time.Millisecond)).Round(time.Microsecond)))
+	}
+	return strings.Join(parts, ", ")
+}
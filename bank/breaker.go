@@ -0,0 +1,52 @@
+package bank
+
+import (
+	"fmt"
+	"time"
+)
+
+// A circuit breaker keeps a sick account from hammering the protocol: after
+// Config.BreakerThreshold strikes in a row the account stops asking for the
+// CS for Config.BreakerCoolDown, and an alert is emitted as a "breaker"
+// event. A strike is a transaction of the account failing, a CS entry wasted
+// because the money was gone by then, or a CS wait longer than
+// Config.BreakerTimeout. After the cool-down the breaker is half-open: one more
+// strike trips it again, and a commit closes it.
+
+// breaker counts the strikes of one account; only its goroutine uses it
+type breaker struct {
+	strikes int
+	reason  string // of the last strike
+}
+
+func (b *breaker) fail(reason string) {
+	b.strikes++
+	b.reason = reason
+}
+
+func (b *breaker) succeed() {
+	b.strikes = 0
+}
+
+func (run *Simulation) coolDown(account int, b *breaker, transaction int) {
+	// pause the account if its breaker tripped; the caller is outside the CS
+	threshold := run.config.BreakerThreshold
+	if threshold <= 0 || b.strikes < threshold {
+		return
+	}
+	coolDown := run.config.BreakerCoolDown
+	run.breaker_mutex.Lock()
+	run.breakerTrips[account]++
+	run.breaker_mutex.Unlock()
+	reason := fmt.Sprintf("%d strikes in a row, the last one: %s", b.strikes, b.reason)
+	run.emit(Event{Kind: "breaker", Account: account, Peer: -1, Reason: reason})
+	fmt.Fprintf(run.config.Output, "Circuit breaker: participant %d pauses for %s after %s\n", account, coolDown, reason)
+	run.setActivity(account, "breaker", transaction)
+	run.clock.Sleep(coolDown)
+	// half-open: the next strike trips the breaker again
+	b.strikes = threshold - 1
+}
+
+func (run *Simulation) slowCS(wait time.Duration) bool {
+	return run.config.BreakerTimeout > 0 && wait > run.config.BreakerTimeout
+}
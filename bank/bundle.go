@@ -0,0 +1,168 @@
+package bank
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// RecordingStorage remembers the files a run read and wrote through the
+// storage it wraps, e.g. to bundle them once the run is over
+type RecordingStorage struct {
+	Storage
+	mutex   sync.Mutex
+	read    []string
+	written []string
+}
+
+func NewRecordingStorage(storage Storage) *RecordingStorage {
+	return &RecordingStorage{Storage: storage}
+}
+
+func (storage *RecordingStorage) record(list *[]string, name string) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	for _, seen := range *list {
+		if seen == name {
+			return
+		}
+	}
+	*list = append(*list, name)
+}
+
+func (storage *RecordingStorage) Open(name string) (io.ReadCloser, error) {
+	file, err := storage.Storage.Open(name)
+	if err == nil {
+		storage.record(&storage.read, name)
+	}
+	return file, err
+}
+
+func (storage *RecordingStorage) Create(name string) (io.WriteCloser, error) {
+	file, err := storage.Storage.Create(name)
+	if err == nil {
+		storage.record(&storage.written, name)
+	}
+	return file, err
+}
+
+func (storage *RecordingStorage) Append(name string) (io.WriteCloser, error) {
+	file, err := storage.Storage.Append(name)
+	if err == nil {
+		storage.record(&storage.written, name)
+	}
+	return file, err
+}
+
+func (storage *RecordingStorage) Remove(name string) error {
+	if err := storage.Storage.Remove(name); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	for i, written := range storage.written {
+		if written == name {
+			storage.written = append(storage.written[:i], storage.written[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Files returns the files read that the run didn't write, and the files it
+// wrote and didn't remove, in the order they were first used
+func (storage *RecordingStorage) Files() ([]string, []string) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	written := make(map[string]bool, len(storage.written))
+	for _, name := range storage.written {
+		written[name] = true
+	}
+	read := make([]string, 0, len(storage.read))
+	for _, name := range storage.read {
+		if !written[name] {
+			read = append(read, name)
+		}
+	}
+	return read, append([]string(nil), storage.written...)
+}
+
+// BundleManifest describes the run a bundle holds and every file in it
+type BundleManifest struct {
+	Created   time.Time    `json:"created"`
+	Command   []string     `json:"command,omitempty"`
+	Folder    string       `json:"folder"`
+	Algorithm string       `json:"algorithm"`
+	Files     []BundleFile `json:"files"`
+}
+
+// BundleFile is a file of a bundle and where it came from
+type BundleFile struct {
+	Path   string `json:"path"`
+	Source string `json:"source,omitempty"` // "" for reports made for the bundle
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BundleEntry is a file to put in a bundle: a file read through the storage,
+// or data made for the bundle
+type BundleEntry struct {
+	Path   string
+	Source string
+	Data   []byte
+}
+
+// WriteBundle writes the entries to a zip archive, with manifest.json first
+func WriteBundle(storage Storage, name string, manifest BundleManifest, entries []BundleEntry) error {
+	contents := make([][]byte, 0, len(entries))
+	manifest.Files = make([]BundleFile, 0, len(entries))
+	for _, entry := range entries {
+		data := entry.Data
+		if entry.Source != "" {
+			file, err := storage.Open(entry.Source)
+			if err != nil {
+				return err
+			}
+			data, err = io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+		sum := sha256.Sum256(data)
+		contents = append(contents, data)
+		manifest.Files = append(manifest.Files, BundleFile{Path: entry.Path, Source: entry.Source, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := storage.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	add := func(path string, data []byte) error {
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Deflate, Modified: manifest.Created})
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(data)
+		return err
+	}
+	if err := add("manifest.json", manifestData); err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		if err := add(entry.Path, contents[i]); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
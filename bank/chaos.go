@@ -0,0 +1,247 @@
+package bank
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// Invariants a chaos experiment can expect to hold
+const (
+	ExpectSafety     = "safety"      // mutual exclusion, no negative balance and no money created or lost
+	ExpectProgress   = "progress"    // a transaction commits while the fault is injected
+	ExpectNoFailures = "no-failures" // no transaction fails while the fault is injected
+	ExpectRecovery   = "recovery"    // a transaction commits within the duration after the fault is lifted
+)
+
+// ChaosExperiment is a fault injected into the protocol messages once a
+// number of transactions were committed, for a while, and the invariants
+// that must hold through it, as listed in chaos.txt, one experiment per line:
+//
+//	# name, then the options
+//	lossy-approvals after=10 drop=0.2 for=500ms expect=safety,recovery
+//	jitter after=30 delay=5ms reorder=0.3 for=1s expect=safety,progress,no-failures
+//
+// The faults are those of mutex.Faults (drop, duplicate, reorder, delay); the
+// larger of each and that of Config.Faults is injected. The experiments run
+// one after the other in the order they start in, counting the transactions
+// committed by this process.
+type ChaosExperiment struct {
+	Name   string        `json:"name"`
+	After  int           `json:"after"`
+	Faults mutex.Faults  `json:"faults"`
+	For    time.Duration `json:"for"`
+	Expect []string      `json:"expect"`
+}
+
+// ChaosResult is the outcome of a chaos experiment
+type ChaosResult struct {
+	Name   string   `json:"name"`
+	Passed bool     `json:"passed"`
+	Failed []string `json:"failed,omitempty"`
+}
+
+func (result ChaosResult) String() string {
+	if result.Passed {
+		return fmt.Sprintf("%s: PASS", result.Name)
+	}
+	return fmt.Sprintf("%s: FAIL (%s)", result.Name, strings.Join(result.Failed, "; "))
+}
+
+func readChaos(storage Storage, folder_name string) ([]ChaosExperiment, error) {
+	// Read the optional chaos experiments from chaos.txt
+	file, err := storage.Open(folder_name + "/chaos.txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	experiments := make([]ChaosExperiment, 0)
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		experiment, err := parseChaos(fields)
+		if err == nil && names[experiment.Name] {
+			err = fmt.Errorf("experiment %s listed twice", experiment.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s/chaos.txt: %v", folder_name, err)
+		}
+		names[experiment.Name] = true
+		experiments = append(experiments, experiment)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(experiments, func(i, j int) bool {
+		return experiments[i].After < experiments[j].After
+	})
+	return experiments, nil
+}
+
+func parseChaos(fields []string) (ChaosExperiment, error) {
+	experiment := ChaosExperiment{Name: fields[0]}
+	var err error
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "after":
+			experiment.After, err = strconv.Atoi(value)
+			if err == nil && experiment.After < 0 {
+				err = fmt.Errorf("negative transaction count %d", experiment.After)
+			}
+		case "drop":
+			experiment.Faults.Drop, err = strconv.ParseFloat(value, 64)
+		case "duplicate":
+			experiment.Faults.Duplicate, err = strconv.ParseFloat(value, 64)
+		case "reorder":
+			experiment.Faults.Reorder, err = strconv.ParseFloat(value, 64)
+		case "delay":
+			experiment.Faults.Delay, err = time.ParseDuration(value)
+		case "for":
+			experiment.For, err = time.ParseDuration(value)
+		case "expect":
+			for _, invariant := range strings.Split(value, ",") {
+				switch invariant {
+				case ExpectSafety, ExpectProgress, ExpectNoFailures, ExpectRecovery:
+					experiment.Expect = append(experiment.Expect, invariant)
+				default:
+					err = fmt.Errorf("unknown invariant %q (expected safety, progress, no-failures or recovery)", invariant)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return experiment, fmt.Errorf("experiment %s: %v", experiment.Name, err)
+		}
+	}
+	switch {
+	case !experiment.Faults.Enabled():
+		err = fmt.Errorf("no fault to inject")
+	case experiment.For <= 0:
+		err = fmt.Errorf("no duration (for=)")
+	case len(experiment.Expect) == 0:
+		err = fmt.Errorf("no invariant to check (expect=)")
+	default:
+		err = experiment.Faults.Validate()
+	}
+	if err != nil {
+		return experiment, fmt.Errorf("experiment %s: %v", experiment.Name, err)
+	}
+	return experiment, nil
+}
+
+func (run *Simulation) chaos(done <-chan struct{}, finished chan<- struct{}) {
+	// run the experiments one after the other: wait for the transactions
+	// before each, inject its fault for its duration and check its invariants
+	defer close(finished)
+	ticker := run.clock.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	ended := false
+	wait := func(until func() bool, deadline time.Time) {
+		// until the condition holds, the deadline (if any) passes or the run ends
+		for !ended && !until() && (deadline.IsZero() || run.clock.Now().Before(deadline)) {
+			select {
+			case <-ticker.C():
+			case <-done:
+				ended = true
+			}
+		}
+	}
+
+	for _, experiment := range run.scenario.Chaos {
+		result := ChaosResult{Name: experiment.Name, Failed: make([]string, 0)}
+		wait(func() bool { return atomic.LoadInt64(&run.commits) >= int64(experiment.After) }, time.Time{})
+		if ended {
+			result.Failed = append(result.Failed, fmt.Sprintf("the run ended before %d transactions were committed", experiment.After))
+			run.chaosResults = append(run.chaosResults, result)
+			continue
+		}
+
+		commits, failures := atomic.LoadInt64(&run.commits), run.failureCount()
+		fmt.Fprintf(run.config.Output, "Chaos experiment %s: injecting %s for %s\n", experiment.Name, describeFaults(experiment.Faults), experiment.For)
+		faults := run.config.Faults
+		faults.Drop = max(faults.Drop, experiment.Faults.Drop)
+		faults.Duplicate = max(faults.Duplicate, experiment.Faults.Duplicate)
+		faults.Reorder = max(faults.Reorder, experiment.Faults.Reorder)
+		faults.Delay = max(faults.Delay, experiment.Faults.Delay)
+		run.faults.SetFaults(faults)
+		wait(func() bool { return false }, run.clock.Now().Add(experiment.For))
+		run.faults.SetFaults(run.config.Faults)
+		committed, failed := atomic.LoadInt64(&run.commits)-commits, run.failureCount()-failures
+		fmt.Fprintf(run.config.Output, "Chaos experiment %s: fault lifted after %d commits and %d failures\n", experiment.Name, committed, failed)
+
+		for _, invariant := range experiment.Expect {
+			switch invariant {
+			case ExpectProgress:
+				if committed == 0 {
+					result.Failed = append(result.Failed, "no transaction committed during the fault")
+				}
+			case ExpectNoFailures:
+				if failed > 0 {
+					result.Failed = append(result.Failed, fmt.Sprintf("%d transactions failed during the fault", failed))
+				}
+			case ExpectRecovery:
+				// the run finishing counts as recovered
+				lifted := atomic.LoadInt64(&run.commits)
+				wait(func() bool { return atomic.LoadInt64(&run.commits) > lifted }, run.clock.Now().Add(experiment.For))
+				if atomic.LoadInt64(&run.commits) == lifted && !ended {
+					result.Failed = append(result.Failed, fmt.Sprintf("no transaction committed within %s after the fault", experiment.For))
+				}
+			}
+		}
+		for _, invariant := range experiment.Expect {
+			if invariant == ExpectSafety {
+				if report := CheckSafety(run.chaosTrace.Events(), run.scenario.Balances, BalanceFloor(run.config.Funds)); !report.Passed {
+					result.Failed = append(result.Failed, "safety "+report.String())
+				}
+			}
+		}
+		result.Passed = len(result.Failed) == 0
+		fmt.Fprintf(run.config.Output, "Chaos experiment %s\n", result)
+		run.chaosResults = append(run.chaosResults, result)
+	}
+}
+
+func (run *Simulation) failureCount() int64 {
+	run.failures_mutex.Lock()
+	defer run.failures_mutex.Unlock()
+	count := int64(0)
+	for _, n := range run.failures {
+		count += n
+	}
+	return count
+}
+
+func describeFaults(faults mutex.Faults) string {
+	parts := make([]string, 0)
+	if faults.Drop > 0 {
+		parts = append(parts, fmt.Sprintf("drop %v", faults.Drop))
+	}
+	if faults.Duplicate > 0 {
+		parts = append(parts, fmt.Sprintf("duplicate %v", faults.Duplicate))
+	}
+	if faults.Reorder > 0 {
+		parts = append(parts, fmt.Sprintf("reorder %v", faults.Reorder))
+	}
+	if faults.Delay > 0 {
+		parts = append(parts, fmt.Sprintf("delay up to %s", faults.Delay))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,172 @@
+package bank
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Checkpoint is a restorable image of a run taken by a snapshot of every
+// process: the transactions each account committed or failed so far. The
+// balances follow from the scenario and the committed transactions, and the
+// protocol starts afresh on restore, so accounts that were waiting for or
+// inside the CS ask again for the transactions they hadn't committed.
+type Checkpoint struct {
+	Snapshot  int       `json:"snapshot"`
+	Time      time.Time `json:"time"`
+	Folder    string    `json:"folder"`
+	Algorithm string    `json:"algorithm"`
+	Committed []int     `json:"committed"`
+	Failed    []int     `json:"failed"`
+	InFlight  int       `json:"inFlight"` // replication messages in flight, already part of their sender's state
+	// resumed from a write-ahead log: the Lamport clock of each account at
+	// its last snapshot
+	Clocks map[int]int `json:"clocks,omitempty"`
+	// and the ledger transactions committed through Begin, in order
+	Postings [][]Posting `json:"postings,omitempty"`
+	// what couldn't be read back, printed when the checkpoint is restored
+	Warnings []string `json:"-"`
+}
+
+// checkpointPart is the state of one process
+type checkpointPart struct {
+	Committed []int `json:"committed"`
+	Failed    []int `json:"failed"`
+}
+
+// LoadCheckpoint reads a checkpoint written by a run
+func LoadCheckpoint(storage Storage, name string) (*Checkpoint, error) {
+	file, err := storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	checkpoint := &Checkpoint{}
+	if err := json.NewDecoder(file).Decode(checkpoint); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return checkpoint, nil
+}
+
+func (run *Simulation) recordCheckpoint(snapshot int) []byte {
+	// the outcomes of the transactions of our own accounts; those of the other
+	// accounts are recorded by their processes
+	committedIDs, failedIDs := run.ledger.outcomes()
+	part := checkpointPart{Committed: make([]int, 0), Failed: make([]int, 0)}
+	for _, id := range committedIDs {
+		if transaction, ok := run.byID[id]; ok && transaction.From != Bank && run.network.IsLocal(transaction.From) {
+			part.Committed = append(part.Committed, id)
+		}
+	}
+	for _, id := range failedIDs {
+		if transaction, ok := run.byID[id]; ok && transaction.From != Bank && run.network.IsLocal(transaction.From) {
+			part.Failed = append(part.Failed, id)
+		}
+	}
+	data, err := json.Marshal(part)
+	if err != nil {
+		fmt.Fprintln(run.config.Output, "Error recording checkpoint", snapshot, err)
+	}
+	return data
+}
+
+func (run *Simulation) writeCheckpoint(snapshot int, parts [][]byte, inFlight int) {
+	checkpoint := Checkpoint{
+		Snapshot:  snapshot,
+		Time:      run.clock.Now(),
+		Folder:    run.scenario.Folder,
+		Algorithm: string(run.config.Algorithm),
+		Committed: make([]int, 0),
+		Failed:    make([]int, 0),
+		InFlight:  inFlight,
+	}
+	for _, data := range parts {
+		var part checkpointPart
+		if err := json.Unmarshal(data, &part); err != nil {
+			fmt.Fprintln(run.config.Output, "Error reading checkpoint part:", err)
+			return
+		}
+		checkpoint.Committed = append(checkpoint.Committed, part.Committed...)
+		checkpoint.Failed = append(checkpoint.Failed, part.Failed...)
+	}
+	sort.Ints(checkpoint.Failed)
+
+	file, err := run.config.Storage.Create(run.config.Checkpoint)
+	if err != nil {
+		fmt.Fprintln(run.config.Output, "Error writing checkpoint:", err)
+		return
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(checkpoint); err != nil {
+		fmt.Fprintln(run.config.Output, "Error writing checkpoint:", err)
+		return
+	}
+	fmt.Fprintf(run.config.Output, "Checkpoint %d written to %s: %d committed, %d failed, %d in flight\n", snapshot, run.config.Checkpoint, len(checkpoint.Committed), len(checkpoint.Failed), inFlight)
+}
+
+func (run *Simulation) checkpointEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := run.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			run.network.Snapshot()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (run *Simulation) restore(checkpoint *Checkpoint) {
+	// apply the outcomes of the checkpoint, committing each transaction after
+	// the ones it depends on; the transfers restored are in the events of the
+	// run, which start from the opening balances
+	for _, warning := range checkpoint.Warnings {
+		fmt.Fprintln(run.config.Output, warning)
+	}
+	for _, id := range checkpoint.Failed {
+		if transaction, ok := run.byID[id]; ok {
+			run.ledger.replay(transaction, failed)
+		}
+	}
+	remaining := make([]Transaction, 0, len(checkpoint.Committed))
+	for _, id := range checkpoint.Committed {
+		if transaction, ok := run.byID[id]; ok {
+			remaining = append(remaining, transaction)
+		}
+	}
+	for len(remaining) > 0 {
+		next := remaining[:0]
+		for _, transaction := range remaining {
+			if run.ledger.dependencyState(transaction) == pending {
+				next = append(next, transaction)
+				continue
+			}
+			applied, err := run.ledger.replay(transaction, committed)
+			if err != nil {
+				run.countFailure("overflow", transaction)
+			} else if applied {
+				run.emitTransfer(transaction)
+			}
+			run.restored++
+		}
+		if len(next) == len(remaining) {
+			fmt.Fprintln(run.config.Output, "Checkpoint has", len(next), "transactions committed before their dependencies")
+			break
+		}
+		remaining = next
+	}
+	for _, postings := range checkpoint.Postings {
+		if err := run.ledger.replayPostings(postings); err != nil {
+			fmt.Fprintln(run.config.Output, "Error replaying ledger transaction:", err)
+		}
+	}
+	for id, clock := range checkpoint.Clocks {
+		if id >= 0 && id < run.network.Len() && run.network.IsLocal(id) {
+			run.network.AdvanceClock(id, clock)
+		}
+	}
+}
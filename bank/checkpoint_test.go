@@ -0,0 +1,68 @@
+package bank
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	// a run taking checkpoints as it goes, and a run restored from the last
+	// one it wrote, end with the same balances; the restored run only runs
+	// the transactions the checkpoint lacks
+	storage := NewMemoryStorage(os.DirFS(".."))
+	scenario, err := LoadScenario(storage, "tests/test_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.Storage = storage
+	config.Output = io.Discard
+	config.Clock = mutex.NewScaledClock(50)
+	config.CheckpointEvery = 500 * time.Millisecond
+	first := NewSimulation(config, scenario)
+	first.Run()
+
+	checkpoint, err := LoadCheckpoint(storage, config.Checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Folder != "tests/test_2" || checkpoint.Algorithm != string(mutex.Optimized) {
+		t.Fatalf("checkpoint of %s with %s", checkpoint.Folder, checkpoint.Algorithm)
+	}
+	if len(checkpoint.Committed) == 0 {
+		t.Fatal("the checkpoint has no committed transaction")
+	}
+
+	scenario, err = LoadScenario(storage, "tests/test_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := DefaultConfig()
+	restored.Storage = NewMemoryStorage(os.DirFS(".."))
+	restored.Output = io.Discard
+	restored.Clock = mutex.NewScaledClock(50)
+	restored.Restore = checkpoint
+	trace := &MemorySink{}
+	restored.Sinks = []Sink{trace}
+	second := NewSimulation(restored, scenario)
+	metrics := second.Run()
+
+	if metrics.Restored != len(checkpoint.Committed) {
+		t.Fatalf("%d transactions restored, expected the %d of the checkpoint", metrics.Restored, len(checkpoint.Committed))
+	}
+	if report := CheckSafety(trace.Events(), scenario.Balances, 0); !report.Passed {
+		t.Fatal(report)
+	}
+	if expected, balances := first.Outcome().Balances, second.Outcome().Balances; !reflect.DeepEqual(balances, expected) {
+		t.Fatalf("restored run ended with %v, expected %v", balances, expected)
+	}
+	committed, failed := second.Ledger().outcomes()
+	if len(committed) != len(scenario.Transactions) || len(failed) != 0 {
+		t.Fatalf("%d transactions committed and %d failed, expected all %d committed", len(committed), len(failed), len(scenario.Transactions))
+	}
+}
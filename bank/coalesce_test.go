@@ -0,0 +1,122 @@
+package bank
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+func TestCoalescingKeepsTheCS(t *testing.T) {
+	// account 0 runs its ready transactions in one CS entry, except after
+	// the one pausing
+	files := map[string]string{
+		"transactions.txt": "2,5\n0,1,1,0\n0,1,1,0\n0,1,1,1\n0,1,1,0\n0,1,1,0\n",
+		"quorum.txt":       "0,1\n0,1\n",
+		"balances.txt":     "0,10\n1,0\n",
+	}
+	for _, test := range []struct {
+		name      string
+		hold      time.Duration
+		entries   int
+		coalesced int64
+	}{
+		{"off", 0, 5, 0},
+		{"on", time.Minute, 2, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trace := &MemorySink{}
+			_, metrics := runFolder(t, files, func(config *Config) {
+				config.CoalesceHold = test.hold
+				config.Sinks = []Sink{trace}
+			})
+			report := CheckSafety(trace.Events(), map[int]Money{0: 1000, 1: 0}, 0)
+			if !report.Passed {
+				t.Fatal(report)
+			}
+			if report.Entries != test.entries || metrics.Coalesced != test.coalesced {
+				t.Fatalf("%d CS entries and %d coalesced transactions, expected %d and %d", report.Entries, metrics.Coalesced, test.entries, test.coalesced)
+			}
+		})
+	}
+}
+
+func TestCoalesceHoldLimit(t *testing.T) {
+	// the CS is kept until the hold time is up, and only for a transaction
+	// that is ready: without a pause before it, funded and free of pending
+	// dependencies
+	folder := fstest.MapFS{
+		"folder/transactions.txt": {Data: []byte("2,5\n0,1,1,0\n0,1,1,0\n0,20,1,0\n0,1,1,0,2\n0,1,1,1\n")},
+		"folder/quorum.txt":       {Data: []byte("0,1\n0,1\n")},
+		"folder/balances.txt":     {Data: []byte("0,10\n1,0\n")},
+	}
+	clock := mutex.NewVirtualClock(time.Unix(0, 0))
+	config := DefaultConfig()
+	config.Storage = NewMemoryStorage(folder)
+	config.Output = io.Discard
+	config.Clock = clock
+	config.CoalesceHold = 10 * time.Millisecond
+	scenario, err := LoadScenario(config.Storage, "folder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := NewSimulation(config, scenario)
+	run.transactions = scenario.Transactions
+	account := run.network.Account(0)
+	first := scenario.Transactions[0]
+
+	entered := clock.Now()
+	if keep, _ := run.keepCS(account, []int{1}, first, entered, 0); !keep {
+		t.Fatal("the CS wasn't kept for a ready transaction")
+	}
+	for name, queue := range map[string][]int{"unfunded": {2}, "pending dependency": {3}, "nothing queued": nil} {
+		if keep, _ := run.keepCS(account, queue, first, entered, 0); keep {
+			t.Errorf("the CS was kept with %s", name)
+		}
+	}
+	if keep, _ := run.keepCS(account, []int{1}, scenario.Transactions[4], entered, 0); keep {
+		t.Error("the CS was kept after a transaction pausing")
+	}
+	clock.Advance(9 * time.Millisecond)
+	if keep, _ := run.keepCS(account, []int{1}, first, entered, 0); !keep {
+		t.Fatal("the CS wasn't kept before the hold time is up")
+	}
+	clock.Advance(time.Millisecond)
+	if keep, _ := run.keepCS(account, []int{1}, first, entered, 0); keep {
+		t.Fatal("the CS was kept past the hold time")
+	}
+}
+
+func TestCoalescingFairnessGuard(t *testing.T) {
+	// the two accounts contend for the CS all along: with no transaction
+	// allowed while the other waits, none is run while it waits
+	lines := []string{"2,40"}
+	for i := 0; i < 20; i++ {
+		lines = append(lines, "0,1,1,0", "1,1,0,0")
+	}
+	files := map[string]string{
+		"transactions.txt": strings.Join(lines, "\n") + "\n",
+		"quorum.txt":       "0,1\n0,1\n",
+		"balances.txt":     "0,100\n1,100\n",
+	}
+	for _, algorithm := range []mutex.Algorithm{mutex.Original, mutex.Optimized} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			trace := &MemorySink{}
+			_, metrics := runFolder(t, files, func(config *Config) {
+				config.Algorithm = algorithm
+				config.CoalesceHold = time.Minute
+				config.CoalesceWaiting = 0
+				config.Sinks = []Sink{trace}
+			})
+			if report := CheckSafety(trace.Events(), map[int]Money{0: 10000, 1: 10000}, 0); !report.Passed {
+				t.Fatal(report)
+			}
+			if metrics.CoalesceSaved != 0 || metrics.CoalesceWait != 0 {
+				t.Fatalf("%d messages saved and %d us added to the wait of the other account while it waited", metrics.CoalesceSaved, metrics.CoalesceWait)
+			}
+		})
+	}
+}
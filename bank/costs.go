@@ -0,0 +1,103 @@
+package bank
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Costs splits the time of the accounts of this process between the
+// mutual exclusion algorithm (waiting for and holding the CS), the ledger and
+// waiting for work, from the start of each account to its last transaction
+type Costs struct {
+	Total      CostBreakdown         `json:"total"`
+	PerAccount map[int]CostBreakdown `json:"perAccount"`
+}
+
+// CostBreakdown is where the time of an account went, in milliseconds
+type CostBreakdown struct {
+	WaitCS  float64 `json:"waitingForCSMs"`
+	HoldCS  float64 `json:"holdingCSMs"`    // inside the CS besides the ledger work
+	Ledger  float64 `json:"ledgerWorkMs"`   // committing the transfers: the log, the write-ahead log and the replication
+	Funding float64 `json:"fundingWaitsMs"` // waiting for money or for the transactions depended on
+	Idle    float64 `json:"idleMs"`         // pauses, arrivals, circuit breaker cool-downs and between the steps
+}
+
+func (breakdown CostBreakdown) total() float64 {
+	return breakdown.WaitCS + breakdown.HoldCS + breakdown.Ledger + breakdown.Funding + breakdown.Idle
+}
+
+func (breakdown CostBreakdown) String() string {
+	total := breakdown.total()
+	share := func(ms float64) string {
+		if total <= 0 {
+			return fmt.Sprintf("%.1f ms", ms)
+		}
+		return fmt.Sprintf("%.1f ms (%.1f%%)", ms, 100*ms/total)
+	}
+	return fmt.Sprintf("waiting for the CS %s, holding the CS %s, ledger work %s, funding waits %s, idle %s",
+		share(breakdown.WaitCS), share(breakdown.HoldCS), share(breakdown.Ledger), share(breakdown.Funding), share(breakdown.Idle))
+}
+
+// Cost categories
+const (
+	costWaitCS = iota
+	costHoldCS
+	costLedger
+	costFunding
+	costIdle
+	costCategories
+)
+
+func costOf(state string) int {
+	// the category of the time an account spends in an activity state
+	switch state {
+	case "cs":
+		return costWaitCS
+	case "in cs":
+		return costHoldCS
+	case "funds", "dependencies", "set aside":
+		return costFunding
+	}
+	return costIdle
+}
+
+// costs adds up the time of each account by category
+type costs struct {
+	mutex    sync.Mutex
+	accounts map[int]*[costCategories]time.Duration
+}
+
+func (c *costs) spent(account int, category int, d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	spent, ok := c.accounts[account]
+	if !ok {
+		spent = &[costCategories]time.Duration{}
+		c.accounts[account] = spent
+	}
+	spent[category] += d
+}
+
+func (c *costs) report() Costs {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	report := Costs{PerAccount: make(map[int]CostBreakdown)}
+	for id, spent := range c.accounts {
+		// the ledger work is done while holding the CS
+		breakdown := CostBreakdown{
+			WaitCS:  milliseconds(spent[costWaitCS]),
+			HoldCS:  milliseconds(max(spent[costHoldCS]-spent[costLedger], 0)),
+			Ledger:  milliseconds(spent[costLedger]),
+			Funding: milliseconds(spent[costFunding]),
+			Idle:    milliseconds(spent[costIdle]),
+		}
+		report.PerAccount[id] = breakdown
+		report.Total.WaitCS += breakdown.WaitCS
+		report.Total.HoldCS += breakdown.HoldCS
+		report.Total.Ledger += breakdown.Ledger
+		report.Total.Funding += breakdown.Funding
+		report.Total.Idle += breakdown.Idle
+	}
+	return report
+}
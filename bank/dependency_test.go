@@ -0,0 +1,129 @@
+package bank
+
+import (
+	"io"
+	"testing"
+	"testing/fstest"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+func TestOutOfOrderExecution(t *testing.T) {
+	// account 0 can't pay transaction 0 until account 1 pays it in
+	// transaction 3, which waits for transactions 1 and 2: with the reorder
+	// strategy, both run ahead of transaction 0, which then runs too
+	files := map[string]string{
+		"transactions.txt": "3,4\n0,5,2,0\n0,1,2,0\n0,1,1,0\n1,10,0,0,1;2\n",
+		"quorum.txt":       "0,1,2\n0,1,2\n0,1,2\n",
+		"balances.txt":     "0,2\n1,10\n2,0\n",
+	}
+	run, metrics := runFolder(t, files, func(config *Config) { config.Funding = ReorderStrategy{} })
+	if len(metrics.Failures) != 0 {
+		t.Fatalf("failures %v", metrics.Failures)
+	}
+	if metrics.OutOfOrder != 2 {
+		t.Fatalf("%d transactions run out of order, expected 2", metrics.OutOfOrder)
+	}
+	order := make([]int, 4)
+	for id := range order {
+		position, ok := run.ledger.commitPosition(id)
+		if !ok {
+			t.Fatalf("transaction %d wasn't committed", id)
+		}
+		order[position] = id
+	}
+	if order[3] != 0 {
+		t.Fatalf("commit order %v, expected transaction 0 last", order)
+	}
+	expectBalances(t, run, map[int]Money{0: 500, 1: 100, 2: 600})
+}
+
+func TestDependenciesHonored(t *testing.T) {
+	// a chain of dependencies across the accounts, and account 0 with a
+	// later transaction free to run ahead of its dependent one: every
+	// transaction commits after those it depends on, whatever the algorithm
+	// and the funding strategy
+	files := map[string]string{
+		"transactions.txt": "4,6\n3,1,0,1\n2,1,3,0,0\n1,1,2,0,1\n0,1,1,0,2\n0,1,3,0\n3,1,2,0,3;4\n",
+		"quorum.txt":       "0,1,2,3\n0,1,2,3\n0,1,2,3\n0,1,2,3\n",
+		"balances.txt":     "0,10\n1,10\n2,10\n3,10\n",
+	}
+	dependencies := map[int][]int{1: {0}, 2: {1}, 3: {2}, 5: {3, 4}}
+	for _, algorithm := range []mutex.Algorithm{mutex.Original, mutex.Optimized, mutex.TokenRing, mutex.SuzukiKasami} {
+		for _, strategy := range []FundingStrategy{BlockStrategy{}, ReorderStrategy{}} {
+			t.Run(string(algorithm)+"/"+strategy.Name(), func(t *testing.T) {
+				run, metrics := runFolder(t, files, func(config *Config) {
+					config.Algorithm = algorithm
+					config.Funding = strategy
+				})
+				if metrics.Violations != 0 || len(metrics.Failures) != 0 {
+					t.Fatalf("%d ordering violations, failures %v", metrics.Violations, metrics.Failures)
+				}
+				for id, after := range dependencies {
+					position, ok := run.ledger.commitPosition(id)
+					if !ok {
+						t.Fatalf("transaction %d wasn't committed", id)
+					}
+					for _, dependency := range after {
+						if earlier, _ := run.ledger.commitPosition(dependency); earlier > position {
+							t.Errorf("transaction %d committed before transaction %d", id, dependency)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDependencyFailures(t *testing.T) {
+	// a transaction depending on one that failed fails too, and a dependency
+	// on a later transaction is invalid
+	files := map[string]string{
+		"transactions.txt": "2,3\n0,5,1,0\n1,1,0,0,0\n1,1,0,0,2\n",
+		"quorum.txt":       "0,1\n0,1\n",
+		"balances.txt":     "0,0\n1,10\n",
+	}
+	run, metrics := runFolder(t, files, func(config *Config) { config.Funding = FailFastStrategy{} })
+	expected := map[string]int64{"insufficient funds": 1, "dependency failed": 1, "invalid dependency": 1}
+	for reason, n := range expected {
+		if metrics.Failures[reason] != n {
+			t.Errorf("%d failures (%s), expected %d", metrics.Failures[reason], reason, n)
+		}
+	}
+	for id := 0; id < 3; id++ {
+		if run.ledger.state(id) != failed {
+			t.Errorf("transaction %d didn't fail", id)
+		}
+	}
+}
+
+func TestVerifyOrderingCountsViolations(t *testing.T) {
+	// transaction 1 committed before transaction 0 it depends on, and
+	// transaction 3 committed without transaction 2
+	files := fstest.MapFS{
+		"folder/transactions.txt": {Data: []byte("2,4\n0,1,1,0\n1,1,0,0,0\n0,1,1,0\n1,1,0,0,2\n")},
+		"folder/quorum.txt":       {Data: []byte("0,1\n0,1\n")},
+		"folder/balances.txt":     {Data: []byte("0,10\n1,10\n")},
+	}
+	config := DefaultConfig()
+	config.Storage = NewMemoryStorage(files)
+	config.Output = io.Discard
+	scenario, err := LoadScenario(config.Storage, "folder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := NewSimulation(config, scenario)
+	run.transactions = scenario.Transactions
+	if violations := run.verifyOrdering(); violations != 0 {
+		t.Fatalf("%d violations before any commit", violations)
+	}
+	run.ledger.Register(scenario.Transactions[1])
+	run.ledger.Register(scenario.Transactions[0])
+	if violations := run.verifyOrdering(); violations != 1 {
+		t.Fatalf("%d violations, expected 1", violations)
+	}
+	run.ledger.Register(scenario.Transactions[3])
+	if violations := run.verifyOrdering(); violations != 2 {
+		t.Fatalf("%d violations, expected 2", violations)
+	}
+}
@@ -0,0 +1,144 @@
+package bank
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Differential testing: the same scenario is run with two algorithms on the
+// same delivery schedule (the seed drawing the start order, the unordered
+// deliveries and the injected faults), and what the runs did is compared. The
+// goroutines still interleave differently from run to run, so the order the
+// accounts were granted the CS in may differ without anything being wrong;
+// what may not differ is the final balances, which transactions committed or
+// failed, and the order each account committed its own transactions in, as
+// long as accounts block for their funds.
+
+// Outcome is what a run did with the transactions of its scenario
+type Outcome struct {
+	Algorithm string        `json:"algorithm"`
+	Grants    []int         `json:"grants"` // the committed transactions, in the order their CS was granted
+	Failed    []int         `json:"failed"`
+	Balances  map[int]Money `json:"balances"`
+}
+
+// Outcome returns the outcome of a finished run
+func (run *Simulation) Outcome() Outcome {
+	committed, failed := run.ledger.outcomes()
+	return Outcome{
+		Algorithm: string(run.config.Algorithm),
+		Grants:    committed,
+		Failed:    failed,
+		Balances:  run.ledger.Balances(),
+	}
+}
+
+// Divergence lists how a run differs from the reference run
+type Divergence struct {
+	Reference string   `json:"reference"`
+	Algorithm string   `json:"algorithm"`
+	Balances  []string `json:"balances,omitempty"`
+	Outcomes  []string `json:"outcomes,omitempty"`
+	Accounts  []string `json:"accountOrder,omitempty"`
+	// where the grant orders first differ (-1 if they don't) and how many
+	// grants are at another position; informational only
+	FirstGrant int `json:"firstGrantDifference"`
+	Moved      int `json:"grantsMoved"`
+}
+
+// Diverged reports whether the runs disagree on the final state
+func (divergence Divergence) Diverged() bool {
+	return len(divergence.Balances) > 0 || len(divergence.Outcomes) > 0 || len(divergence.Accounts) > 0
+}
+
+func (divergence Divergence) String() string {
+	grants := "same grant order"
+	if divergence.FirstGrant >= 0 {
+		grants = fmt.Sprintf("grant orders differ from grant %d, %d grants moved", divergence.FirstGrant+1, divergence.Moved)
+	}
+	if !divergence.Diverged() {
+		return fmt.Sprintf("%s agrees with %s (%s)", divergence.Algorithm, divergence.Reference, grants)
+	}
+	return fmt.Sprintf("%s DIVERGES from %s: %d balances, %d outcomes and %d account orders differ (%s)", divergence.Algorithm, divergence.Reference, len(divergence.Balances), len(divergence.Outcomes), len(divergence.Accounts), grants)
+}
+
+// CompareOutcomes diffs a run against the reference run of the same scenario,
+// whose transactions give the account of each transaction
+func CompareOutcomes(reference Outcome, other Outcome, transactions []Transaction) Divergence {
+	divergence := Divergence{Reference: reference.Algorithm, Algorithm: other.Algorithm, FirstGrant: -1}
+
+	ids := make([]int, 0, len(reference.Balances))
+	for id := range reference.Balances {
+		ids = append(ids, id)
+	}
+	for id := range other.Balances {
+		if _, ok := reference.Balances[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if reference.Balances[id] != other.Balances[id] {
+			divergence.Balances = append(divergence.Balances, fmt.Sprintf("participant %d: %s vs %s", id, reference.Balances[id], other.Balances[id]))
+		}
+	}
+
+	states := func(outcome Outcome) map[int]string {
+		state := make(map[int]string)
+		for _, id := range outcome.Grants {
+			state[id] = "committed"
+		}
+		for _, id := range outcome.Failed {
+			state[id] = "failed"
+		}
+		return state
+	}
+	want, got := states(reference), states(other)
+	for _, transaction := range transactions {
+		if want[transaction.ID] != got[transaction.ID] {
+			divergence.Outcomes = append(divergence.Outcomes, fmt.Sprintf("transaction %d: %s vs %s", transaction.ID, orPending(want[transaction.ID]), orPending(got[transaction.ID])))
+		}
+	}
+
+	account := make(map[int]int)
+	for _, transaction := range transactions {
+		account[transaction.ID] = transaction.From
+	}
+	perAccount := func(grants []int) map[int][]int {
+		order := make(map[int][]int)
+		for _, id := range grants {
+			order[account[id]] = append(order[account[id]], id)
+		}
+		return order
+	}
+	wantOrder, gotOrder := perAccount(reference.Grants), perAccount(other.Grants)
+	accounts := make([]int, 0, len(wantOrder))
+	for id := range wantOrder {
+		if id != Bank {
+			accounts = append(accounts, id)
+		}
+	}
+	sort.Ints(accounts)
+	for _, id := range accounts {
+		if fmt.Sprint(wantOrder[id]) != fmt.Sprint(gotOrder[id]) {
+			divergence.Accounts = append(divergence.Accounts, fmt.Sprintf("participant %d: %v vs %v", id, wantOrder[id], gotOrder[id]))
+		}
+	}
+
+	for i := 0; i < max(len(reference.Grants), len(other.Grants)); i++ {
+		if i >= len(reference.Grants) || i >= len(other.Grants) || reference.Grants[i] != other.Grants[i] {
+			if divergence.FirstGrant < 0 {
+				divergence.FirstGrant = i
+			}
+			divergence.Moved++
+		}
+	}
+	return divergence
+}
+
+func orPending(state string) string {
+	if state == "" {
+		return "pending"
+	}
+	return state
+}
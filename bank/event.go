@@ -0,0 +1,193 @@
+package bank
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event is a transaction or protocol event emitted during a run
+type Event struct {
+	Kind    string    `json:"kind"` // request, approve, approved, revoke, yield, token, enter, release, transfer, failure, switch, join, leave or breaker
+	Account int       `json:"account"`
+	Peer    int       `json:"peer"`
+	Amount  Money     `json:"amount,omitempty"`
+	Reason  string    `json:"reason,omitempty"` // failure: why it failed, transfer: the operation if not a transfer, switch: the new algorithm, breaker: why it tripped
+	Time    time.Time `json:"time"`
+	Clock   int       `json:"clock,omitempty"` // Lamport clock of the account at the event
+	Lane    string    `json:"lane,omitempty"`  // transfer: the lane of the transaction if not the user lane
+	// enter and release in resource mode: the accounts the CS is held for
+	Resources []int `json:"resources,omitempty"`
+}
+
+func (event Event) String() string {
+	// describe the event in one line
+	timestamp := event.Time.Format("15:04:05.000000")
+	switch event.Kind {
+	case "request":
+		return fmt.Sprintf("%s Participant %d requests the CS from participant %d.", timestamp, event.Account, event.Peer)
+	case "approve":
+		return fmt.Sprintf("%s Participant %d approves participant %d.", timestamp, event.Account, event.Peer)
+	case "approved":
+		return fmt.Sprintf("%s Participant %d receives the approval of participant %d.", timestamp, event.Account, event.Peer)
+	case "revoke":
+		return fmt.Sprintf("%s Participant %d revokes the permission of participant %d.", timestamp, event.Account, event.Peer)
+	case "yield":
+		return fmt.Sprintf("%s Participant %d gives the permission of participant %d back.", timestamp, event.Account, event.Peer)
+	case "token":
+		return fmt.Sprintf("%s Participant %d passes the token to participant %d.", timestamp, event.Account, event.Peer)
+	case "enter":
+		if event.Resources != nil {
+			return fmt.Sprintf("%s Participant %d enters the CS for participants %v.", timestamp, event.Account, event.Resources)
+		}
+		return fmt.Sprintf("%s Participant %d enters the CS.", timestamp, event.Account)
+	case "release":
+		if event.Resources != nil {
+			return fmt.Sprintf("%s Participant %d releases the CS for participants %v.", timestamp, event.Account, event.Resources)
+		}
+		return fmt.Sprintf("%s Participant %d releases the CS.", timestamp, event.Account)
+	case "transfer":
+		if IsOperation(event.Reason) {
+			return fmt.Sprintf("%s %s", timestamp, describeMove(transactionOf(event)))
+		}
+		return fmt.Sprintf("%s Participant %d has transferred %s to participant %d.", timestamp, event.Account, event.Amount, event.Peer)
+	case "failure":
+		return fmt.Sprintf("%s Participant %d failed to transfer %s to participant %d (%s).", timestamp, event.Account, event.Amount, event.Peer, event.Reason)
+	case "switch":
+		return fmt.Sprintf("%s The accounts switch to the %s algorithm.", timestamp, event.Reason)
+	case "join":
+		return fmt.Sprintf("%s Participant %d joins the network.", timestamp, event.Account)
+	case "leave":
+		return fmt.Sprintf("%s Participant %d leaves the network.", timestamp, event.Account)
+	case "breaker":
+		return fmt.Sprintf("%s The circuit breaker of participant %d trips (%s).", timestamp, event.Account, event.Reason)
+	}
+	return fmt.Sprintf("%s %s %d %d", timestamp, event.Kind, event.Account, event.Peer)
+}
+
+// Formats of the transaction log
+const (
+	LogText = "text" // a line per committed transfer
+	LogJSON = "json" // a JSON object per event, as written by a JSONSink
+)
+
+// Sink receives the events of a run; implementations must be safe for
+// concurrent use since every account goroutine emits events
+type Sink interface {
+	Emit(event Event)
+}
+
+// FileSink appends one line per event to a file
+type FileSink struct {
+	mutex sync.Mutex
+	file  io.WriteCloser
+}
+
+func NewFileSink(storage Storage, name string) (*FileSink, error) {
+	file, err := storage.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (sink *FileSink) Emit(event Event) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	fmt.Fprintln(sink.file, event)
+}
+
+func (sink *FileSink) Close() error {
+	return sink.file.Close()
+}
+
+// JSONSink appends one JSON object per event to a file, the structured event
+// log projections are rebuilt from
+type JSONSink struct {
+	mutex   sync.Mutex
+	file    io.WriteCloser
+	encoder *json.Encoder
+	err     error // the first event that couldn't be written, returned by Close
+}
+
+func NewJSONSink(storage Storage, name string) (*JSONSink, error) {
+	file, err := storage.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSink{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (sink *JSONSink) Emit(event Event) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if err := sink.encoder.Encode(event); err != nil && sink.err == nil {
+		sink.err = fmt.Errorf("writing event: %w", err)
+	}
+}
+
+// Close closes the file, and returns the first error writing an event if
+// there was one
+func (sink *JSONSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if err := sink.file.Close(); err != nil {
+		return err
+	}
+	return sink.err
+}
+
+// ReadEvents reads back a structured event log written by a JSONSink
+func ReadEvents(storage Storage, name string) ([]Event, error) {
+	file, err := storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events := make([]Event, 0)
+	decoder := json.NewDecoder(file)
+	for {
+		var event Event
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: event %d: %v", name, len(events)+1, err)
+		}
+		events = append(events, event)
+	}
+}
+
+// StdoutSink prints one line per event
+type StdoutSink struct {
+	mutex sync.Mutex
+}
+
+func (sink *StdoutSink) Emit(event Event) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	fmt.Println(event)
+}
+
+// MemorySink keeps the events in memory, e.g. for assertions in tests
+type MemorySink struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+func (sink *MemorySink) Emit(event Event) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.events = append(sink.events, event)
+}
+
+func (sink *MemorySink) Events() []Event {
+	// return a copy of the events received so far
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return append([]Event(nil), sink.events...)
+}
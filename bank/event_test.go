@@ -0,0 +1,94 @@
+package bank
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunInMemory(t *testing.T) {
+	// a run reading its test folder from memory and writing its event log and
+	// final balances to memory: the events a MemorySink receives are those
+	// logged, and nothing is written to disk
+	folder := fstest.MapFS{
+		"memory/transactions.txt": {Data: []byte("3,3\n0,4,1,0\n1,2,2,0\n2,1,0,0\n")},
+		"memory/quorum.txt":       {Data: []byte("0,1\n1,2\n0,2\n")},
+		"memory/balances.txt":     {Data: []byte("0,10\n1,10\n2,10\n")},
+	}
+	storage := NewMemoryStorage(folder)
+	trace := &MemorySink{}
+	config := DefaultConfig()
+	config.Storage = storage
+	config.LogFormat = LogJSON
+	config.LogName = "events.jsonl"
+	config.Sinks = []Sink{trace}
+	scenario, err := LoadScenario(storage, "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := NewSimulation(config, scenario)
+	run.Run()
+	if err := run.WriteFinalBalances("balances.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	report := CheckSafety(trace.Events(), scenario.Balances, 0)
+	if !report.Passed {
+		t.Fatal(report)
+	}
+	if report.Entries != 3 {
+		t.Fatalf("%d CS entries, expected 3", report.Entries)
+	}
+	logged, err := ReadEvents(storage, "events.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]int)
+	for _, event := range trace.Events() {
+		kinds[event.Kind]++
+	}
+	for _, event := range logged {
+		kinds[event.Kind]--
+	}
+	for kind, n := range kinds {
+		if n != 0 {
+			t.Errorf("%d more %s events in the MemorySink than in the log", n, kind)
+		}
+	}
+
+	balances, err := storage.ReadFile("balances.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(balances) != "0,7.00\n1,12.00\n2,11.00\n" {
+		t.Fatalf("final balances:\n%s", balances)
+	}
+	for _, name := range []string{"events.jsonl", "balances.txt"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s written to disk", name)
+		}
+	}
+}
+
+type failingFile struct{}
+
+func (failingFile) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func (failingFile) Close() error {
+	return nil
+}
+
+func TestJSONSinkReturnsWriteErrors(t *testing.T) {
+	// an event that can't be written is reported by Close, not printed
+	sink := &JSONSink{file: failingFile{}, encoder: json.NewEncoder(failingFile{})}
+	sink.Emit(Event{Kind: "enter"})
+	sink.Emit(Event{Kind: "exit"})
+	if err := sink.Close(); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Close returned %v", err)
+	}
+}
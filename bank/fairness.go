@@ -0,0 +1,77 @@
+package bank
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Fairness describes how evenly the accounts of this process got the CS
+type Fairness struct {
+	// Jain's index of the average CS wait of the accounts: 1 when they all
+	// wait as long, down to 1/n when a single account does all the waiting
+	JainIndex      float64                 `json:"jainIndex"`
+	MaxWait        float64                 `json:"maxCSWaitMs"` // the longest wait for one CS entry
+	MaxWaitAccount int                     `json:"maxCSWaitAccount"`
+	Boosts         int64                   `json:"boosts,omitempty"` // aging only: requests boosted after waiting too long
+	PerAccount     map[int]AccountFairness `json:"perAccount"`
+}
+
+// AccountFairness is how often an account entered the CS and how long it
+// waited for it
+type AccountFairness struct {
+	Entries int64   `json:"csEntries"`
+	AvgWait float64 `json:"avgCSWaitMs"`
+	MaxWait float64 `json:"maxCSWaitMs"`
+}
+
+func (fairness Fairness) String() string {
+	return fmt.Sprintf("Jain's index %.3f over the average CS waits, longest wait %.3f ms (participant %d)", fairness.JainIndex, fairness.MaxWait, fairness.MaxWaitAccount)
+}
+
+// fairness counts the CS entries of each account and how long they waited,
+// every entry included, unlike the latencies of the committed transactions
+type fairness struct {
+	mutex    sync.Mutex
+	accounts map[int]*accountEntries
+}
+
+type accountEntries struct {
+	entries int64
+	waited  time.Duration
+	longest time.Duration
+}
+
+func (f *fairness) entered(account int, wait time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	entries, ok := f.accounts[account]
+	if !ok {
+		entries = &accountEntries{}
+		f.accounts[account] = entries
+	}
+	entries.entries++
+	entries.waited += wait
+	entries.longest = max(entries.longest, wait)
+}
+
+func (f *fairness) report() Fairness {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	report := Fairness{JainIndex: 1, MaxWaitAccount: -1, PerAccount: make(map[int]AccountFairness)}
+	var sum, squares float64
+	for id, entries := range f.accounts {
+		average := milliseconds(entries.waited / time.Duration(entries.entries))
+		report.PerAccount[id] = AccountFairness{Entries: entries.entries, AvgWait: average, MaxWait: milliseconds(entries.longest)}
+		sum += average
+		squares += average * average
+		if longest := milliseconds(entries.longest); longest > report.MaxWait || report.MaxWaitAccount < 0 {
+			report.MaxWait = longest
+			report.MaxWaitAccount = id
+		}
+	}
+	if squares > 0 {
+		report.JainIndex = sum * sum / (float64(len(f.accounts)) * squares)
+	}
+	return report
+}
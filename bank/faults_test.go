@@ -0,0 +1,49 @@
+package bank
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+func TestDroppedMessagesAreResent(t *testing.T) {
+	// a fifth of the protocol messages are lost; the unacknowledged ones are
+	// sent again after the request timeout, so the run still finishes
+	for _, algorithm := range []mutex.Algorithm{mutex.Optimized, mutex.Original} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			storage := NewMemoryStorage(os.DirFS(".."))
+			config := DefaultConfig()
+			config.Algorithm = algorithm
+			config.Clock = mutex.NewScaledClock(10)
+			config.Storage = storage
+			config.Faults = mutex.Faults{Drop: 0.2, Seed: 42}
+			config.RequestTimeout = 10 * time.Millisecond
+			trace := &MemorySink{}
+			config.Sinks = []Sink{trace}
+			scenario, err := LoadScenario(storage, "tests/test_2")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan Metrics, 1)
+			go func() { done <- NewSimulation(config, scenario).Run() }()
+			var metrics Metrics
+			select {
+			case metrics = <-done:
+			case <-time.After(2 * time.Minute):
+				t.Fatal("the run hangs on the dropped messages")
+			}
+			if metrics.Faults == nil || metrics.Faults.Dropped == 0 {
+				t.Fatal("no message dropped")
+			}
+			if metrics.Resent == 0 {
+				t.Fatal("no message sent again")
+			}
+			if report := CheckSafety(trace.Events(), scenario.Balances, 0); !report.Passed {
+				t.Fatalf("safety: %s", report)
+			}
+		})
+	}
+}
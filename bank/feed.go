@@ -0,0 +1,183 @@
+package bank
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// BalanceFeed streams the balance changes and the CS ownership changes of a
+// run as server-sent events, which curl and short scripts can follow:
+//
+//	event: balance
+//	data: {"account":3,"balance":"12.50"}
+//
+//	event: cs
+//	data: {"account":3,"owner":true}
+//
+// A client gets the balance of every account and the current CS owners when
+// it connects, then every change. A client that falls more than
+// FeedBuffer events behind is disconnected and may reconnect for a fresh
+// start. Add the feed to Config.Sinks and attach it to the simulation the
+// balances are read from.
+type BalanceFeed struct {
+	mutex   sync.Mutex
+	run     atomic.Pointer[Simulation]
+	owners  map[int]bool // the accounts inside the CS
+	clients map[chan feedEvent]bool
+	seq     int64
+}
+
+// FeedBuffer is how many events a client of a BalanceFeed may fall behind
+const FeedBuffer = 1024
+
+type feedEvent struct {
+	id   int64
+	kind string
+	data []byte
+}
+
+type balanceChange struct {
+	Account int    `json:"account"`
+	Balance string `json:"balance"`
+}
+
+type ownerChange struct {
+	Account   int   `json:"account"`
+	Owner     bool  `json:"owner"`
+	Resources []int `json:"resources,omitempty"` // resource mode: the accounts the CS is held for
+}
+
+func NewBalanceFeed() *BalanceFeed {
+	return &BalanceFeed{owners: make(map[int]bool), clients: make(map[chan feedEvent]bool)}
+}
+
+// Attach gives the feed the run to read the balances from
+func (feed *BalanceFeed) Attach(run *Simulation) {
+	feed.run.Store(run)
+}
+
+func (feed *BalanceFeed) Emit(event Event) {
+	switch event.Kind {
+	case "transfer":
+		run := feed.run.Load()
+		if run == nil {
+			return
+		}
+		feed.mutex.Lock()
+		defer feed.mutex.Unlock()
+		for _, account := range []int{event.Account, event.Peer} {
+			if account != Bank {
+				feed.publish("balance", balanceChange{Account: account, Balance: run.ledger.Balance(account).String()})
+			}
+		}
+	case "enter", "release":
+		feed.mutex.Lock()
+		defer feed.mutex.Unlock()
+		owner := event.Kind == "enter"
+		if owner {
+			feed.owners[event.Account] = true
+		} else {
+			delete(feed.owners, event.Account)
+		}
+		feed.publish("cs", ownerChange{Account: event.Account, Owner: owner, Resources: event.Resources})
+	}
+}
+
+func (feed *BalanceFeed) publish(kind string, change any) {
+	// send a change to every client; the caller holds mutex
+	data, err := json.Marshal(change)
+	if err != nil {
+		return
+	}
+	feed.seq++
+	event := feedEvent{id: feed.seq, kind: kind, data: data}
+	for client := range feed.clients {
+		select {
+		case client <- event:
+		default:
+			// too far behind: the client ends its stream
+			delete(feed.clients, client)
+			close(client)
+		}
+	}
+}
+
+func (feed *BalanceFeed) subscribe() chan feedEvent {
+	// a new client, sent the current state first
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	state := make([]feedEvent, 0)
+	add := func(kind string, change any) {
+		if data, err := json.Marshal(change); err == nil {
+			state = append(state, feedEvent{id: feed.seq, kind: kind, data: data})
+		}
+	}
+	if run := feed.run.Load(); run != nil {
+		balances := run.ledger.Balances()
+		accounts := make([]int, 0, len(balances))
+		for account := range balances {
+			accounts = append(accounts, account)
+		}
+		sort.Ints(accounts)
+		for _, account := range accounts {
+			if account != Bank {
+				add("balance", balanceChange{Account: account, Balance: balances[account].String()})
+			}
+		}
+	}
+	owners := make([]int, 0, len(feed.owners))
+	for account := range feed.owners {
+		owners = append(owners, account)
+	}
+	sort.Ints(owners)
+	for _, account := range owners {
+		add("cs", ownerChange{Account: account, Owner: true})
+	}
+
+	client := make(chan feedEvent, len(state)+FeedBuffer)
+	for _, event := range state {
+		client <- event
+	}
+	feed.clients[client] = true
+	return client
+}
+
+func (feed *BalanceFeed) unsubscribe(client chan feedEvent) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	if feed.clients[client] {
+		delete(feed.clients, client)
+		close(client)
+	}
+}
+
+// ServeHTTP streams the events until the client goes away
+func (feed *BalanceFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	client := feed.subscribe()
+	defer feed.unsubscribe(client)
+	for {
+		select {
+		case event, ok := <-client:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.id, event.kind, event.data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package bank
+
+// FundingDecision is what an account does with a transaction it can't fund yet
+type FundingDecision int
+
+const (
+	RetryTransaction FundingDecision = iota // the money arrived, ask for the CS again
+	DeferTransaction                        // set the transaction aside and run the next one first
+	FailTransaction                         // give up on the transaction
+)
+
+// FundingStrategy decides what happens when an account lacks the money for a
+// transaction; it is called outside the CS. Strategies running transactions
+// out of order also skip transactions whose dependencies are still pending,
+// the others wait for them.
+type FundingStrategy interface {
+	Name() string
+	Unfunded(ledger *Ledger, transaction Transaction) FundingDecision
+	OutOfOrder() bool
+}
+
+// BlockStrategy waits until incoming transfers fund the transaction
+type BlockStrategy struct{}
+
+func (BlockStrategy) Name() string {
+	return "block"
+}
+
+func (BlockStrategy) Unfunded(ledger *Ledger, transaction Transaction) FundingDecision {
+	ledger.waitToFund(transaction)
+	return RetryTransaction
+}
+
+func (BlockStrategy) OutOfOrder() bool {
+	return false
+}
+
+// ReorderStrategy lets the account run its later transactions out of order
+// while this one is unfunded; the account returns to it after every committed
+// transaction and every incoming transfer
+type ReorderStrategy struct{}
+
+func (ReorderStrategy) Name() string {
+	return "reorder"
+}
+
+func (ReorderStrategy) Unfunded(ledger *Ledger, transaction Transaction) FundingDecision {
+	return DeferTransaction
+}
+
+func (ReorderStrategy) OutOfOrder() bool {
+	return true
+}
+
+// FailFastStrategy fails the transaction right away
+type FailFastStrategy struct{}
+
+func (FailFastStrategy) Name() string {
+	return "fail-fast"
+}
+
+func (FailFastStrategy) Unfunded(ledger *Ledger, transaction Transaction) FundingDecision {
+	return FailTransaction
+}
+
+func (FailFastStrategy) OutOfOrder() bool {
+	return false
+}
+
+// FundingStrategies are the strategies selectable by name
+var FundingStrategies = map[string]FundingStrategy{
+	"block":     BlockStrategy{},
+	"reorder":   ReorderStrategy{},
+	"fail-fast": FailFastStrategy{},
+}
@@ -0,0 +1,93 @@
+package bank
+
+import (
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+// runFolder runs the test folder of the given files from memory
+func runFolder(t *testing.T, files map[string]string, configure func(*Config)) (*Simulation, Metrics) {
+	t.Helper()
+	folder := fstest.MapFS{}
+	for name, data := range files {
+		folder["folder/"+name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	config := DefaultConfig()
+	config.Storage = NewMemoryStorage(folder)
+	config.Output = io.Discard
+	if configure != nil {
+		configure(&config)
+	}
+	scenario, err := LoadScenario(config.Storage, "folder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := NewSimulation(config, scenario)
+	return run, run.Run()
+}
+
+func TestFundingStrategies(t *testing.T) {
+	// account 0 can't pay transaction 0 until account 1 pays it in
+	// transaction 2, which depends on transaction 1 of account 0
+	files := map[string]string{
+		"transactions.txt": "3,3\n0,5,2,0\n0,1,2,0\n1,10,0,0,1\n",
+		"quorum.txt":       "0,1,2\n0,1,2\n0,1,2\n",
+		"balances.txt":     "0,1\n1,10\n2,0\n",
+	}
+
+	t.Run("reorder", func(t *testing.T) {
+		// transaction 0 is set aside for the later ones, then runs
+		run, metrics := runFolder(t, files, func(config *Config) { config.Funding = ReorderStrategy{} })
+		if len(metrics.Failures) != 0 || metrics.FundingWaits["reorder"] == 0 || metrics.OutOfOrder != 1 {
+			t.Fatalf("failures %v, funding waits %v, %d out of order", metrics.Failures, metrics.FundingWaits, metrics.OutOfOrder)
+		}
+		first, _ := run.ledger.commitPosition(1)
+		last, _ := run.ledger.commitPosition(0)
+		if first > last {
+			t.Fatal("transaction 0 committed before transaction 1")
+		}
+		expectBalances(t, run, map[int]Money{0: 500, 1: 0, 2: 600})
+	})
+
+	t.Run("fail-fast", func(t *testing.T) {
+		// transaction 0 fails at once, and the others run
+		run, metrics := runFolder(t, files, func(config *Config) { config.Funding = FailFastStrategy{} })
+		if metrics.Failures["insufficient funds"] != 1 || metrics.FundingWaits["fail-fast"] != 1 {
+			t.Fatalf("failures %v, funding waits %v", metrics.Failures, metrics.FundingWaits)
+		}
+		if run.ledger.state(0) != failed {
+			t.Fatal("transaction 0 didn't fail")
+		}
+		expectBalances(t, run, map[int]Money{0: 1000, 1: 0, 2: 100})
+	})
+
+	t.Run("block", func(t *testing.T) {
+		// without the dependency, account 0 waits for the money and runs its
+		// transactions in order
+		files := map[string]string{
+			"transactions.txt": "3,3\n0,5,2,0\n0,1,2,0\n1,10,0,0\n",
+			"quorum.txt":       files["quorum.txt"],
+			"balances.txt":     files["balances.txt"],
+		}
+		run, metrics := runFolder(t, files, nil)
+		if len(metrics.Failures) != 0 || metrics.OutOfOrder != 0 {
+			t.Fatalf("failures %v, %d out of order", metrics.Failures, metrics.OutOfOrder)
+		}
+		first, _ := run.ledger.commitPosition(0)
+		last, _ := run.ledger.commitPosition(1)
+		if first > last {
+			t.Fatal("transaction 1 committed before transaction 0")
+		}
+		expectBalances(t, run, map[int]Money{0: 500, 1: 0, 2: 600})
+	})
+}
+
+func expectBalances(t *testing.T, run *Simulation, expected map[int]Money) {
+	t.Helper()
+	for id, balance := range expected {
+		if run.ledger.Balance(id) != balance {
+			t.Errorf("participant %d has %s, expected %s", id, run.ledger.Balance(id), balance)
+		}
+	}
+}
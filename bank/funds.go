@@ -0,0 +1,73 @@
+package bank
+
+// Funds is what a FundsRule sees of the account running a transaction
+type Funds struct {
+	Balance Money
+	// needed by the earlier transactions of the account that are still
+	// pending, such as those set aside by ReorderStrategy
+	Pending Money
+}
+
+// FundsRule decides whether an account has the money for a transaction. The
+// ledger asks it before the account requests the CS, while a FundingStrategy
+// waits for the money, and again inside the CS; it is called with the ledger
+// locked, so it must not call the ledger back.
+type FundsRule interface {
+	Name() string
+	Covers(funds Funds, transaction Transaction) bool
+}
+
+// BalanceRule funds a transaction from the balance alone
+type BalanceRule struct{}
+
+func (BalanceRule) Name() string {
+	return "balance"
+}
+
+func (BalanceRule) Covers(funds Funds, transaction Transaction) bool {
+	return funds.Balance >= transaction.Needs()
+}
+
+// PendingRule keeps the money of the earlier pending transactions of the
+// account for them: a later transaction is only funded by what is left
+type PendingRule struct{}
+
+func (PendingRule) Name() string {
+	return "pending"
+}
+
+func (PendingRule) Covers(funds Funds, transaction Transaction) bool {
+	left, err := funds.Balance.Sub(funds.Pending)
+	return err == nil && left >= transaction.Needs()
+}
+
+// CreditLineRule lets the balance of an account go down to -Limit
+type CreditLineRule struct {
+	Limit Money
+}
+
+func (CreditLineRule) Name() string {
+	return "credit"
+}
+
+func (rule CreditLineRule) Covers(funds Funds, transaction Transaction) bool {
+	available, err := funds.Balance.Add(rule.Limit)
+	return err != nil || available >= transaction.Needs()
+}
+
+// BalanceFloor returns the lowest balance the rule lets an account reach: the
+// opposite of the credit line, 0 for the other rules and a nil rule
+func BalanceFloor(rule FundsRule) Money {
+	if credit, ok := rule.(CreditLineRule); ok {
+		return -credit.Limit
+	}
+	return 0
+}
+
+// FundsRules are the rules selectable by name; the credit line of "credit"
+// is set apart
+var FundsRules = map[string]FundsRule{
+	"balance": BalanceRule{},
+	"pending": PendingRule{},
+	"credit":  CreditLineRule{},
+}
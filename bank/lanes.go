@@ -0,0 +1,88 @@
+package bank
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Lanes of a transaction. User transactions are those the users of the bank
+// wait on; system transactions (interest, fees, settlements) are background
+// work: an account runs a ready user transaction before its system ones, and
+// the latency metrics of the run are those of the user lane alone.
+const (
+	LaneUser   = ""
+	LaneSystem = "system"
+)
+
+// LaneMetrics is the latency of the transactions of one lane
+type LaneMetrics struct {
+	Committed int            `json:"committed"`
+	CSWait    LatencySummary `json:"csWaitMs"`
+	Latency   LatencySummary `json:"latencyMs"`
+}
+
+func (lane LaneMetrics) String() string {
+	return fmt.Sprintf("%d committed, CS wait (ms): %s, latency (ms): %s", lane.Committed, lane.CSWait, lane.Latency)
+}
+
+func parseLane(field string) (string, bool) {
+	switch field {
+	case "", "user":
+		return LaneUser, true
+	case LaneSystem:
+		return LaneSystem, true
+	}
+	return LaneUser, false
+}
+
+func laneName(lane string) string {
+	if lane == LaneUser {
+		return "user"
+	}
+	return lane
+}
+
+func (run *Simulation) yieldTo(queue []int, next int) int {
+	// a system transaction yields to the next user transaction of the queue
+	// if that one can run right away; return the position to run
+	if run.transactions[queue[next]].Lane != LaneSystem {
+		return next
+	}
+	for i := next + 1; i < len(queue); i++ {
+		transaction := run.transactions[queue[i]]
+		if transaction.Lane == LaneSystem {
+			continue
+		}
+		if run.clock.Since(run.start) >= transaction.Arrival && run.ledger.dependencyState(transaction) == committed && run.ledger.CanFund(transaction) {
+			atomic.AddInt64(&run.yielded, 1)
+			return i
+		}
+		break
+	}
+	return next
+}
+
+func laneSamples(samples []latencySample, lane string) []latencySample {
+	selected := make([]latencySample, 0, len(samples))
+	for _, sample := range samples {
+		if sample.lane == lane {
+			selected = append(selected, sample)
+		}
+	}
+	return selected
+}
+
+func laneMetrics(samples []latencySample) map[string]LaneMetrics {
+	// the latency of each lane, when the run has system transactions
+	system := laneSamples(samples, LaneSystem)
+	if len(system) == 0 {
+		return nil
+	}
+	lanes := make(map[string]LaneMetrics)
+	for _, lane := range []string{LaneUser, LaneSystem} {
+		selected := laneSamples(samples, lane)
+		csWait, latency, _ := latencyMetrics(selected)
+		lanes[laneName(lane)] = LaneMetrics{Committed: len(selected), CSWait: csWait, Latency: latency}
+	}
+	return lanes
+}
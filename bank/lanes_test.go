@@ -0,0 +1,30 @@
+package bank
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestYieldToUserIsntOutOfOrder(t *testing.T) {
+	// account 0 runs its user transaction before the system one ahead of it:
+	// that is the lanes at work, not a transaction committed out of order
+	folder := fstest.MapFS{
+		"lanes/transactions.txt": {Data: []byte("2,2\n0,1,1,0,,system\n0,1,1,0\n")},
+		"lanes/quorum.txt":       {Data: []byte("0,1\n0,1\n")},
+		"lanes/balances.txt":     {Data: []byte("0,10\n1,10\n")},
+	}
+	storage := NewMemoryStorage(folder)
+	config := DefaultConfig()
+	config.Storage = storage
+	scenario, err := LoadScenario(storage, "lanes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := NewSimulation(config, scenario).Run()
+	if metrics.Yielded != 1 {
+		t.Fatalf("%d system transactions yielded, expected 1", metrics.Yielded)
+	}
+	if metrics.OutOfOrder != 0 {
+		t.Fatalf("%d transactions out of order, expected none", metrics.OutOfOrder)
+	}
+}
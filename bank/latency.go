@@ -0,0 +1,132 @@
+package bank
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// latencySample is the timing of one committed transaction
+type latencySample struct {
+	account int
+	lane    string
+	csWait  time.Duration // blocked asking for the CS
+	latency time.Duration // from the account starting on the transaction to its commit
+	commit  time.Time
+}
+
+// LatencySummary describes a distribution of durations, in milliseconds
+type LatencySummary struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// AccountLatency is the latency breakdown of one account
+type AccountLatency struct {
+	Committed int            `json:"committed"`
+	CSWait    LatencySummary `json:"csWaitMs"`
+	Latency   LatencySummary `json:"latencyMs"`
+	// permission-based algorithms only: the quorum members slowest to approve
+	// the requests of the account
+	Responders []Responder `json:"slowestResponders,omitempty"`
+}
+
+func (summary LatencySummary) String() string {
+	return fmt.Sprintf("min %.3f, avg %.3f, p50 %.3f, p95 %.3f, p99 %.3f, max %.3f", summary.Min, summary.Avg, summary.P50, summary.P95, summary.P99, summary.Max)
+}
+
+func (run *Simulation) recordLatency(account int, lane string, csWait time.Duration, latency time.Duration) {
+	run.latencies_mutex.Lock()
+	defer run.latencies_mutex.Unlock()
+	run.latencies = append(run.latencies, latencySample{account: account, lane: lane, csWait: csWait, latency: latency, commit: run.clock.Now()})
+}
+
+func (run *Simulation) warmUp() (time.Duration, []latencySample) {
+	// the warm-up lasts Config.WarmUp and until Config.WarmUpTransactions
+	// transactions were committed; return how long it lasted and the samples
+	// committed after it
+	run.latencies_mutex.Lock()
+	defer run.latencies_mutex.Unlock()
+	length := run.config.WarmUp
+	if k := run.config.WarmUpTransactions; k > 0 {
+		if k > len(run.latencies) {
+			return time.Duration(run.duration) * time.Millisecond, nil
+		}
+		length = max(length, run.latencies[k-1].commit.Sub(run.start))
+	}
+	length = min(length, time.Duration(run.duration)*time.Millisecond)
+	if length <= 0 {
+		return 0, run.latencies
+	}
+	samples := make([]latencySample, 0, len(run.latencies))
+	for _, sample := range run.latencies {
+		if sample.commit.Sub(run.start) > length {
+			samples = append(samples, sample)
+		}
+	}
+	return length, samples
+}
+
+// Summarize describes a distribution of durations
+func Summarize(durations []time.Duration) LatencySummary {
+	return summarize(durations)
+}
+
+func summarize(durations []time.Duration) LatencySummary {
+	if len(durations) == 0 {
+		return LatencySummary{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, duration := range sorted {
+		total += duration
+	}
+	// nearest-rank percentiles
+	percentile := func(p int) float64 {
+		rank := (p*len(sorted) + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		return milliseconds(sorted[rank-1])
+	}
+	return LatencySummary{
+		Min: milliseconds(sorted[0]),
+		Avg: milliseconds(total / time.Duration(len(sorted))),
+		P50: percentile(50),
+		P95: percentile(95),
+		P99: percentile(99),
+		Max: milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
+
+func latencyMetrics(samples []latencySample) (LatencySummary, LatencySummary, map[int]AccountLatency) {
+	// overall and per-account summaries of the committed transactions
+	waits := make([]time.Duration, 0, len(samples))
+	latencies := make([]time.Duration, 0, len(samples))
+	accountWaits := make(map[int][]time.Duration)
+	accountLatencies := make(map[int][]time.Duration)
+	for _, sample := range samples {
+		waits = append(waits, sample.csWait)
+		latencies = append(latencies, sample.latency)
+		accountWaits[sample.account] = append(accountWaits[sample.account], sample.csWait)
+		accountLatencies[sample.account] = append(accountLatencies[sample.account], sample.latency)
+	}
+	perAccount := make(map[int]AccountLatency)
+	for account, samples := range accountLatencies {
+		perAccount[account] = AccountLatency{
+			Committed: len(samples),
+			CSWait:    summarize(accountWaits[account]),
+			Latency:   summarize(samples),
+		}
+	}
+	return summarize(waits), summarize(latencies), perAccount
+}
@@ -0,0 +1,285 @@
+package bank
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// States of a transaction; pending transactions have no entry in the ledger
+const (
+	pending = iota
+	committed
+	failed
+)
+
+// Ledger keeps the balances of the accounts in memory and appends every
+// committed transfer to a log file for auditing. Accounts waiting for money or
+// for the transactions they depend on are notified every time a transaction is
+// committed or fails.
+type Ledger struct {
+	log io.WriteCloser
+	wal *writeAheadLog // crash recovery: every outcome, synced before it is applied
+
+	funding_mutex    sync.Mutex
+	funding_cond     *sync.Cond
+	balances         map[int]Money
+	transactionsDone int
+	transactionState map[int]int
+	commitOrder      map[int]int // position of each committed transaction in the commit order
+	rule             FundsRule
+	outgoing         map[int][]Transaction // the transactions of each account, for the pending money
+
+	cs sync.Locker // held by Commit to keep the accounts out of the CS; nil without a simulation
+}
+
+// NewLedger starts a ledger with the given opening balances (which may be
+// nil) and an empty log file, or without a log if the name is empty. A log
+// file that can't be created is returned as an error with a ledger without
+// a log.
+func NewLedger(storage Storage, name string, balances map[int]Money) (*Ledger, error) {
+	var log io.WriteCloser
+	var err error
+	if name != "" {
+		if log, err = storage.Create(name); err != nil {
+			log = nil
+		}
+	}
+	ledger := &Ledger{
+		log:              log,
+		balances:         make(map[int]Money),
+		transactionState: make(map[int]int),
+		commitOrder:      make(map[int]int),
+		rule:             BalanceRule{},
+		outgoing:         make(map[int][]Transaction),
+	}
+	for id, balance := range balances {
+		ledger.balances[id] = balance
+	}
+	ledger.funding_cond = sync.NewCond(&ledger.funding_mutex)
+	return ledger, err
+}
+
+// Register commits a transaction, or fails it with ErrMoneyOverflow when
+// either balance would overflow
+func (ledger *Ledger) Register(transaction Transaction) error {
+	// accounts blocked on their funds are woken up once the transfer is logged
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	defer ledger.funding_cond.Broadcast()
+	return ledger.register(transaction)
+}
+
+func (ledger *Ledger) register(transaction Transaction) error {
+	// checked arithmetic: a transfer that would overflow either balance fails
+	// instead of wrapping around
+	from, to, amount := transaction.moves()
+	fromBalance, fromErr := ledger.balances[from].Sub(amount)
+	toBalance, toErr := ledger.balances[to].Add(amount)
+	if from != to && (fromErr != nil || toErr != nil) {
+		ledger.fail(transaction.ID)
+		return ErrMoneyOverflow
+	}
+
+	ledger.wal.append("commit", transaction.ID)
+	ledger.transactionsDone++
+	ledger.transactionState[transaction.ID] = committed
+	ledger.commitOrder[transaction.ID] = len(ledger.commitOrder)
+	if from != to {
+		ledger.balances[from] = fromBalance
+		ledger.balances[to] = toBalance
+	}
+
+	if ledger.log != nil {
+		fmt.Fprintln(ledger.log, describeMove(transaction))
+	}
+	return nil
+}
+
+// Close closes the log file and the write-ahead log
+func (ledger *Ledger) Close() error {
+	err := ledger.wal.close()
+	if ledger.log == nil {
+		return err
+	}
+	if logErr := ledger.log.Close(); logErr != nil {
+		return logErr
+	}
+	return err
+}
+
+func (ledger *Ledger) MarkFailed(id int) {
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	ledger.fail(id)
+	ledger.funding_cond.Broadcast()
+}
+
+func (ledger *Ledger) fail(id int) {
+	ledger.wal.append("failure", id)
+	ledger.transactionsDone++
+	ledger.transactionState[id] = failed
+}
+
+// replay applies the outcome of a transaction run by another process, unless
+// it is already known, and reports whether it was applied; a committed
+// transaction that would overflow a balance fails with ErrMoneyOverflow
+func (ledger *Ledger) replay(transaction Transaction, state int) (bool, error) {
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	if ledger.transactionState[transaction.ID] != pending {
+		return false, nil
+	}
+	defer ledger.funding_cond.Broadcast()
+	if state == committed {
+		return true, ledger.register(transaction)
+	}
+	ledger.fail(transaction.ID)
+	return true, nil
+}
+
+func (ledger *Ledger) abandon(id int, seen int) bool {
+	// fail a pending transaction, but only if no transaction was done after the
+	// first seen ones: the watchdog's view of the run still holds
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	if ledger.transactionsDone != seen || ledger.transactionState[id] != pending {
+		return false
+	}
+	ledger.wal.append("failure", id)
+	ledger.transactionsDone++
+	ledger.transactionState[id] = failed
+	ledger.funding_cond.Broadcast()
+	return true
+}
+
+func (ledger *Ledger) dependencyState(transaction Transaction) int {
+	// committed when every dependency is committed, failed when one of them
+	// failed and pending otherwise
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	state := committed
+	for _, id := range transaction.After {
+		switch ledger.transactionState[id] {
+		case failed:
+			return failed
+		case pending:
+			state = pending
+		}
+	}
+	return state
+}
+
+func (ledger *Ledger) state(id int) int {
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	return ledger.transactionState[id]
+}
+
+func (ledger *Ledger) outcomes() ([]int, []int) {
+	// the committed transactions in commit order and the failed ones
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	committedIDs := make([]int, len(ledger.commitOrder))
+	for id, position := range ledger.commitOrder {
+		committedIDs[position] = id
+	}
+	failedIDs := make([]int, 0)
+	for id, state := range ledger.transactionState {
+		if state == failed {
+			failedIDs = append(failedIDs, id)
+		}
+	}
+	sort.Ints(failedIDs)
+	return committedIDs, failedIDs
+}
+
+func (ledger *Ledger) commitPosition(id int) (int, bool) {
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	position, ok := ledger.commitOrder[id]
+	return position, ok
+}
+
+func (ledger *Ledger) HasFunds(id int, money Money) bool {
+	// check the balance outside the CS; other accounts can only add money, so
+	// a positive answer still holds once the CS is granted
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	return ledger.balances[id] >= money
+}
+
+// UseFundsRule sets the rule deciding whether an account has the money for
+// a transaction, and the transactions the pending money of an account is
+// taken from
+func (ledger *Ledger) UseFundsRule(rule FundsRule, transactions []Transaction) {
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	ledger.rule = rule
+	ledger.outgoing = make(map[int][]Transaction)
+	for _, transaction := range transactions {
+		if transaction.From != Bank && transaction.Needs() > 0 {
+			ledger.outgoing[transaction.From] = append(ledger.outgoing[transaction.From], transaction)
+		}
+	}
+}
+
+// CanFund reports whether the account running the transaction has the money
+// for it under the funds rule; like HasFunds, a positive answer still holds
+// once the CS is granted
+func (ledger *Ledger) CanFund(transaction Transaction) bool {
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	return ledger.covers(transaction)
+}
+
+func (ledger *Ledger) covers(transaction Transaction) bool {
+	funds := Funds{Balance: ledger.balances[transaction.From]}
+	for _, earlier := range ledger.outgoing[transaction.From] {
+		if earlier.ID < transaction.ID && ledger.transactionState[earlier.ID] == pending {
+			funds.Pending += earlier.Needs()
+		}
+	}
+	return ledger.rule.Covers(funds, transaction)
+}
+
+func (ledger *Ledger) done() int {
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	return ledger.transactionsDone
+}
+
+func (ledger *Ledger) waitForTransactionDone(seen int) {
+	// block until a transaction is committed or fails after the first seen ones
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	for ledger.transactionsDone == seen {
+		ledger.funding_cond.Wait()
+	}
+}
+
+func (ledger *Ledger) WaitForFunds(id int, money Money) {
+	// block until the account holds at least the given amount
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	for ledger.balances[id] < money {
+		ledger.funding_cond.Wait()
+	}
+}
+
+func (ledger *Ledger) waitToFund(transaction Transaction) {
+	// block until the sender can fund the transaction or the transaction
+	// failed meanwhile
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	for !ledger.covers(transaction) && ledger.transactionState[transaction.ID] == pending {
+		ledger.funding_cond.Wait()
+	}
+}
+
+func (ledger *Ledger) Balance(id int) Money {
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	return ledger.balances[id]
+}
@@ -0,0 +1,59 @@
+package bank
+
+import (
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFundingOverflowFails(t *testing.T) {
+	// the bank funding an account already at the top of the balance range
+	// fails the transaction instead of wrapping the balance around
+	folder := fstest.MapFS{
+		"rich/transactions.txt": {Data: []byte("2,3\n-1,1,0,0\n-1,1,1,0\n1,1,0,0\n")},
+		"rich/quorum.txt":       {Data: []byte("0,1\n0,1\n")},
+		"rich/balances.txt":     {Data: []byte("0,92233720368547758.07\n1,0\n")},
+	}
+	config := DefaultConfig()
+	config.Storage = NewMemoryStorage(folder)
+	config.Output = io.Discard
+	scenario, err := LoadScenario(config.Storage, "rich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := NewSimulation(config, scenario)
+	metrics := run.Run()
+
+	if metrics.Failures["overflow"] != 2 {
+		t.Fatalf("%d transactions failed with an overflow, expected 2", metrics.Failures["overflow"])
+	}
+	outcome := run.Outcome()
+	if outcome.Balances[0] != math.MaxInt64 || outcome.Balances[1] != MinorUnits {
+		t.Fatalf("final balances %v", outcome.Balances)
+	}
+}
+
+func TestReplayOverflowFails(t *testing.T) {
+	// a transfer committed by another process that would overflow here fails,
+	// leaving both balances as they were
+	ledger, err := NewLedger(nil, "", map[int]Money{0: math.MaxInt64, 1: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := Transaction{From: 1, Amount: 5, To: 0, ID: 3}
+	applied, err := ledger.replay(transfer, committed)
+	if !applied || !errors.Is(err, ErrMoneyOverflow) {
+		t.Fatalf("replay returned %v, %v, expected an overflow", applied, err)
+	}
+	if ledger.Balance(0) != math.MaxInt64 || ledger.Balance(1) != 10 {
+		t.Fatalf("balances %s and %s after the overflow", ledger.Balance(0), ledger.Balance(1))
+	}
+	if ledger.state(transfer.ID) != failed || ledger.done() != 1 {
+		t.Fatal("the transaction wasn't marked failed")
+	}
+	if applied, _ := ledger.replay(transfer, committed); applied {
+		t.Fatal("the failed transaction was replayed again")
+	}
+}
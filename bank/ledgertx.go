@@ -0,0 +1,170 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// LedgerTx groups postings that are applied to the balances together or not
+// at all, e.g. a transfer with its fee, a currency exchange through a desk
+// account or an escrow release. Nothing is visible to the accounts, the log or
+// the reports before Commit, which applies every posting under the ledger's
+// lock while no account of the simulation is in the CS. The postings must
+// balance, so the money in the bank stays the same, and the accounts debited
+// must have the money under the funds rule, as for a transfer of their own.
+// A LedgerTx is used by one goroutine.
+type LedgerTx struct {
+	ledger   *Ledger
+	postings []Posting
+	closed   bool
+}
+
+// Posting is one change to a balance, positive for a credit
+type Posting struct {
+	Account int   `json:"account"`
+	Amount  Money `json:"amount"`
+}
+
+var (
+	ErrTxClosed          = errors.New("the ledger transaction was committed or aborted")
+	ErrNegativePosting   = errors.New("debits and credits take a positive amount")
+	ErrUnbalanced        = errors.New("the postings don't balance")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+// Begin starts a ledger transaction
+func (ledger *Ledger) Begin() *LedgerTx {
+	return &LedgerTx{ledger: ledger}
+}
+
+// Debit takes the amount from the account when the transaction commits
+func (tx *LedgerTx) Debit(account int, amount Money) error {
+	return tx.post(account, -amount, amount)
+}
+
+// Credit gives the amount to the account when the transaction commits
+func (tx *LedgerTx) Credit(account int, amount Money) error {
+	return tx.post(account, amount, amount)
+}
+
+func (tx *LedgerTx) post(account int, change Money, amount Money) error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	if amount < 0 {
+		return ErrNegativePosting
+	}
+	tx.postings = append(tx.postings, Posting{Account: account, Amount: change})
+	return nil
+}
+
+// Postings returns the postings of the transaction so far
+func (tx *LedgerTx) Postings() []Posting {
+	return append([]Posting(nil), tx.postings...)
+}
+
+// Commit applies every posting, or none of them when they don't balance,
+// overflow a balance or overdraw an account; the transaction is closed either
+// way
+func (tx *LedgerTx) Commit() error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	tx.closed = true
+	ledger := tx.ledger
+	if ledger.cs != nil {
+		// an account in the CS has checked its funds for a transfer that
+		// isn't in the ledger yet
+		ledger.cs.Lock()
+		defer ledger.cs.Unlock()
+	}
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	if err := ledger.check(tx.postings); err != nil {
+		return err
+	}
+	ledger.wal.appendPostings(tx.postings)
+	ledger.post(tx.postings)
+	ledger.funding_cond.Broadcast()
+	return nil
+}
+
+// Abort drops the postings
+func (tx *LedgerTx) Abort() {
+	tx.closed = true
+	tx.postings = nil
+}
+
+func (ledger *Ledger) check(postings []Posting) error {
+	// whether the postings can be applied; the caller holds funding_mutex
+	var total Money
+	balances := make(map[int]Money)
+	for _, posting := range postings {
+		var err error
+		if total, err = total.Add(posting.Amount); err != nil {
+			return err
+		}
+		balance, ok := balances[posting.Account]
+		if !ok {
+			balance = ledger.balances[posting.Account]
+		}
+		if balances[posting.Account], err = balance.Add(posting.Amount); err != nil {
+			return err
+		}
+	}
+	if total != 0 {
+		return fmt.Errorf("%w: %s left over", ErrUnbalanced, total)
+	}
+	for account, balance := range balances {
+		// the net debit of each account is funded like a transfer of its own
+		// made after its pending transactions
+		debit := ledger.balances[account] - balance
+		if account == Bank || debit <= 0 {
+			continue
+		}
+		transfer := Transaction{Op: Transfer, From: account, Amount: debit, To: Bank, ID: math.MaxInt}
+		if !ledger.covers(transfer) {
+			return fmt.Errorf("%w: participant %d would have %s", ErrInsufficientFunds, account, balance)
+		}
+	}
+	return nil
+}
+
+func (ledger *Ledger) post(postings []Posting) {
+	// apply checked postings; the caller holds funding_mutex
+	for _, posting := range postings {
+		ledger.balances[posting.Account] += posting.Amount
+	}
+	if ledger.log != nil {
+		for _, posting := range postings {
+			if posting.Amount < 0 {
+				fmt.Fprintf(ledger.log, "Participant %d is debited %s.\n", posting.Account, -posting.Amount)
+			} else {
+				fmt.Fprintf(ledger.log, "Participant %d is credited %s.\n", posting.Account, posting.Amount)
+			}
+		}
+	}
+}
+
+func (ledger *Ledger) replayPostings(postings []Posting) error {
+	// apply a ledger transaction of the run we resume, logged already
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	if err := ledger.check(postings); err != nil {
+		return err
+	}
+	ledger.post(postings)
+	return nil
+}
+
+// Balances returns the balance of every account at one point in time
+func (ledger *Ledger) Balances() map[int]Money {
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	balances := make(map[int]Money, len(ledger.balances))
+	for id, balance := range ledger.balances {
+		balances[id] = balance
+	}
+	return balances
+}
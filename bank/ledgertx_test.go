@@ -0,0 +1,155 @@
+package bank
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLedgerTxCommit(t *testing.T) {
+	// a transfer with its fee is applied at once, and the transaction can't be
+	// used again
+	ledger, _ := NewLedger(nil, "", map[int]Money{0: 0, 1: 10000, 2: 0})
+	tx := ledger.Begin()
+	for _, err := range []error{tx.Debit(1, 10000), tx.Credit(2, 9950), tx.Credit(0, 50)} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ledger.Balance(1) != 10000 {
+		t.Fatal("a posting was applied before the commit")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int]Money{0: 50, 1: 0, 2: 9950}
+	if balances := ledger.Balances(); !reflect.DeepEqual(balances, expected) {
+		t.Fatalf("balances %v, expected %v", balances, expected)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrTxClosed) {
+		t.Fatalf("second commit returned %v", err)
+	}
+	if err := tx.Credit(0, 1); !errors.Is(err, ErrTxClosed) {
+		t.Fatalf("credit after the commit returned %v", err)
+	}
+}
+
+func TestLedgerTxAbort(t *testing.T) {
+	ledger, _ := NewLedger(nil, "", map[int]Money{0: 100, 1: 0})
+	tx := ledger.Begin()
+	tx.Debit(0, 100)
+	tx.Credit(1, 100)
+	tx.Abort()
+	if len(tx.Postings()) != 0 {
+		t.Fatal("the postings were kept after the abort")
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrTxClosed) {
+		t.Fatalf("commit after the abort returned %v", err)
+	}
+	if ledger.Balance(0) != 100 || ledger.Balance(1) != 0 {
+		t.Fatal("the aborted postings were applied")
+	}
+}
+
+func TestLedgerTxRejected(t *testing.T) {
+	// a failed commit applies none of the postings, not even those that were
+	// fine on their own
+	tests := []struct {
+		name     string
+		rule     FundsRule
+		postings []Posting
+		err      error
+	}{
+		{"unbalanced", nil, []Posting{{0, -100}, {1, 90}}, ErrUnbalanced},
+		{"overdrawn", nil, []Posting{{0, -100}, {1, -150}, {2, 250}}, ErrInsufficientFunds},
+		{"overdrawn through several postings", nil, []Posting{{1, -60}, {2, 60}, {1, -60}, {2, 60}}, ErrInsufficientFunds},
+		{"past the credit line", CreditLineRule{Limit: 20}, []Posting{{1, -125}, {0, 125}}, ErrInsufficientFunds},
+		{"money of a pending transaction", PendingRule{}, []Posting{{0, -50}, {1, 50}}, ErrInsufficientFunds},
+		{"overflow", nil, []Posting{{Bank, -math.MaxInt64}, {2, math.MaxInt64}}, ErrMoneyOverflow},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opening := map[int]Money{Bank: 0, 0: 100, 1: 100, 2: 1}
+			ledger, _ := NewLedger(nil, "", opening)
+			if test.rule != nil {
+				// account 0 still has to pay 60
+				ledger.UseFundsRule(test.rule, []Transaction{{Op: Transfer, From: 0, Amount: 60, To: 1, ID: 1}})
+			}
+			tx := ledger.Begin()
+			for _, posting := range test.postings {
+				if posting.Amount < 0 {
+					tx.Debit(posting.Account, -posting.Amount)
+				} else {
+					tx.Credit(posting.Account, posting.Amount)
+				}
+			}
+			if err := tx.Commit(); !errors.Is(err, test.err) {
+				t.Fatalf("commit returned %v, expected %v", err, test.err)
+			}
+			if balances := ledger.Balances(); !reflect.DeepEqual(balances, opening) {
+				t.Fatalf("balances %v after the failed commit", balances)
+			}
+		})
+	}
+}
+
+func TestLedgerTxFundsRule(t *testing.T) {
+	// the credit line funds a debit the balance alone doesn't, as it would a
+	// transfer, and the bank may go below zero
+	ledger, _ := NewLedger(nil, "", map[int]Money{0: 100, 1: 0})
+	ledger.UseFundsRule(CreditLineRule{Limit: 50}, nil)
+	tx := ledger.Begin()
+	tx.Debit(0, 150)
+	tx.Debit(Bank, 10)
+	tx.Credit(1, 160)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if ledger.Balance(0) != -50 || ledger.Balance(Bank) != -10 {
+		t.Fatalf("balances %v", ledger.Balances())
+	}
+	if err := ledger.Begin().Debit(0, -1); !errors.Is(err, ErrNegativePosting) {
+		t.Fatalf("negative debit returned %v", err)
+	}
+}
+
+func TestLedgerTxWaitsForCS(t *testing.T) {
+	// an account in the CS holds the gate from its funds check to its commit:
+	// a ledger transaction taking its money waits until it is out
+	folder := fstest.MapFS{
+		"pair/transactions.txt": {Data: []byte("2,1\n0,1,1,0\n")},
+		"pair/quorum.txt":       {Data: []byte("0,1\n0,1\n")},
+		"pair/balances.txt":     {Data: []byte("0,1\n1,0\n")},
+	}
+	config := DefaultConfig()
+	config.Storage = NewMemoryStorage(folder)
+	scenario, err := LoadScenario(config.Storage, "pair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := NewSimulation(config, scenario)
+
+	run.gate.RLock()
+	committed := make(chan error)
+	go func() {
+		tx := run.Ledger().Begin()
+		tx.Debit(0, 100)
+		tx.Credit(1, 100)
+		committed <- tx.Commit()
+	}()
+	select {
+	case <-committed:
+		t.Fatal("the ledger transaction committed while an account was in the CS")
+	case <-time.After(50 * time.Millisecond):
+	}
+	run.gate.RUnlock()
+	if err := <-committed; err != nil {
+		t.Fatal(err)
+	}
+	if run.Ledger().Balance(1) != 100 {
+		t.Fatalf("balance %s after the commit", run.Ledger().Balance(1))
+	}
+}
@@ -0,0 +1,50 @@
+package bank
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// limitInterval is how often the message and memory limits are checked
+const limitInterval = 50 * time.Millisecond
+
+func (run *Simulation) limits(done <-chan struct{}) {
+	// abort the run once it sent more protocol messages than
+	// Config.MaxMessages or its heap grew past Config.MaxMemory
+	ticker := run.clock.NewTicker(limitInterval)
+	defer ticker.Stop()
+	var memory runtime.MemStats
+	for {
+		select {
+		case <-ticker.C():
+		case <-done:
+			return
+		}
+		if limit := run.config.MaxMessages; limit > 0 {
+			if sent := totalMessages(run.network.Counters()); sent > limit {
+				run.abort(fmt.Sprintf("%d messages sent, over the limit of %d", sent, limit))
+			}
+		}
+		if limit := run.config.MaxMemory; limit > 0 {
+			runtime.ReadMemStats(&memory)
+			if memory.HeapAlloc > limit {
+				run.abort(fmt.Sprintf("%.1f MB of heap in use, over the limit of %.1f MB", float64(memory.HeapAlloc)/(1<<20), float64(limit)/(1<<20)))
+			}
+		}
+	}
+}
+
+func (run *Simulation) abort(reason string) {
+	// end a runaway run, handing what it did so far to Config.OnAbort
+	fmt.Fprintln(run.config.Output, "Run aborted:", reason)
+	if run.config.OnAbort != nil {
+		run.duration = run.clock.Since(run.start).Milliseconds()
+		metrics := run.metrics()
+		metrics.Aborted = reason
+		run.config.OnAbort(metrics)
+	}
+	run.ledger.Close()
+	os.Exit(2)
+}
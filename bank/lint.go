@@ -0,0 +1,121 @@
+package bank
+
+import (
+	"fmt"
+	"time"
+)
+
+// Checks of Lint
+const (
+	LintUnknownAccount = "unknown-account" // a transaction or quorum names an account that doesn't exist
+	LintUnfunded       = "unfunded"        // an account spends but never receives any money
+	LintOverspent      = "overspent"       // an account spends more than it can ever hold
+	LintQuorums        = "quorums"         // two quorums don't intersect
+	LintPause          = "pause"           // a transaction pauses its account for longer than the limit
+)
+
+// LintFinding is a problem of a scenario found without running it
+type LintFinding struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func (finding LintFinding) String() string {
+	return fmt.Sprintf("%s: %s", finding.Check, finding.Message)
+}
+
+// LintFolder reads a test folder like LoadScenario, but reports quorums
+// that don't intersect as findings instead of failing, and lints it
+func LintFolder(storage Storage, folder_name string, maxPause time.Duration) ([]LintFinding, error) {
+	scenario, err := readScenario(storage, folder_name)
+	if err != nil {
+		return nil, err
+	}
+	return Lint(scenario, maxPause), nil
+}
+
+// Lint statically checks a scenario for the mistakes that would otherwise
+// show up late in a run: transactions and quorums naming unknown accounts,
+// quorums without intersection, accounts whose spending can never be funded
+// from their opening balance and incoming money, and pauses over maxPause (0
+// doesn't check them). Transactions that fail on loading are left out.
+func Lint(scenario *Scenario, maxPause time.Duration) []LintFinding {
+	findings := make([]LintFinding, 0)
+	report := func(check string, format string, args ...any) {
+		findings = append(findings, LintFinding{Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+	known := func(id int) bool {
+		return id >= 0 && id < scenario.Accounts
+	}
+
+	spends := make(map[int]Money)
+	spent := make(map[int]int)
+	receives := make(map[int]Money)
+	for _, transaction := range scenario.Transactions {
+		if transaction.failure != "" {
+			continue
+		}
+		if !known(transaction.From) && transaction.From != Bank {
+			report(LintUnknownAccount, "transaction %d is run by participant %d, out of %d accounts", transaction.ID, transaction.From, scenario.Accounts)
+			continue
+		}
+		if !known(transaction.To) && transaction.To != Bank {
+			report(LintUnknownAccount, "transaction %d pays participant %d, out of %d accounts", transaction.ID, transaction.To, scenario.Accounts)
+			continue
+		}
+		if maxPause > 0 && time.Duration(transaction.Pause)*time.Millisecond > maxPause {
+			report(LintPause, "transaction %d pauses participant %d for %d ms, over %s", transaction.ID, transaction.From, transaction.Pause, maxPause)
+		}
+		from, to, amount := transaction.moves()
+		if from == to || amount <= 0 {
+			continue
+		}
+		if from != Bank {
+			spends[from] += amount
+			spent[from]++
+		}
+		if to != Bank {
+			receives[to] += amount
+		}
+	}
+	for id := 0; id < scenario.Accounts; id++ {
+		if spent[id] == 0 {
+			continue
+		}
+		holds := scenario.Balances[id] + receives[id]
+		if holds <= 0 {
+			report(LintUnfunded, "participant %d spends %s over %d transactions but never receives any money", id, spends[id], spent[id])
+		} else if spends[id] > holds {
+			report(LintOverspent, "participant %d spends %s but holds at most %s", id, spends[id], holds)
+		}
+	}
+
+	for i, quorum := range scenario.Quorums {
+		for _, id := range quorum {
+			if !known(id) {
+				report(LintUnknownAccount, "the quorum of participant %d names participant %d, out of %d accounts", i, id, scenario.Accounts)
+			}
+		}
+	}
+	for i := range scenario.Quorums {
+		members := make(map[int]bool)
+		for _, id := range scenario.Quorums[i] {
+			members[id] = true
+		}
+		for j := i + 1; j < len(scenario.Quorums); j++ {
+			if !intersect(members, scenario.Quorums[j]) {
+				report(LintQuorums, "the quorums of participants %d and %d don't intersect, so both could enter the CS at the same time", i, j)
+			}
+		}
+	}
+	return findings
+}
+
+func intersect(members map[int]bool, quorum []int) bool {
+	for _, id := range quorum {
+		if members[id] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package bank
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LiveMetrics counts the events of a run as they happen and serves them in
+// the Prometheus text format, so a long run can be watched before its metrics
+// JSON is written. Add it to Config.Sinks and attach it to the simulation for
+// the gauges read from the accounts.
+type LiveMetrics struct {
+	mutex  sync.Mutex
+	counts map[string]map[int]int64 // by event kind, then account
+	run    atomic.Pointer[Simulation]
+}
+
+// the counters of LiveMetrics: the event they count, by its account, and
+// their help text
+var liveCounters = []struct {
+	name string
+	kind string
+	help string
+}{
+	{"banksim_requests_sent_total", "request", "CS requests sent, by requesting account."},
+	{"banksim_approvals_sent_total", "approve", "Approvals sent, by approving account."},
+	{"banksim_revokes_total", "revoke", "Permissions revoked, by revoking account."},
+	{"banksim_given_back_total", "yield", "Permissions given back, by account giving them back."},
+	{"banksim_token_passes_total", "token", "Token passes, by account passing the token."},
+	{"banksim_cs_entries_total", "enter", "CS entries, by account."},
+	{"banksim_transactions_committed_total", "transfer", "Committed transfers, by sending account (-1 is the bank)."},
+	{"banksim_transactions_failed_total", "failure", "Failed transactions, by sending account."},
+}
+
+func NewLiveMetrics() *LiveMetrics {
+	return &LiveMetrics{counts: make(map[string]map[int]int64)}
+}
+
+// Attach gives the gauges the run to read from
+func (live *LiveMetrics) Attach(run *Simulation) {
+	live.run.Store(run)
+}
+
+func (live *LiveMetrics) Emit(event Event) {
+	live.mutex.Lock()
+	defer live.mutex.Unlock()
+	byAccount, ok := live.counts[event.Kind]
+	if !ok {
+		byAccount = make(map[int]int64)
+		live.counts[event.Kind] = byAccount
+	}
+	byAccount[event.Account]++
+}
+
+// ServeHTTP writes the counters and gauges in the Prometheus text format
+func (live *LiveMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	live.WriteTo(w)
+}
+
+func (live *LiveMetrics) WriteTo(w io.Writer) (int64, error) {
+	var out strings.Builder
+	live.mutex.Lock()
+	for _, counter := range liveCounters {
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		writeByAccount(&out, counter.name, live.counts[counter.kind])
+	}
+	live.mutex.Unlock()
+
+	if run := live.run.Load(); run != nil {
+		done, total := run.progress()
+		fmt.Fprintf(&out, "# HELP banksim_transactions_done Transactions committed or failed so far.\n# TYPE banksim_transactions_done gauge\nbanksim_transactions_done %d\n", done)
+		fmt.Fprintf(&out, "# HELP banksim_transactions Transactions of the run.\n# TYPE banksim_transactions gauge\nbanksim_transactions %d\n", total)
+
+		deferred := make(map[int]int64)
+		requesting := make(map[int]int64)
+		for _, state := range run.network.Diagnose() {
+			if !state.Local || state.Left {
+				continue
+			}
+			deferred[state.ID] = int64(len(state.Deferred))
+			requesting[state.ID] = 0
+			if state.RequestCS {
+				requesting[state.ID] = 1
+			}
+		}
+		fmt.Fprintf(&out, "# HELP banksim_deferred_requests Requests waiting for the account to release the CS.\n# TYPE banksim_deferred_requests gauge\n")
+		writeByAccount(&out, "banksim_deferred_requests", deferred)
+		fmt.Fprintf(&out, "# HELP banksim_requesting_cs Whether the account asks for or holds the CS (permission-based algorithms).\n# TYPE banksim_requesting_cs gauge\n")
+		writeByAccount(&out, "banksim_requesting_cs", requesting)
+	}
+	n, err := io.WriteString(w, out.String())
+	return int64(n), err
+}
+
+func writeByAccount(out *strings.Builder, name string, values map[int]int64) {
+	ids := make([]int, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		fmt.Fprintf(out, "%s{account=\"%d\"} %d\n", name, id, values[id])
+	}
+}
+
+func (run *Simulation) progress() (int, int) {
+	// the transactions committed or failed so far, out of those of the
+	// scenario
+	return run.ledger.done(), len(run.scenario.Transactions)
+}
+
+func (run *Simulation) reportProgress(interval time.Duration, done <-chan struct{}) {
+	// print a line on how far the run got every interval
+	ticker := run.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+		case <-done:
+			return
+		}
+		finished, total := run.progress()
+		percent := 0.0
+		if total > 0 {
+			percent = 100 * float64(finished) / float64(total)
+		}
+		elapsed := run.clock.Since(run.start)
+		counters := run.network.Counters()
+		asking, deferred := 0, 0
+		for _, state := range run.network.Diagnose() {
+			if state.RequestCS {
+				asking++
+			}
+			deferred += len(state.Deferred)
+		}
+		fmt.Fprintf(run.config.Output, "Progress: %d/%d transactions done (%.0f%%) in %s, %.1f commits/s, %d requests, %d approvals, %d accounts asking for the CS, %d requests deferred\n",
+			finished, total, percent, elapsed.Round(time.Second), float64(atomic.LoadInt64(&run.commits))/elapsed.Seconds(),
+			counters.Requests, counters.Approvals, asking, deferred)
+	}
+}
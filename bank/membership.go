@@ -0,0 +1,159 @@
+package bank
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// AccountJoins adds an account to the network, AccountLeaves takes one out
+	AccountJoins  = "join"
+	AccountLeaves = "leave"
+)
+
+// MembershipChange is an account joining or leaving the network once a number
+// of transactions were committed, as listed in membership.txt
+type MembershipChange struct {
+	Kind    string `json:"kind"`
+	Account int    `json:"account"`
+	After   int    `json:"after"`
+}
+
+func readMembership(storage Storage, folder_name string, n_accounts int) ([]MembershipChange, error) {
+	// Read the optional membership changes from membership.txt, one
+	// "join|leave,id,after" line per change. The accounts joining have the
+	// highest ids and join in the order of their ids; the others are in the
+	// network from the start.
+	file, err := storage.Open(folder_name + "/membership.txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	changes := make([]MembershipChange, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) != 3 || (parts[0] != AccountJoins && parts[0] != AccountLeaves) {
+			return nil, fmt.Errorf("%s/membership.txt: invalid change %q", folder_name, line)
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil || id < 0 || id >= n_accounts {
+			return nil, fmt.Errorf("%s/membership.txt: invalid account %q", folder_name, parts[1])
+		}
+		after, err := strconv.Atoi(parts[2])
+		if err != nil || after < 0 {
+			return nil, fmt.Errorf("%s/membership.txt: invalid transaction count %q", folder_name, parts[2])
+		}
+		changes = append(changes, MembershipChange{Kind: parts[0], Account: id, After: after})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].After < changes[j].After
+	})
+
+	joins := 0
+	for _, change := range changes {
+		if change.Kind == AccountJoins {
+			joins++
+		}
+	}
+	next := n_accounts - joins // the id the next account joining gets
+	joined := make(map[int]bool)
+	left := make(map[int]bool)
+	for _, change := range changes {
+		switch {
+		case change.Kind == AccountJoins && change.Account != next:
+			return nil, fmt.Errorf("%s/membership.txt: account %d joins before account %d", folder_name, change.Account, next)
+		case change.Kind == AccountJoins:
+			joined[change.Account] = true
+			next++
+		case left[change.Account]:
+			return nil, fmt.Errorf("%s/membership.txt: account %d leaves twice", folder_name, change.Account)
+		case change.Account >= n_accounts-joins && !joined[change.Account]:
+			return nil, fmt.Errorf("%s/membership.txt: account %d leaves before it joins", folder_name, change.Account)
+		default:
+			left[change.Account] = true
+		}
+	}
+	return changes, nil
+}
+
+// Present returns the number of accounts in the network from the start
+func (scenario *Scenario) Present() int {
+	present := scenario.Accounts
+	for _, change := range scenario.Membership {
+		if change.Kind == AccountJoins {
+			present--
+		}
+	}
+	return present
+}
+
+func (run *Simulation) awaitJoin(id int, wg *sync.WaitGroup) {
+	// run the transactions of an account once it joined the network
+	<-run.joined[id]
+	if id >= run.network.Len() {
+		// it couldn't join
+		wg.Done()
+		return
+	}
+	run.processTransaction(run.network.Account(id), wg)
+}
+
+func (run *Simulation) changeMembership(count int) {
+	// apply the membership changes due after count committed transactions,
+	// draining the CS first like a switch of algorithms
+	defer run.switching.Done()
+	run.gate.Lock()
+	defer run.gate.Unlock()
+	for run.membership < len(run.scenario.Membership) && run.scenario.Membership[run.membership].After <= count {
+		change := run.scenario.Membership[run.membership]
+		run.membership++
+		if change.Kind == AccountJoins {
+			id, err := run.network.Join()
+			close(run.joined[change.Account])
+			if err != nil {
+				fmt.Fprintln(run.config.Output, "Error adding participant", change.Account, err)
+				run.dropTransactions(change.Account, "participant never joined")
+				continue
+			}
+			fmt.Fprintf(run.config.Output, "Participant %d joined after %d transactions\n", id, change.After)
+		} else {
+			if err := run.network.Leave(change.Account); err != nil {
+				fmt.Fprintln(run.config.Output, "Error removing participant", change.Account, err)
+				continue
+			}
+			fmt.Fprintf(run.config.Output, "Participant %d left after %d transactions\n", change.Account, change.After)
+			run.dropTransactions(change.Account, "participant left")
+		}
+		run.applied = append(run.applied, change)
+		run.sampleMembership()
+		run.emit(Event{Kind: change.Kind, Account: change.Account, Peer: -1})
+	}
+}
+
+func (run *Simulation) flushMembership() {
+	// the accounts in the network are done: the changes still due apply now,
+	// so that the accounts joining later run their transactions too
+	if run.membership < len(run.scenario.Membership) {
+		run.switching.Add(1)
+		run.changeMembership(math.MaxInt)
+	}
+}
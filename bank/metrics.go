@@ -0,0 +1,353 @@
+package bank
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// Metrics structure for JSON output
+type Metrics struct {
+	Algorithm     string                 `json:"algorithm"`
+	Ordering      string                 `json:"ordering,omitempty"` // the delivery order of the transport
+	Accounts      int                    `json:"accounts"`
+	Transactions  int                    `json:"transactions"`
+	Requests      int64                  `json:"requests"`
+	Approvals     int64                  `json:"approvals"`
+	Delivered     int64                  `json:"approvalsDelivered"`
+	Acked         int64                  `json:"approvalsAcked"` // acknowledgements of the approvals received back, duplicates included
+	Revokes       int64                  `json:"revokes"`
+	GivenBack     int64                  `json:"givenBack"` // optimized: votes given back after a revocation
+	Duplicates    int64                  `json:"duplicatesSuppressed"`
+	TotalMessages int64                  `json:"totalMessages"`
+	Duration      int64                  `json:"durationMs"` // after the warm-up
+	Validation    ValidationReport       `json:"validation"`
+	Failures      map[string]int64       `json:"failures"`
+	FundingWaits  map[string]int64       `json:"fundingWaits"`
+	BreakerTrips  map[int]int64          `json:"breakerTrips,omitempty"` // by account: how often its circuit breaker paused it
+	OutOfOrder    int64                  `json:"outOfOrder"`             // transactions committed before an earlier one of the same account
+	Yielded       int64                  `json:"yieldedToUsers"`         // system transactions run after a later user transaction ready before them
+	Violations    int                    `json:"orderingViolations"`
+	Sites         int                    `json:"sites,omitempty"`       // hybrid mode only: participants of the distributed protocol
+	TokenPasses   int64                  `json:"tokenPasses"`           // token-based algorithms only: every hop of the token
+	IdlePasses    int64                  `json:"idleTokenPasses"`       // token-ring only: hops through accounts that didn't need the CS
+	Coalesced     int64                  `json:"coalesced"`             // transactions run without releasing the CS in between
+	CoalesceSaved int64                  `json:"coalesceMessagesSaved"` // request and approval messages not needed thanks to coalescing
+	CoalesceWait  int64                  `json:"coalesceAddedWaitUs"`   // time other accounts waited for coalesced transactions
+	Heartbeats    int64                  `json:"heartbeats"`
+	Retries       int64                  `json:"retries"`                      // requests sent again after a timeout
+	Resent        int64                  `json:"resent,omitempty"`             // messages sent again, unacknowledged after the request timeout
+	Prefetched    int64                  `json:"prefetchedRequests,omitempty"` // requests sent during a pause ahead of the next transaction
+	PrefetchLost  int64                  `json:"prefetchRevoked,omitempty"`    // prefetched approvals given back before the account entered
+	Parallelism   float64                `json:"csParallelism,omitempty"`      // resource mode only: CS time over the time the CS was in use
+	MaxInCS       int                    `json:"maxConcurrentCS,omitempty"`    // resource mode only: most accounts inside the CS at once
+	Failed        []int                  `json:"failedAccounts,omitempty"`     // accounts declared failed
+	Restored      int                    `json:"restored,omitempty"`           // transactions committed from a checkpoint
+	CSWait        LatencySummary         `json:"csWaitMs"`                     // time committed user transactions waited for the CS
+	Latency       LatencySummary         `json:"latencyMs"`                    // from an account starting on a user transaction to its commit
+	Lanes         map[string]LaneMetrics `json:"lanes,omitempty"`              // by lane, when the run has system transactions
+	Throughput    float64                `json:"csThroughputPerSec"`           // transactions committed in the CS per second
+	PerAccount    map[int]AccountLatency `json:"perAccount"`
+	Fairness      Fairness               `json:"fairness"`                     // CS entries and waits of every account, over the whole run
+	Costs         Costs                  `json:"costs"`                        // where the time of every account went, over the whole run
+	WarmUp        int64                  `json:"warmUpMs,omitempty"`           // left out of the duration, latencies and throughput
+	WarmUpCount   int                    `json:"warmUpTransactions,omitempty"` // transactions committed during the warm-up
+	Phases        []Phase                `json:"phases,omitempty"`             // hot swap only: before and after the switch
+	Membership    []MembershipChange     `json:"membership,omitempty"`         // accounts that joined or left mid-run
+	Archived      []ArchivedAccount      `json:"archived,omitempty"`           // accounts taken out of the network after their last transaction
+	Members       []MembershipSample     `json:"membershipSize,omitempty"`     // accounts in the network over time, with archival or membership changes
+	Seed          int64                  `json:"seed,omitempty"`               // shuffled the order the accounts started in
+	SlowAccounts  map[int]float64        `json:"slowAccountsMs,omitempty"`     // processing delay of the stragglers before they answer
+	Placement     []ProcessPlacement     `json:"placement,omitempty"`          // multi-process runs only: where each process ran
+	Shutdown      *ShutdownReport        `json:"shutdown,omitempty"`           // multi-process runs only: the shutdown barrier and the ledger agreement
+	Faults        *mutex.FaultCounts     `json:"faults,omitempty"`             // only when faults are injected into the protocol messages
+	Acceptance    *AcceptanceResult      `json:"acceptance,omitempty"`         // only when the scenario declares acceptance criteria
+	Chaos         []ChaosResult          `json:"chaos,omitempty"`              // only when the scenario declares chaos experiments
+	Safety        *SafetyReport          `json:"safety,omitempty"`             // only when the run is verified
+	Aborted       string                 `json:"aborted,omitempty"`            // why the run was aborted before the end, the metrics being partial
+}
+
+func (run *Simulation) metrics() Metrics {
+	counters := run.network.Counters()
+	warmUp, samples := run.warmUp()
+	csWait, latency, perAccount := latencyMetrics(laneSamples(samples, LaneUser))
+	duration := run.duration - warmUp.Milliseconds()
+	throughput := 0.0
+	if duration > 0 {
+		throughput = float64(len(samples)) * 1000 / float64(duration)
+	}
+	var slow map[int]float64
+	for account, delay := range run.config.SlowAccounts {
+		if slow == nil {
+			slow = make(map[int]float64)
+		}
+		slow[account] = milliseconds(delay)
+	}
+	run.latencies_mutex.Lock()
+	warmUpCount := len(run.latencies) - len(samples)
+	run.latencies_mutex.Unlock()
+	var parallelism float64
+	var maxInCS int
+	if run.config.Resources {
+		parallelism, maxInCS = run.parallelism.gain()
+	}
+	var faults *mutex.FaultCounts
+	if run.faults != nil {
+		counts := run.faults.Counts()
+		faults = &counts
+	}
+	fairness := run.fairness.report()
+	fairness.Boosts = counters.Boosts
+	for account, responders := range run.responders(warmUp) {
+		breakdown := perAccount[account]
+		breakdown.Responders = responders
+		perAccount[account] = breakdown
+	}
+	return Metrics{
+		Algorithm:     string(run.config.Algorithm),
+		Ordering:      string(run.config.Ordering),
+		Accounts:      run.scenario.Accounts,
+		Transactions:  len(run.transactions),
+		Requests:      counters.Requests,
+		Approvals:     counters.Approvals,
+		Delivered:     counters.Delivered,
+		Acked:         counters.Acked,
+		Revokes:       counters.Revokes,
+		GivenBack:     counters.GivenBack,
+		Duplicates:    counters.Duplicates,
+		TotalMessages: totalMessages(counters),
+		Sites:         run.network.Sites(),
+		TokenPasses:   counters.TokenPasses,
+		IdlePasses:    counters.IdleTokenPasses,
+		Duration:      duration,
+		Validation:    run.validation,
+		Failures:      copyCounts(run.failures, &run.failures_mutex),
+		FundingWaits:  copyCounts(run.fundingWaits, &run.fundingWaits_mutex),
+		BreakerTrips:  copyCounts(run.breakerTrips, &run.breaker_mutex),
+		OutOfOrder:    run.outOfOrder,
+		Yielded:       run.yielded,
+		Violations:    run.verifyOrdering(),
+		Coalesced:     run.coalesced,
+		CoalesceSaved: run.coalesceSaved,
+		CoalesceWait:  run.coalesceWait,
+		Heartbeats:    counters.Heartbeats,
+		Retries:       counters.Retries,
+		Resent:        counters.Resent,
+		Prefetched:    counters.Prefetched,
+		PrefetchLost:  counters.PrefetchRevoked,
+		Failed:        run.network.Failed(),
+		Restored:      run.restored,
+		Parallelism:   parallelism,
+		MaxInCS:       maxInCS,
+		CSWait:        csWait,
+		Lanes:         laneMetrics(samples),
+		Latency:       latency,
+		Throughput:    throughput,
+		PerAccount:    perAccount,
+		Fairness:      fairness,
+		Costs:         run.costs.report(),
+		WarmUp:        warmUp.Milliseconds(),
+		WarmUpCount:   warmUpCount,
+		Phases:        run.phases(),
+		Membership:    run.applied,
+		Archived:      run.archivedAccounts,
+		Members:       run.membershipSize,
+		Seed:          run.config.Seed,
+		SlowAccounts:  slow,
+		Placement:     run.placementReport(),
+		Shutdown:      run.shutdownReport,
+		Chaos:         run.chaosResults,
+		Faults:        faults,
+	}
+}
+
+// Write saves the metrics as JSON
+func (metrics Metrics) Write(storage Storage, name string) error {
+	data, err := json.MarshalIndent(metrics, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := storage.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Print writes a summary of the metrics to stdout
+func (metrics Metrics) Print() {
+	fmt.Printf("\nAlgorithm: %s\n", metrics.Algorithm)
+	if metrics.Aborted != "" {
+		fmt.Printf("Partial results, the run was aborted: %s\n", metrics.Aborted)
+	}
+	if metrics.Ordering != "" && metrics.Ordering != string(mutex.FIFO) {
+		fmt.Printf("Message ordering: %s\n", metrics.Ordering)
+	}
+	fmt.Printf("Number of accounts: %d\n", metrics.Accounts)
+	fmt.Printf("Number of transactions: %d\n", metrics.Transactions)
+	fmt.Printf("Request messages sent: %d\n", metrics.Requests)
+	fmt.Printf("Approval messages sent: %d\n", metrics.Approvals)
+	fmt.Printf("Approval messages delivered: %d\n", metrics.Delivered)
+	fmt.Printf("Approval messages acknowledged: %d\n", metrics.Acked)
+	fmt.Printf("Revoke messages sent: %d\n", metrics.Revokes)
+	if metrics.GivenBack > 0 {
+		fmt.Printf("Permissions given back: %d\n", metrics.GivenBack)
+	}
+	fmt.Printf("Duplicate messages suppressed: %d\n", metrics.Duplicates)
+	if metrics.TokenPasses > 0 {
+		fmt.Printf("Token passes: %d (idle: %d)\n", metrics.TokenPasses, metrics.IdlePasses)
+	}
+	fmt.Printf("Total messages: %d\n", metrics.TotalMessages)
+	fmt.Printf("Total duration: %d ms\n", metrics.Duration)
+	if len(metrics.SlowAccounts) > 0 {
+		slow := make([]int, 0, len(metrics.SlowAccounts))
+		for account := range metrics.SlowAccounts {
+			slow = append(slow, account)
+		}
+		sort.Ints(slow)
+		fmt.Print("Slow participants:")
+		for _, account := range slow {
+			fmt.Printf(" %d (+%.3f ms)", account, metrics.SlowAccounts[account])
+		}
+		fmt.Println()
+	}
+	if metrics.WarmUp > 0 || metrics.WarmUpCount > 0 {
+		fmt.Printf("Warm-up left out: %d ms, %d transactions\n", metrics.WarmUp, metrics.WarmUpCount)
+	}
+	validation := metrics.Validation
+	fmt.Printf("Self-transfers: %d, zero amounts: %d, negative amounts: %d (rejected: %d, ignored: %d)\n",
+		validation.SelfTransfers, validation.ZeroAmounts, validation.NegativeAmounts, validation.Rejected, validation.Ignored)
+	for _, reason := range sortedKeys(metrics.Failures) {
+		fmt.Printf("Failed transactions (%s): %d\n", reason, metrics.Failures[reason])
+	}
+	for _, strategy := range sortedKeys(metrics.FundingWaits) {
+		fmt.Printf("Funding waits (%s): %d\n", strategy, metrics.FundingWaits[strategy])
+	}
+	if len(metrics.BreakerTrips) > 0 {
+		fmt.Printf("Circuit breaker trips by participant: %v\n", metrics.BreakerTrips)
+	}
+	fmt.Printf("Transactions run out of order: %d\n", metrics.OutOfOrder)
+	fmt.Printf("Ordering constraint violations: %d\n", metrics.Violations)
+	if metrics.Prefetched > 0 {
+		fmt.Printf("Prefetched requests: %d (approvals given back before the entry: %d)\n", metrics.Prefetched, metrics.PrefetchLost)
+	}
+	if metrics.Coalesced > 0 {
+		fmt.Printf("Coalesced transactions: %d (messages saved: %d, added wait for others: %d us)\n", metrics.Coalesced, metrics.CoalesceSaved, metrics.CoalesceWait)
+	}
+	fmt.Printf("CS wait (ms): %s\n", metrics.CSWait)
+	fmt.Printf("Latency (ms): %s\n", metrics.Latency)
+	if system, ok := metrics.Lanes[LaneSystem]; ok {
+		fmt.Printf("The CS wait and latency are of the user lane; system lane: %s (yielded to users: %d)\n", system, metrics.Yielded)
+	}
+	fmt.Printf("CS throughput: %.2f transactions/s\n", metrics.Throughput)
+	accounts := make([]int, 0, len(metrics.PerAccount))
+	for account := range metrics.PerAccount {
+		accounts = append(accounts, account)
+	}
+	sort.Ints(accounts)
+	for _, account := range accounts {
+		if responders := metrics.PerAccount[account].Responders; len(responders) > 0 {
+			fmt.Printf("Slowest responder to participant %d: %s\n", account, responders[0])
+		}
+	}
+	fmt.Printf("Fairness: %s\n", metrics.Fairness)
+	fmt.Printf("Time of the accounts: %s\n", metrics.Costs.Total)
+	if overhead, ledger := metrics.Costs.Total.WaitCS+metrics.Costs.Total.HoldCS, metrics.Costs.Total.Ledger; overhead > ledger {
+		fmt.Printf("The mutual exclusion overhead (%.1f ms) dominates the ledger work (%.1f ms)\n", overhead, ledger)
+	} else if ledger > 0 {
+		fmt.Printf("The ledger work (%.1f ms) dominates the mutual exclusion overhead (%.1f ms)\n", ledger, overhead)
+	}
+	if metrics.Fairness.Boosts > 0 {
+		fmt.Printf("Requests boosted by aging: %d\n", metrics.Fairness.Boosts)
+	}
+	if metrics.Faults != nil {
+		fmt.Printf("Injected faults: %s\n", metrics.Faults)
+	}
+	if metrics.Heartbeats > 0 || metrics.Retries > 0 || metrics.Resent > 0 {
+		fmt.Printf("Heartbeats: %d, requests retried: %d, messages resent: %d\n", metrics.Heartbeats, metrics.Retries, metrics.Resent)
+	}
+	if metrics.MaxInCS > 0 {
+		fmt.Printf("CS parallelism: %.2f (at most %d participants inside at once)\n", metrics.Parallelism, metrics.MaxInCS)
+	}
+	if metrics.Restored > 0 {
+		fmt.Printf("Transactions restored from the checkpoint: %d\n", metrics.Restored)
+	}
+	for _, placement := range metrics.Placement {
+		fmt.Println("Placement:", placement)
+	}
+	if metrics.Shutdown != nil {
+		fmt.Println("Shutdown barrier:", metrics.Shutdown)
+	}
+	if len(metrics.Failed) > 0 {
+		fmt.Printf("Failed participants: %v\n", metrics.Failed)
+	}
+	for _, phase := range metrics.Phases {
+		fmt.Printf("Phase %s: %d transactions, %d messages, %d ms, %.2f transactions/s\n", phase.Algorithm, phase.Committed, phase.Messages, phase.Duration, phase.Throughput)
+		fmt.Printf("  CS wait (ms): %s\n", phase.CSWait)
+		fmt.Printf("  Latency (ms): %s\n", phase.Latency)
+	}
+	for _, change := range metrics.Membership {
+		verb := "joined"
+		if change.Kind == AccountLeaves {
+			verb = "left"
+		}
+		fmt.Printf("Participant %d %s after %d transactions\n", change.Account, verb, change.After)
+	}
+	if len(metrics.Archived) > 0 {
+		fmt.Printf("Archived participants: %d\n", len(metrics.Archived))
+	}
+	if len(metrics.Members) > 0 {
+		fmt.Println("Membership size over time:", describeMembershipSize(metrics.Members))
+	}
+	if metrics.Safety != nil {
+		fmt.Println("Safety:", metrics.Safety)
+	}
+	if metrics.Acceptance != nil {
+		if metrics.Acceptance.Passed {
+			fmt.Println("Acceptance: PASS")
+		}
+		for _, criterion := range metrics.Acceptance.Failed {
+			fmt.Println("Acceptance: FAIL,", criterion)
+		}
+	}
+	for _, result := range metrics.Chaos {
+		fmt.Println("Chaos experiment", result)
+	}
+}
+
+// ChaosPassed reports whether every chaos experiment of the run passed
+func (metrics Metrics) ChaosPassed() bool {
+	for _, result := range metrics.Chaos {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func copyCounts[K comparable](counts map[K]int64, mutex *sync.Mutex) map[K]int64 {
+	// a snapshot of counts the accounts may still be adding to
+	mutex.Lock()
+	defer mutex.Unlock()
+	snapshot := make(map[K]int64, len(counts))
+	for key, n := range counts {
+		snapshot[key] = n
+	}
+	return snapshot
+}
+
+func sortedKeys(counts map[string]int64) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,88 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in minor currency units (cents)
+type Money int64
+
+// MinorUnits is the number of minor units in one unit of currency
+const MinorUnits = 100
+
+var ErrMoneyOverflow = errors.New("amount overflows the balance range")
+
+func ParseMoney(text string) (Money, error) {
+	// parse an amount written in currency units with up to two decimals
+	// ("41", "41.5", "-0.05")
+	digits := strings.TrimPrefix(text, "-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if !isDigits(whole) || (fraction != "" && !isDigits(fraction)) || len(fraction) > 2 {
+		return 0, fmt.Errorf("invalid amount %q", text)
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, ErrMoneyOverflow
+		}
+		return 0, fmt.Errorf("invalid amount %q", text)
+	}
+	cents, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil || cents < 0 {
+		return 0, fmt.Errorf("invalid amount %q", text)
+	}
+	if units > (math.MaxInt64-cents)/MinorUnits {
+		return 0, ErrMoneyOverflow
+	}
+
+	money := Money(units*MinorUnits + cents)
+	if strings.HasPrefix(text, "-") {
+		money = -money
+	}
+	return money, nil
+}
+
+func isDigits(text string) bool {
+	// whether the text is a non-empty run of decimal digits, without a sign
+	for _, c := range text {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return text != ""
+}
+
+func (money Money) Add(other Money) (Money, error) {
+	// add with an overflow check
+	sum := money + other
+	if (other > 0 && sum < money) || (other < 0 && sum > money) {
+		return money, ErrMoneyOverflow
+	}
+	return sum, nil
+}
+
+func (money Money) Sub(other Money) (Money, error) {
+	// subtract with an overflow check
+	difference := money - other
+	if (other > 0 && difference > money) || (other < 0 && difference < money) {
+		return money, ErrMoneyOverflow
+	}
+	return difference, nil
+}
+
+func (money Money) String() string {
+	// format in currency units with two decimals
+	sign := ""
+	abs := uint64(money)
+	if money < 0 {
+		sign = "-"
+		abs = -abs
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/MinorUnits, abs%MinorUnits)
+}
@@ -0,0 +1,98 @@
+package bank
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		text  string
+		money Money
+		err   error // ErrMoneyOverflow, or any other error when invalid is set
+		valid bool
+	}{
+		{"41", 4100, nil, true},
+		{"41.5", 4150, nil, true},
+		{"41.05", 4105, nil, true},
+		{"-0.05", -5, nil, true},
+		{"0", 0, nil, true},
+		{"92233720368547758.07", math.MaxInt64, nil, true},
+		{"-92233720368547758.07", -math.MaxInt64, nil, true},
+		{"92233720368547758.08", 0, ErrMoneyOverflow, false},
+		{"-92233720368547758.08", 0, ErrMoneyOverflow, false},
+		{"92233720368547759", 0, ErrMoneyOverflow, false},
+		{"99999999999999999999", 0, ErrMoneyOverflow, false},
+		{"1.+5", 0, nil, false},
+		{"1.-5", 0, nil, false},
+		{"1.5-", 0, nil, false},
+		{"+1", 0, nil, false},
+		{"--1", 0, nil, false},
+		{"-+1", 0, nil, false},
+		{"1.005", 0, nil, false},
+		{"1.123", 0, nil, false},
+		{"1.2.3", 0, nil, false},
+		{"1,5", 0, nil, false},
+		{"1.a", 0, nil, false},
+		{" 1", 0, nil, false},
+		{".5", 0, nil, false},
+		{"-", 0, nil, false},
+		{"", 0, nil, false},
+	}
+	for _, test := range tests {
+		money, err := ParseMoney(test.text)
+		switch {
+		case test.valid && (err != nil || money != test.money):
+			t.Errorf("ParseMoney(%q) = %d, %v, expected %d", test.text, money, err, test.money)
+		case !test.valid && err == nil:
+			t.Errorf("ParseMoney(%q) = %d, expected an error", test.text, money)
+		case test.err != nil && !errors.Is(err, test.err):
+			t.Errorf("ParseMoney(%q) returned %v, expected %v", test.text, err, test.err)
+		case !test.valid && test.err == nil && errors.Is(err, ErrMoneyOverflow):
+			t.Errorf("ParseMoney(%q) overflowed, expected an invalid amount", test.text)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	tests := []struct {
+		money, other Money
+		sum          Money
+		sumErr       bool
+		difference   Money
+		diffErr      bool
+	}{
+		{100, 50, 150, false, 50, false},
+		{-100, 50, -50, false, -150, false},
+		{math.MaxInt64, 0, math.MaxInt64, false, math.MaxInt64, false},
+		{math.MaxInt64, 1, 0, true, math.MaxInt64 - 1, false},
+		{math.MaxInt64, -1, math.MaxInt64 - 1, false, 0, true},
+		{math.MinInt64, -1, 0, true, math.MinInt64 + 1, false},
+		{math.MinInt64, 1, math.MinInt64 + 1, false, 0, true},
+		{-1, math.MaxInt64, math.MaxInt64 - 1, false, math.MinInt64, false},
+		{-2, math.MaxInt64, math.MaxInt64 - 2, false, 0, true},
+		{0, math.MinInt64, math.MinInt64, false, 0, true},
+	}
+	for _, test := range tests {
+		sum, err := test.money.Add(test.other)
+		if test.sumErr != errors.Is(err, ErrMoneyOverflow) || (!test.sumErr && sum != test.sum) {
+			t.Errorf("%d + %d = %d, %v", test.money, test.other, sum, err)
+		}
+		if test.sumErr && sum != test.money {
+			t.Errorf("%d + %d overflowed but returned %d", test.money, test.other, sum)
+		}
+		difference, err := test.money.Sub(test.other)
+		if test.diffErr != errors.Is(err, ErrMoneyOverflow) || (!test.diffErr && difference != test.difference) {
+			t.Errorf("%d - %d = %d, %v", test.money, test.other, difference, err)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	for money, text := range map[Money]string{0: "0.00", 5: "0.05", -5: "-0.05", 4150: "41.50", math.MaxInt64: "92233720368547758.07", math.MinInt64: "-92233720368547758.08"} {
+		if money.String() != text {
+			t.Errorf("%d formats as %q, expected %q", int64(money), money.String(), text)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package bank
+
+import "fmt"
+
+// Operations of a transaction. A transfer moves money between two accounts;
+// the others read and change the balance of the account running them alone,
+// with the cash going to or coming from the bank so the total stays the same.
+const (
+	Transfer          = ""                   // From pays Amount to To
+	Deposit           = "deposit"            // From receives Amount in cash
+	WithdrawCash      = "withdraw-cash"      // From pays out Amount in cash
+	BalanceAdjustment = "balance-adjustment" // From's balance changes by Amount, which may be negative
+)
+
+// IsOperation reports whether name is the keyword of a single-account
+// operation in the transactions file
+func IsOperation(name string) bool {
+	return name == Deposit || name == WithdrawCash || name == BalanceAdjustment
+}
+
+// moves returns the account the money of the transaction leaves, the account
+// it goes to, and how much
+func (transaction Transaction) moves() (int, int, Money) {
+	switch transaction.Op {
+	case Deposit:
+		return Bank, transaction.From, transaction.Amount
+	case WithdrawCash:
+		return transaction.From, Bank, transaction.Amount
+	case BalanceAdjustment:
+		if transaction.Amount < 0 {
+			return transaction.From, Bank, -transaction.Amount
+		}
+		return Bank, transaction.From, transaction.Amount
+	}
+	return transaction.From, transaction.To, transaction.Amount
+}
+
+// Needs returns the balance the account running the transaction must have
+func (transaction Transaction) Needs() Money {
+	from, _, amount := transaction.moves()
+	if from != transaction.From {
+		return 0
+	}
+	return amount
+}
+
+// Accounts returns the accounts whose balances the transaction changes
+func (transaction Transaction) Accounts() []int {
+	if transaction.Op != Transfer {
+		return []int{transaction.From}
+	}
+	return []int{transaction.From, transaction.To}
+}
+
+func (transaction Transaction) String() string {
+	switch transaction.Op {
+	case Deposit:
+		return fmt.Sprintf("deposit of %s by participant %d", transaction.Amount, transaction.From)
+	case WithdrawCash:
+		return fmt.Sprintf("cash withdrawal of %s by participant %d", transaction.Amount, transaction.From)
+	case BalanceAdjustment:
+		return fmt.Sprintf("balance adjustment of %s of participant %d", transaction.Amount, transaction.From)
+	}
+	return fmt.Sprintf("participant %d to participant %d, amount %s", transaction.From, transaction.To, transaction.Amount)
+}
+
+func describeMove(transaction Transaction) string {
+	// the line of the ledger log for a committed transaction
+	switch transaction.Op {
+	case Deposit:
+		return fmt.Sprintf("Participant %d has deposited %s.", transaction.From, transaction.Amount)
+	case WithdrawCash:
+		return fmt.Sprintf("Participant %d has withdrawn %s in cash.", transaction.From, transaction.Amount)
+	case BalanceAdjustment:
+		return fmt.Sprintf("Participant %d has had its balance adjusted by %s.", transaction.From, transaction.Amount)
+	}
+	return fmt.Sprintf("Participant %d has transferred %s to participant %d.", transaction.From, transaction.Amount, transaction.To)
+}
+
+func transactionOf(event Event) Transaction {
+	// the transaction behind a transfer or failure event; a failed operation
+	// comes back as a transfer with the bank
+	transaction := Transaction{From: event.Account, To: event.Peer, Amount: event.Amount, Lane: event.Lane}
+	if event.Kind != "transfer" || !IsOperation(event.Reason) {
+		return transaction
+	}
+	transaction.Op, transaction.To = event.Reason, Bank
+	if event.Account == Bank {
+		transaction.From = event.Peer
+	} else if event.Reason == BalanceAdjustment {
+		transaction.Amount = -event.Amount
+	}
+	return transaction
+}
@@ -0,0 +1,67 @@
+package bank
+
+import (
+	"sync"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// parallelism follows how many accounts are inside the CS at once, which
+// only exceeds one in resource mode
+type parallelism struct {
+	mutex   sync.Mutex
+	inside  int
+	most    int
+	changed time.Time
+	held    time.Duration // CS time summed over the accounts inside
+	busy    time.Duration // time with at least one account inside
+}
+
+func (p *parallelism) update(delta int, now time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.inside > 0 {
+		elapsed := now.Sub(p.changed)
+		p.held += time.Duration(p.inside) * elapsed
+		p.busy += elapsed
+	}
+	p.changed = now
+	p.inside += delta
+	p.most = max(p.most, p.inside)
+}
+
+func (p *parallelism) gain() (float64, int) {
+	// the CS time over the time the CS was in use, i.e. how much longer the
+	// transfers would have held a single global CS, and the most accounts
+	// inside at once
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.busy <= 0 {
+		return 0, p.most
+	}
+	return float64(p.held) / float64(p.busy), p.most
+}
+
+func (run *Simulation) enterCS(account *mutex.Account, transaction Transaction) {
+	// resource mode: only the transfers sharing one of the two accounts
+	// exclude each other
+	asked := run.clock.Now()
+	switch {
+	case transaction.Lane == LaneSystem && run.config.Resources:
+		account.EnterBackground(transaction.Accounts()...)
+	case transaction.Lane == LaneSystem:
+		account.EnterBackground()
+	case run.config.Resources:
+		account.EnterFor(transaction.Accounts()...)
+	default:
+		account.Enter()
+	}
+	run.fairness.entered(account.ID(), run.clock.Since(asked))
+	run.parallelism.update(1, run.clock.Now())
+}
+
+func (run *Simulation) exitCS(account *mutex.Account) {
+	run.parallelism.update(-1, run.clock.Now())
+	account.Exit()
+}
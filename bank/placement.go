@@ -0,0 +1,165 @@
+package bank
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// In a multi-process run every process announces where it runs, and pings
+// the first account of every other process to measure the round trip over
+// the transport, next to the protocol messages of the run. The metrics of
+// each process list every process and the round trips it observed.
+
+// PlacementPings is how many round trips are measured to each other process
+const PlacementPings = 5
+
+// ProcessPlacement is where the accounts of one process ran
+type ProcessPlacement struct {
+	Host      string          `json:"host"`
+	PID       int             `json:"pid"`
+	Container string          `json:"container,omitempty"` // the container id, or its runtime when the id is unknown
+	Accounts  []int           `json:"accounts"`
+	Self      bool            `json:"self,omitempty"`  // the process that wrote the metrics
+	RTT       *LatencySummary `json:"rttMs,omitempty"` // round trips from the process that wrote the metrics
+}
+
+func (placement ProcessPlacement) String() string {
+	where := fmt.Sprintf("%s (pid %d", placement.Host, placement.PID)
+	if placement.Container != "" {
+		where += ", container " + placement.Container
+	}
+	where += ")"
+	if placement.Self {
+		where += ", this process"
+	}
+	if placement.RTT != nil {
+		where += fmt.Sprintf(", round trip avg %.3f ms, max %.3f ms", placement.RTT.Avg, placement.RTT.Max)
+	}
+	return fmt.Sprintf("participants %v on %s", placement.Accounts, where)
+}
+
+// placements collects the processes heard of and the round trips to them, by
+// the first account of each process
+type placements struct {
+	mutex     sync.Mutex
+	processes map[int]ProcessPlacement
+	rtts      map[int][]time.Duration
+}
+
+func (run *Simulation) announcePlacement() {
+	// tell the other processes where our accounts run
+	host, _ := os.Hostname()
+	self := ProcessPlacement{Host: host, PID: os.Getpid(), Container: containerID(), Accounts: run.localAccounts(), Self: true}
+	run.placement.mutex.Lock()
+	run.placement.processes[self.Accounts[0]] = self
+	run.placement.mutex.Unlock()
+
+	self.Self = false
+	data, err := json.Marshal(replica{Kind: "placement", Placement: &self})
+	if err != nil {
+		fmt.Fprintln(run.config.Output, "Error encoding placement", err)
+		return
+	}
+	run.network.Broadcast(self.Accounts[0], data)
+}
+
+func (run *Simulation) receivePlacement(placement ProcessPlacement) {
+	// the broadcast reaches each of our accounts, so it is counted once by the
+	// process's first account, which we then ping
+	first := placement.Accounts[0]
+	run.placement.mutex.Lock()
+	_, seen := run.placement.processes[first]
+	if !seen {
+		run.placement.processes[first] = placement
+	}
+	run.placement.mutex.Unlock()
+	if !seen {
+		run.ping(first)
+	}
+}
+
+func (run *Simulation) ping(to int) {
+	data, err := json.Marshal(replica{Kind: "ping", ID: to, Sent: run.clock.Now().UnixNano()})
+	if err != nil {
+		return
+	}
+	run.network.SendData(run.localAccounts()[0], to, data)
+}
+
+func (run *Simulation) receivePing(from int, message replica) {
+	// answer with the ping's own timestamp, so the pinging process measures the
+	// round trip on its clock
+	message.Kind = "pong"
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	run.network.SendData(message.ID, from, data)
+}
+
+func (run *Simulation) receivePong(message replica) {
+	rtt := run.clock.Since(time.Unix(0, message.Sent))
+	run.placement.mutex.Lock()
+	run.placement.rtts[message.ID] = append(run.placement.rtts[message.ID], rtt)
+	again := len(run.placement.rtts[message.ID]) < PlacementPings
+	run.placement.mutex.Unlock()
+	if again {
+		run.ping(message.ID)
+	}
+}
+
+func (run *Simulation) localAccounts() []int {
+	local := make([]int, 0, run.network.Len())
+	for id := 0; id < run.network.Len(); id++ {
+		if run.network.IsLocal(id) {
+			local = append(local, id)
+		}
+	}
+	return local
+}
+
+func (run *Simulation) placementReport() []ProcessPlacement {
+	// every process heard of, in account order, with the round trips to it
+	if run.config.Transport == nil {
+		return nil
+	}
+	run.placement.mutex.Lock()
+	defer run.placement.mutex.Unlock()
+	report := make([]ProcessPlacement, 0, len(run.placement.processes))
+	for first, placement := range run.placement.processes {
+		if rtts := run.placement.rtts[first]; len(rtts) > 0 {
+			summary := summarize(rtts)
+			placement.RTT = &summary
+		}
+		report = append(report, placement)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Accounts[0] < report[j].Accounts[0] })
+	return report
+}
+
+// the container id in the cgroup paths of Docker, Kubernetes, containerd and
+// Podman
+var containerPattern = regexp.MustCompile(`(?:docker|kubepods|containerd|libpod|cri-o)[^/]*/(?:.*/)?(?:docker-|crio-|libpod-)?([0-9a-f]{64})`)
+
+func containerID() string {
+	// the container this process runs in, "" outside of one
+	for _, name := range []string{"/proc/self/cgroup", "/proc/self/mountinfo"} {
+		if data, err := os.ReadFile(name); err == nil {
+			if match := containerPattern.FindSubmatch(data); match != nil {
+				return string(match[1][:12])
+			}
+		}
+	}
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return "podman"
+	}
+	return ""
+}
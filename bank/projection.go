@@ -0,0 +1,132 @@
+package bank
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Projection folds the events of a run into a report; new reports are added by
+// registering a projection instead of changing the simulation
+type Projection interface {
+	Apply(event Event)
+	Report(w io.Writer)
+}
+
+// Projections are the projections selectable by name
+var Projections = map[string]func() Projection{
+	"balance":        func() Projection { return &BalanceProjection{} },
+	"turnover":       func() Projection { return &TurnoverProjection{} },
+	"counterparties": func() Projection { return &CounterpartiesProjection{} },
+	"supply":         func() Projection { return &SupplyProjection{} },
+}
+
+// Project replays the events, in order, into every projection
+func Project(events []Event, projections ...Projection) {
+	for _, event := range events {
+		for _, projection := range projections {
+			projection.Apply(event)
+		}
+	}
+}
+
+func sortedAccounts[V any](accounts map[int]V) []int {
+	ids := make([]int, 0, len(accounts))
+	for id := range accounts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// BalanceProjection is the balance of every account, in the format of
+// final.txt; the bank (-1) funding the accounts is left out
+type BalanceProjection struct {
+	balances map[int]Money
+}
+
+func (projection *BalanceProjection) Apply(event Event) {
+	if event.Kind != "transfer" || event.Account == event.Peer {
+		return
+	}
+	if projection.balances == nil {
+		projection.balances = make(map[int]Money)
+	}
+	projection.balances[event.Account] -= event.Amount
+	projection.balances[event.Peer] += event.Amount
+}
+
+func (projection *BalanceProjection) Balance(id int) Money {
+	return projection.balances[id]
+}
+
+func (projection *BalanceProjection) Report(w io.Writer) {
+	for _, id := range sortedAccounts(projection.balances) {
+		if id >= 0 {
+			fmt.Fprintf(w, "%d,%s\n", id, projection.balances[id])
+		}
+	}
+}
+
+// TurnoverProjection is the money every account sent and received
+type TurnoverProjection struct {
+	sent     map[int]Money
+	received map[int]Money
+	accounts map[int]bool
+}
+
+func (projection *TurnoverProjection) Apply(event Event) {
+	if event.Kind != "transfer" {
+		return
+	}
+	if projection.accounts == nil {
+		projection.sent = make(map[int]Money)
+		projection.received = make(map[int]Money)
+		projection.accounts = make(map[int]bool)
+	}
+	projection.sent[event.Account] += event.Amount
+	projection.received[event.Peer] += event.Amount
+	projection.accounts[event.Account] = true
+	projection.accounts[event.Peer] = true
+}
+
+func (projection *TurnoverProjection) Report(w io.Writer) {
+	fmt.Fprintln(w, "account,sent,received")
+	for _, id := range sortedAccounts(projection.accounts) {
+		fmt.Fprintf(w, "%d,%s,%s\n", id, projection.sent[id], projection.received[id])
+	}
+}
+
+// CounterpartiesProjection is the accounts every account exchanged money with
+type CounterpartiesProjection struct {
+	peers map[int]map[int]bool
+}
+
+func (projection *CounterpartiesProjection) Apply(event Event) {
+	if event.Kind != "transfer" || event.Account == event.Peer {
+		return
+	}
+	if projection.peers == nil {
+		projection.peers = make(map[int]map[int]bool)
+	}
+	projection.add(event.Account, event.Peer)
+	projection.add(event.Peer, event.Account)
+}
+
+func (projection *CounterpartiesProjection) add(id int, peer int) {
+	if projection.peers[id] == nil {
+		projection.peers[id] = make(map[int]bool)
+	}
+	projection.peers[id][peer] = true
+}
+
+func (projection *CounterpartiesProjection) Report(w io.Writer) {
+	for _, id := range sortedAccounts(projection.peers) {
+		peers := make([]string, 0, len(projection.peers[id]))
+		for _, peer := range sortedAccounts(projection.peers[id]) {
+			peers = append(peers, fmt.Sprint(peer))
+		}
+		fmt.Fprintf(w, "%d,%s\n", id, strings.Join(peers, ";"))
+	}
+}
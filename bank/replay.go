@@ -0,0 +1,71 @@
+package bank
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// ReplayScenario rebuilds the workload of a recorded run from its structured
+// event log: every transfer committed or failed becomes a transaction arriving
+// as long after the start as it was recorded, divided by speed (2 replays
+// twice as fast). The recording only has the time transactions completed,
+// which stands in for the time they arrived. The bank's transfers fund the
+// accounts first, and the accounts get √N quorums.
+func ReplayScenario(name string, events []Event, speed float64) (*Scenario, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("invalid replay speed %v", speed)
+	}
+	recorded := make([]Event, 0)
+	for _, event := range events {
+		if event.Kind == "transfer" || event.Kind == "failure" {
+			recorded = append(recorded, event)
+		}
+	}
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("%s: no transfers to replay", name)
+	}
+	// the funding transfers go first, the others in the order they happened
+	sort.SliceStable(recorded, func(i, j int) bool {
+		if funding, other := transactionOf(recorded[i]).From == Bank, transactionOf(recorded[j]).From == Bank; funding != other {
+			return funding
+		}
+		return recorded[i].Time.Before(recorded[j].Time)
+	})
+
+	start := recorded[0].Time
+	n_accounts := 0
+	funding := 0
+	transactions := make([]Transaction, 0, len(recorded))
+	for i, event := range recorded {
+		n_accounts = max(n_accounts, event.Account+1, event.Peer+1)
+		transaction := transactionOf(event)
+		transaction.ID, transaction.After = i, make([]int, 0)
+		if transaction.From == Bank {
+			funding++
+		} else {
+			transaction.Arrival = time.Duration(float64(event.Time.Sub(start)) / speed)
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return &Scenario{
+		Folder:       name,
+		Accounts:     n_accounts,
+		Quorums:      mutex.MaekawaQuorums(n_accounts),
+		Funding:      funding,
+		Transactions: transactions,
+	}, nil
+}
+
+func (run *Simulation) awaitArrival(account int, transaction Transaction) {
+	// a replayed transaction can't start before it arrives
+	wait := run.start.Add(transaction.Arrival).Sub(run.clock.Now())
+	if transaction.Arrival <= 0 || wait <= 0 {
+		return
+	}
+	run.setActivity(account, "pause", transaction.ID)
+	run.clock.Sleep(wait)
+}
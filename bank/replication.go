@@ -0,0 +1,96 @@
+package bank
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// When the accounts are spread over several processes, every process keeps a
+// full copy of the ledger: the outcome of each transaction is broadcast by the
+// process that ran it and applied by the others when it arrives. A process
+// only debits its own accounts, so a late copy can only hide money coming in
+// and make an account wait, never overdraw it.
+
+// replica is the payload broadcast to the other processes
+type replica struct {
+	Kind string `json:"kind"` // commit, failure, finished, placement, ping, pong or barrier
+	ID   int    `json:"id"`   // the transaction, the account for finished, the account pinged for ping and pong, the round for barrier
+	// placement only: where the accounts of the sender's process run
+	Placement *ProcessPlacement `json:"placement,omitempty"`
+	// barrier only: the state of the sender's process at the round
+	Barrier *barrierReport `json:"barrier,omitempty"`
+	// ping and pong only: when the ping was sent, in Unix nanoseconds of the
+	// pinging process
+	Sent int64 `json:"sent,omitempty"`
+}
+
+func (run *Simulation) share(account int, kind string, id int) {
+	if run.config.Transport == nil {
+		return
+	}
+	data, err := json.Marshal(replica{Kind: kind, ID: id})
+	if err != nil {
+		fmt.Fprintln(run.config.Output, "Error encoding", kind, err)
+		return
+	}
+	run.network.Broadcast(account, data)
+}
+
+func (run *Simulation) receive(from int, data []byte) {
+	// every copy of a broadcast reaches each of our accounts, so the outcomes
+	// are applied once by transaction id
+	var message replica
+	if err := json.Unmarshal(data, &message); err != nil {
+		fmt.Fprintln(run.config.Output, "Error decoding message from participant", from, err)
+		return
+	}
+	switch message.Kind {
+	case "commit", "failure":
+		transaction, ok := run.byID[message.ID]
+		if !ok {
+			fmt.Fprintln(run.config.Output, "Participant", from, "sent the outcome of unknown transaction", message.ID)
+			return
+		}
+		state := committed
+		if message.Kind == "failure" {
+			state = failed
+		}
+		applied, err := run.ledger.replay(transaction, state)
+		if err != nil {
+			run.countFailure("overflow", transaction)
+		} else if applied && state == committed {
+			run.emitTransfer(transaction)
+		}
+	case "finished":
+		run.finish(message.ID)
+	case "placement":
+		if message.Placement != nil && len(message.Placement.Accounts) > 0 {
+			run.receivePlacement(*message.Placement)
+		}
+	case "ping":
+		run.receivePing(from, message)
+	case "pong":
+		run.receivePong(message)
+	case "barrier":
+		if message.Barrier != nil {
+			run.receiveBarrier(message.ID, *message.Barrier)
+		}
+	}
+}
+
+func (run *Simulation) finish(account int) {
+	run.finished_mutex.Lock()
+	defer run.finished_mutex.Unlock()
+	run.finished[account] = true
+	run.finished_cond.Broadcast()
+}
+
+func (run *Simulation) waitForAccounts() {
+	// block until every account of every process ran its transactions; the
+	// outcomes an account broadcast arrive before it reports being finished
+	run.finished_mutex.Lock()
+	defer run.finished_mutex.Unlock()
+	for len(run.finished) < run.network.Len() {
+		run.finished_cond.Wait()
+	}
+}
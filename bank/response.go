@@ -0,0 +1,91 @@
+package bank
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// the quorum members reported per account, slowest first
+const slowestResponders = 3
+
+// Responder is how fast a quorum member approved the CS requests of an
+// account, from the request leaving to the approval being accepted
+type Responder struct {
+	Peer     int            `json:"peer"`
+	Answered int            `json:"answered"`
+	Response LatencySummary `json:"responseMs"`
+}
+
+// responseSample is the response time of one approval
+type responseSample struct {
+	account  int
+	peer     int
+	response time.Duration
+	at       time.Time
+}
+
+func (run *Simulation) observeResponse(kind string, account int, peer int) {
+	// time each approval from the request it answers; the token-based
+	// algorithms have no approvals, so their requests stay unanswered, and
+	// the vote an account gives itself (optimized) isn't a response
+	switch kind {
+	case "request", "approved":
+	default:
+		return
+	}
+	if account == peer {
+		return
+	}
+	now := run.clock.Now()
+	key := [2]int{account, peer}
+	run.responses_mutex.Lock()
+	defer run.responses_mutex.Unlock()
+	if kind == "request" {
+		run.asked[key] = now
+		return
+	}
+	asked, ok := run.asked[key]
+	if !ok {
+		return
+	}
+	delete(run.asked, key)
+	run.responses = append(run.responses, responseSample{account: account, peer: peer, response: now.Sub(asked), at: now})
+}
+
+func (run *Simulation) responders(warmUp time.Duration) map[int][]Responder {
+	// the slowest quorum members of each account after the warm-up, by their
+	// average response time
+	run.responses_mutex.Lock()
+	times := make(map[int]map[int][]time.Duration)
+	for _, sample := range run.responses {
+		if sample.at.Sub(run.start) <= warmUp {
+			continue
+		}
+		if times[sample.account] == nil {
+			times[sample.account] = make(map[int][]time.Duration)
+		}
+		times[sample.account][sample.peer] = append(times[sample.account][sample.peer], sample.response)
+	}
+	run.responses_mutex.Unlock()
+
+	slowest := make(map[int][]Responder)
+	for account, peers := range times {
+		responders := make([]Responder, 0, len(peers))
+		for peer, durations := range peers {
+			responders = append(responders, Responder{Peer: peer, Answered: len(durations), Response: summarize(durations)})
+		}
+		sort.Slice(responders, func(i, j int) bool {
+			if responders[i].Response.Avg != responders[j].Response.Avg {
+				return responders[i].Response.Avg > responders[j].Response.Avg
+			}
+			return responders[i].Peer < responders[j].Peer
+		})
+		slowest[account] = responders[:min(len(responders), slowestResponders)]
+	}
+	return slowest
+}
+
+func (responder Responder) String() string {
+	return fmt.Sprintf("participant %d (avg %.3f ms, max %.3f ms, %d approvals)", responder.Peer, responder.Response.Avg, responder.Response.Max, responder.Answered)
+}
@@ -0,0 +1,108 @@
+package bank
+
+import (
+	"fmt"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// SafetyReport is the outcome of checking the invariants of a run on its
+// event trace: at most one account inside the CS at any time, no negative
+// balance and a constant amount of money besides what the bank funded
+type SafetyReport struct {
+	Passed    bool   `json:"passed"`
+	Events    int    `json:"events"`
+	Entries   int    `json:"csEntries"`
+	Violation string `json:"violation,omitempty"`
+	Index     int    `json:"index,omitempty"` // position of the first violating event in the trace, from 1
+	Event     *Event `json:"event,omitempty"`
+}
+
+func (report SafetyReport) String() string {
+	if report.Passed {
+		return fmt.Sprintf("PASS (%d events, %d CS entries)", report.Events, report.Entries)
+	}
+	return fmt.Sprintf("FAIL at event %d (%s): %s", report.Index, report.Event, report.Violation)
+}
+
+// CheckSafety replays an event trace in the order it was emitted, which is
+// the order of the CS entries and releases since an account reports its
+// release before the next account can enter, and returns at the first event
+// breaking an invariant. In resource mode several accounts may be inside at
+// once, for disjoint accounts. The balances start at the opening balances (which
+// may be nil) and may not go below the floor of the funds rule of the run
+// (BalanceFloor). A trace written by one process of a multi-process run only
+// shows the CS entries of its accounts.
+func CheckSafety(events []Event, balances map[int]Money, floor Money) SafetyReport {
+	report := SafetyReport{Events: len(events)}
+	current := make(map[int]Money)
+	var total Money
+	for id, balance := range balances {
+		current[id] = balance
+		total += balance
+	}
+	funded := Money(0)
+	inside := make(map[int][]int) // the accounts inside the CS, with their resources
+
+	fail := func(i int, violation string) SafetyReport {
+		event := events[i]
+		report.Violation = violation
+		report.Index = i + 1
+		report.Event = &event
+		return report
+	}
+
+	for i, event := range events {
+		switch event.Kind {
+		case "enter":
+			for id, resources := range inside {
+				if !mutex.ResourcesOverlap(resources, event.Resources) {
+					continue
+				}
+				if resources == nil && event.Resources == nil {
+					return fail(i, fmt.Sprintf("participant %d entered the CS while participant %d was inside", event.Account, id))
+				}
+				return fail(i, fmt.Sprintf("participant %d entered the CS for %s while participant %d held it for %s", event.Account, describeResources(event.Resources), id, describeResources(resources)))
+			}
+			inside[event.Account] = event.Resources
+			report.Entries++
+		case "release":
+			if _, ok := inside[event.Account]; !ok {
+				return fail(i, fmt.Sprintf("participant %d released the CS it wasn't inside", event.Account))
+			}
+			delete(inside, event.Account)
+		case "transfer":
+			if event.Account == event.Peer {
+				continue
+			}
+			if event.Account == Bank {
+				funded += event.Amount
+			} else {
+				current[event.Account] -= event.Amount
+			}
+			current[event.Peer] += event.Amount
+			if event.Account != Bank && current[event.Account] < floor {
+				if floor == 0 {
+					return fail(i, fmt.Sprintf("participant %d has a negative balance of %s", event.Account, current[event.Account]))
+				}
+				return fail(i, fmt.Sprintf("participant %d has a balance of %s, beyond its credit line of %s", event.Account, current[event.Account], -floor))
+			}
+			sum := Money(0)
+			for _, balance := range current {
+				sum += balance
+			}
+			if sum != total+funded {
+				return fail(i, fmt.Sprintf("the accounts hold %s instead of %s", sum, total+funded))
+			}
+		}
+	}
+	report.Passed = true
+	return report
+}
+
+func describeResources(resources []int) string {
+	if resources == nil {
+		return "every participant"
+	}
+	return fmt.Sprintf("participants %v", resources)
+}
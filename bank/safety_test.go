@@ -0,0 +1,144 @@
+package bank
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+func TestCheckSafetyCreditLine(t *testing.T) {
+	// participant 0 overdraws by 50 within a credit line of 100
+	events := []Event{
+		{Kind: "transfer", Account: Bank, Peer: 0, Amount: 10000},
+		{Kind: "transfer", Account: Bank, Peer: 1, Amount: 10000},
+		{Kind: "enter", Account: 0},
+		{Kind: "transfer", Account: 0, Peer: 1, Amount: 15000},
+		{Kind: "release", Account: 0},
+	}
+	for _, test := range []struct {
+		name   string
+		floor  Money
+		passed bool
+	}{
+		{"balance", BalanceFloor(BalanceRule{}), false},
+		{"credit line", BalanceFloor(CreditLineRule{Limit: 10000}), true},
+		{"short credit line", BalanceFloor(CreditLineRule{Limit: 2000}), false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			report := CheckSafety(events, nil, test.floor)
+			if report.Passed != test.passed {
+				t.Fatalf("%s, expected passed=%v", report, test.passed)
+			}
+		})
+	}
+}
+
+func TestSafetyUnderOrderings(t *testing.T) {
+	// every algorithm keeps mutual exclusion and the balances whatever order
+	// the transport delivers the messages in
+	type run struct {
+		algorithm mutex.Algorithm
+		ordering  mutex.Ordering
+	}
+	tests := make([]run, 0)
+	for _, algorithm := range []mutex.Algorithm{mutex.Original, mutex.Optimized, mutex.TokenRing, mutex.SuzukiKasami} {
+		for _, ordering := range mutex.Orderings {
+			tests = append(tests, run{algorithm, ordering})
+		}
+	}
+	for _, test := range tests {
+		t.Run(string(test.algorithm)+"/"+string(test.ordering), func(t *testing.T) {
+			storage := NewMemoryStorage(os.DirFS(".."))
+			config := DefaultConfig()
+			config.Algorithm = test.algorithm
+			config.Ordering = test.ordering
+			config.Seed = 7
+			config.Clock = mutex.NewScaledClock(50)
+			config.Storage = storage
+			trace := &MemorySink{}
+			config.Sinks = []Sink{trace}
+			scenario, err := LoadScenario(storage, "tests/test_2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			NewSimulation(config, scenario).Run()
+			report := CheckSafety(trace.Events(), scenario.Balances, 0)
+			if !report.Passed {
+				t.Fatalf("%s", report)
+			}
+			if report.Entries == 0 {
+				t.Fatal("no CS entry")
+			}
+		})
+	}
+}
+
+func TestCheckSafetyFindsFirstViolation(t *testing.T) {
+	// each trace breaks an invariant at the event given, or passes (index 0)
+	funded := []Event{
+		{Kind: "transfer", Account: Bank, Peer: 0, Amount: 1000},
+		{Kind: "transfer", Account: Bank, Peer: 1, Amount: 1000},
+	}
+	tests := []struct {
+		name      string
+		events    []Event
+		index     int
+		violation string
+	}{
+		{"in turn", []Event{
+			{Kind: "enter", Account: 0},
+			{Kind: "transfer", Account: 0, Peer: 1, Amount: 500},
+			{Kind: "release", Account: 0},
+			{Kind: "enter", Account: 1},
+			{Kind: "transfer", Account: 1, Peer: 0, Amount: 1500},
+			{Kind: "release", Account: 1},
+		}, 0, ""},
+		{"two inside", []Event{
+			{Kind: "enter", Account: 0},
+			{Kind: "enter", Account: 1},
+			{Kind: "release", Account: 0},
+			{Kind: "enter", Account: 0},
+		}, 4, "participant 1 entered the CS while participant 0 was inside"},
+		{"release outside", []Event{
+			{Kind: "enter", Account: 0},
+			{Kind: "release", Account: 0},
+			{Kind: "release", Account: 0},
+		}, 5, "participant 0 released the CS it wasn't inside"},
+		{"negative balance", []Event{
+			{Kind: "enter", Account: 0},
+			{Kind: "transfer", Account: 0, Peer: 1, Amount: 600},
+			{Kind: "transfer", Account: 0, Peer: 1, Amount: 600},
+			{Kind: "transfer", Account: 0, Peer: 1, Amount: 600},
+		}, 5, "participant 0 has a negative balance of -2.00"},
+		{"disjoint resources", []Event{
+			{Kind: "enter", Account: 0, Resources: []int{0, 1}},
+			{Kind: "enter", Account: 2, Resources: []int{2, 3}},
+			{Kind: "release", Account: 0},
+			{Kind: "release", Account: 2},
+		}, 0, ""},
+		{"shared resource", []Event{
+			{Kind: "enter", Account: 0, Resources: []int{0, 1}},
+			{Kind: "enter", Account: 2, Resources: []int{1, 2}},
+		}, 4, "participant 2 entered the CS for participants [1 2] while participant 0 held it for participants [0 1]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := append(append([]Event(nil), funded...), test.events...)
+			report := CheckSafety(events, nil, 0)
+			if test.index == 0 {
+				if !report.Passed {
+					t.Fatalf("%s, expected a pass", report)
+				}
+				return
+			}
+			if report.Passed || report.Index != test.index || report.Violation != test.violation {
+				t.Fatalf("%s, expected a failure at event %d: %s", report, test.index, test.violation)
+			}
+			if report.Event == nil || !reflect.DeepEqual(*report.Event, events[test.index-1]) {
+				t.Fatalf("reported event %v, expected %v", report.Event, events[test.index-1])
+			}
+		})
+	}
+}
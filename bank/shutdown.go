@@ -0,0 +1,184 @@
+package bank
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// When the accounts are spread over several processes, a process whose
+// accounts are all finished can still have protocol messages in flight, or
+// outcomes of other processes not applied yet. Before the final balances are
+// written, the processes go through a shutdown barrier in rounds: each one
+// broadcasts the protocol messages it sent to and received from the others,
+// the requests its accounts still defer and a digest of its ledger, then
+// waits for the report of every other process for the round. The workload is
+// complete once two rounds in a row report the same counts, as many messages
+// received as sent and no deferred request. Every process sees the same
+// reports, so they all stop at the same round, and then compare the digests
+// of their ledgers.
+
+// barrierInterval is the pause between two rounds of the shutdown barrier
+const barrierInterval = 10 * time.Millisecond
+
+// ShutdownReport is the outcome of the shutdown barrier of a multi-process
+// run
+type ShutdownReport struct {
+	Rounds   int    `json:"rounds"`
+	Agreed   bool   `json:"agreed"` // every process ended with the same ledger
+	Digest   string `json:"digest"` // of the ledger of this process
+	TimedOut bool   `json:"timedOut,omitempty"`
+	// the first account of each process whose ledger differs from ours
+	Disagreeing []int `json:"disagreeing,omitempty"`
+}
+
+func (report ShutdownReport) String() string {
+	switch {
+	case report.TimedOut:
+		return fmt.Sprintf("TIMED OUT after %d rounds, the processes didn't agree the workload was complete", report.Rounds)
+	case !report.Agreed:
+		return fmt.Sprintf("DISAGREE after %d rounds: the ledgers of the processes of participants %v differ from ours (%s)", report.Rounds, report.Disagreeing, report.Digest)
+	}
+	return fmt.Sprintf("AGREED after %d rounds on ledger %s", report.Rounds, report.Digest)
+}
+
+// barrierReport is what a process broadcasts at each round
+type barrierReport struct {
+	Accounts []int  `json:"accounts"`
+	Sent     int64  `json:"sent"`
+	Received int64  `json:"received"`
+	Deferred int    `json:"deferred"`
+	Digest   string `json:"digest"`
+}
+
+// barrier collects the reports of the processes, by round and by the first
+// account of each process
+type barrier struct {
+	mutex  sync.Mutex
+	rounds map[int]map[int]barrierReport
+}
+
+func (run *Simulation) shutdown() *ShutdownReport {
+	// run the shutdown barrier with the other processes, until they agree the
+	// workload is complete or Config.BarrierTimeout passes
+	ticker := run.clock.NewTicker(barrierInterval)
+	defer ticker.Stop()
+	var deadline time.Time
+	if run.config.BarrierTimeout > 0 {
+		deadline = run.clock.Now().Add(run.config.BarrierTimeout)
+	}
+	first := run.localAccounts()[0]
+	var last map[int]barrierReport
+	for round := 1; ; round++ {
+		ours := run.barrierReport()
+		run.receiveBarrier(round, ours)
+		data, err := json.Marshal(replica{Kind: "barrier", ID: round, Barrier: &ours})
+		if err != nil {
+			fmt.Fprintln(run.config.Output, "Error encoding barrier", err)
+			return nil
+		}
+		run.network.Broadcast(first, data)
+
+		var reports map[int]barrierReport
+		for reports = run.barrierRound(round); reports == nil; reports = run.barrierRound(round) {
+			if !deadline.IsZero() && run.clock.Now().After(deadline) {
+				return &ShutdownReport{Rounds: round, Digest: ours.Digest, TimedOut: true}
+			}
+			<-ticker.C()
+		}
+		if complete(reports, last) {
+			report := &ShutdownReport{Rounds: round, Agreed: true, Digest: ours.Digest}
+			for id, theirs := range reports {
+				if theirs.Digest != ours.Digest {
+					report.Agreed = false
+					report.Disagreeing = append(report.Disagreeing, id)
+				}
+			}
+			sort.Ints(report.Disagreeing)
+			return report
+		}
+		last = reports
+		<-ticker.C()
+	}
+}
+
+func (run *Simulation) barrierReport() barrierReport {
+	report := barrierReport{Accounts: run.localAccounts(), Digest: run.ledgerDigest()}
+	report.Sent, report.Received = run.network.Traffic()
+	for _, id := range report.Accounts {
+		report.Deferred += run.network.Account(id).Waiting()
+	}
+	return report
+}
+
+func (run *Simulation) receiveBarrier(round int, report barrierReport) {
+	// the broadcast reaches each of our accounts: keep the first copy
+	if len(report.Accounts) == 0 {
+		return
+	}
+	run.barrier.mutex.Lock()
+	defer run.barrier.mutex.Unlock()
+	if run.barrier.rounds[round] == nil {
+		run.barrier.rounds[round] = make(map[int]barrierReport)
+	}
+	if _, ok := run.barrier.rounds[round][report.Accounts[0]]; !ok {
+		run.barrier.rounds[round][report.Accounts[0]] = report
+	}
+}
+
+func (run *Simulation) barrierRound(round int) map[int]barrierReport {
+	// the reports of the round once every process still alive sent its own,
+	// nil before
+	run.barrier.mutex.Lock()
+	defer run.barrier.mutex.Unlock()
+	covered := make(map[int]bool)
+	for _, failed := range run.network.Failed() {
+		covered[failed] = true
+	}
+	for _, report := range run.barrier.rounds[round] {
+		for _, id := range report.Accounts {
+			covered[id] = true
+		}
+	}
+	for id := 0; id < run.network.Len(); id++ {
+		if !covered[id] {
+			return nil
+		}
+	}
+	return run.barrier.rounds[round]
+}
+
+func complete(reports map[int]barrierReport, last map[int]barrierReport) bool {
+	// no message in flight, no request deferred, and nothing moved since the
+	// last round
+	sent, received := int64(0), int64(0)
+	for id, report := range reports {
+		previous, ok := last[id]
+		if !ok || report.Deferred > 0 || report.Sent != previous.Sent || report.Received != previous.Received {
+			return false
+		}
+		sent += report.Sent
+		received += report.Received
+	}
+	return len(reports) == len(last) && sent == received
+}
+
+func (run *Simulation) ledgerDigest() string {
+	// the balances and the outcomes of the transactions; the processes apply
+	// the outcomes in different orders, so the committed ones are sorted
+	committedIDs, failedIDs := run.ledger.outcomes()
+	sort.Ints(committedIDs)
+	balances := run.ledger.Balances()
+	lines := make([]string, 0, len(balances)+2)
+	for _, id := range sortedAccounts(balances) {
+		lines = append(lines, fmt.Sprintf("%d,%s", id, balances[id]))
+	}
+	lines = append(lines, fmt.Sprint("committed", committedIDs), fmt.Sprint("failed", failedIDs))
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
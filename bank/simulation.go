@@ -0,0 +1,830 @@
+// Package bank runs bank transactions between accounts that take turns in a
+// critical section guarded by the mutex package: it loads the test folders,
+// keeps the ledger of committed transfers and reports the metrics of a run.
+package bank
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// Config holds the options of a run
+type Config struct {
+	Algorithm mutex.Algorithm
+	// policies (Reject, Ignore or Allow) for transfers to the same account,
+	// transfers of 0 and negative transfers
+	SelfTransfer   string
+	ZeroAmount     string
+	NegativeAmount string
+	// what an account does without the money for a transaction, and the rule
+	// deciding whether it has the money (BalanceRule when nil)
+	Funding FundingStrategy
+	Funds   FundsRule
+	// CS request coalescing: how long an account may keep the CS for its next
+	// transactions (0 disables coalescing) and how many transactions it may add
+	// while other accounts are waiting for the CS
+	CoalesceHold    time.Duration
+	CoalesceWaiting int
+	// token-ring: simulated latency of passing the token to the next account
+	TokenHop time.Duration
+	// stragglers: the processing delay of the slow accounts before they
+	// approve a request or pass the token on
+	SlowAccounts map[int]time.Duration
+	// prefetching: an account pausing before its next transaction asks for
+	// the CS during the pause (permission-based algorithms, without SwitchTo)
+	Prefetch bool
+	// resource mode: a transfer holds the CS for its two accounts only, so
+	// transfers between disjoint accounts run in parallel (permission-based
+	// algorithms)
+	Resources bool
+	// aging: a CS request waiting longer than this for its approvals goes
+	// before the requests that haven't waited as long (permission-based
+	// algorithms, 0 disables it)
+	Aging time.Duration
+	// file access of the run and the file committed transfers are logged to,
+	// as text lines (LogText) or as the JSON lines of every event (LogJSON)
+	Storage   Storage
+	LogName   string
+	LogFormat string
+	// where the transaction and protocol events are routed
+	Sinks []Sink
+	// where the reports printed during the run go, from failed transactions
+	// to checkpoints and progress lines (os.Stdout when nil)
+	Output io.Writer
+	// multi-process runs: the transport to the other processes and the
+	// accounts run by this one (nil runs every account in this process)
+	Transport mutex.Transport
+	Local     []int
+	// multi-process runs: how long the shutdown barrier at the end waits for
+	// the processes to agree the workload is complete (0 waits forever)
+	BarrierTimeout time.Duration
+	// the delivery order of the transport: FIFO, Causal or Unordered, drawn
+	// from Seed
+	Ordering mutex.Ordering
+	// the message loss, duplication, reordering and delay injected into the
+	// protocol messages (none when zero)
+	Faults mutex.Faults
+	// failure detection (disabled when zero): heartbeat period, silence after
+	// which an account is declared failed, and how long and how many more
+	// times a CS request waits for its approvals
+	HeartbeatInterval time.Duration
+	FailureTimeout    time.Duration
+	RequestTimeout    time.Duration
+	RequestRetries    int
+	// checkpoints: the file snapshots of the run are written to, how often one
+	// is taken (0 never) and the checkpoint the run resumes from (nil for a
+	// fresh run)
+	Checkpoint      string
+	CheckpointEvery time.Duration
+	Restore         *Checkpoint
+	// crash recovery: the write-ahead log every outcome is synced to ("" for
+	// none), the file the accounts' positions and clocks are snapshotted to
+	// and how often (0 only at the end), and whether the run resumes the log
+	// of Restore instead of starting a new one
+	WAL              string
+	WALSnapshot      string
+	WALSnapshotEvery time.Duration
+	Resume           bool
+	// how long the run may go without any transaction committed or failed
+	// before the watchdog dumps the state of the accounts (0 disables it), and
+	// what it does then (SkipStuck or AbortStuck)
+	Watchdog       time.Duration
+	WatchdogAction string
+	// circuit breaker (disabled when zero): the strikes in a row that pause
+	// an account, how long it pauses, and the CS wait counted as a strike (0
+	// never)
+	BreakerThreshold int
+	BreakerCoolDown  time.Duration
+	BreakerTimeout   time.Duration
+	// archival: an account done with its transactions leaves the network,
+	// unless the quorums left wouldn't intersect (every account in this
+	// process, without groups)
+	Archive bool
+	// how often a progress line is printed (0 never)
+	Progress time.Duration
+	// warm-up left out of the duration, latency and throughput metrics: a
+	// period from the start and a number of committed transactions, whichever
+	// ends last (0 for none)
+	WarmUp             time.Duration
+	WarmUpTransactions int
+	// hot swap: the algorithm the accounts switch to once SwitchAfter
+	// transactions were committed ("" never switches); single-process runs
+	// without groups only
+	SwitchTo    mutex.Algorithm
+	SwitchAfter int
+	// how long the run may last before it is aborted (0 for no limit), and
+	// the seed shuffling the order the accounts start in (0 starts them in
+	// account order)
+	Timeout time.Duration
+	Seed    int64
+	// resource limits aborting a runaway run (0 for none): the protocol
+	// messages sent and the heap in bytes; a run aborted by a limit, the
+	// timeout or the watchdog hands its metrics so far to OnAbort before the
+	// process exits with status 2
+	MaxMessages int64
+	MaxMemory   uint64
+	OnAbort     func(metrics Metrics)
+	// the time source of the run and its network: mutex.RealClock (nil),
+	// a mutex.ScaledClock running faster, or a mutex.VirtualClock driven by
+	// hand
+	Clock mutex.Clock
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Algorithm:       mutex.Optimized,
+		SelfTransfer:    Reject,
+		ZeroAmount:      Allow,
+		NegativeAmount:  Reject,
+		Funding:         BlockStrategy{},
+		CoalesceWaiting: 1,
+		TokenHop:        time.Millisecond,
+		BarrierTimeout:  30 * time.Second,
+		Storage:         DiskStorage{},
+		LogName:         "logs.txt",
+		LogFormat:       LogText,
+		Checkpoint:      "checkpoint.json",
+		WALSnapshot:     "wal-snapshot.json",
+		WatchdogAction:  SkipStuck,
+		Ordering:        mutex.FIFO,
+	}
+}
+
+// Simulation is one run of a scenario
+type Simulation struct {
+	config       Config
+	scenario     *Scenario
+	network      *mutex.Network
+	ledger       *Ledger
+	logSink      *JSONSink     // LogJSON only: the transaction log
+	transactions []Transaction // the transactions left after validation
+	byID         map[int]Transaction
+	validation   ValidationReport
+
+	// transactions that could not be executed, by failure reason
+	failures       map[string]int64
+	failures_mutex sync.Mutex
+	// how often the funding strategy fired
+	fundingWaits       map[string]int64
+	fundingWaits_mutex sync.Mutex
+	// how often the circuit breaker of each account tripped
+	breakerTrips  map[int]int64
+	breaker_mutex sync.Mutex
+	// accounts that ran all their transactions
+	finished       map[int]bool
+	finished_mutex sync.Mutex
+	finished_cond  *sync.Cond
+
+	outOfOrder    int64
+	yielded       int64 // system transactions run after a later user transaction
+	coalesced     int64
+	coalesceSaved int64
+	coalesceWait  int64 // in microseconds
+	start         time.Time
+	duration      int64 // in milliseconds
+	restored      int   // transactions committed from the checkpoint
+
+	latencies       []latencySample
+	latencies_mutex sync.Mutex
+	parallelism     parallelism
+	fairness        fairness
+	costs           costs
+	placement       placements             // multi-process runs: where the processes run
+	barrier         barrier                // multi-process runs: the reports of the shutdown barrier
+	shutdownReport  *ShutdownReport        // multi-process runs: how the barrier ended
+	faults          *mutex.FaultyTransport // nil unless faults are injected
+	clock           mutex.Clock
+
+	// chaos experiments: the events of the run for their safety checks, and
+	// their outcomes
+	chaosTrace   *MemorySink
+	chaosResults []ChaosResult
+
+	// when each account last asked each quorum member for the CS, and how
+	// long the approvals took
+	asked           map[[2]int]time.Time
+	responses       []responseSample
+	responses_mutex sync.Mutex
+
+	// what each account of this process is doing, for the watchdog
+	activity       map[int]activity
+	activity_mutex sync.Mutex
+
+	// hot swap: the accounts hold the gate for reading while they ask for and
+	// use the CS, and the switch takes it to drain them
+	gate         sync.RWMutex
+	commits      int64
+	switching    sync.WaitGroup
+	switched     time.Time // zero until the switch
+	drain        time.Duration
+	beforeSwitch mutex.Counters
+
+	// membership changes: the next one due, those applied, and the accounts
+	// joining later, closed once they joined
+	membership int
+	applied    []MembershipChange
+	joined     map[int]chan struct{}
+
+	// archival: the accounts done that couldn't leave yet, those archived, and
+	// the accounts in the network over time
+	archiving        []int
+	archivedAccounts []ArchivedAccount
+	membershipSize   []MembershipSample
+}
+
+// NewSimulation sets up the accounts of the scenario; in hybrid mode (the
+// scenario lists groups) the co-located accounts share a site
+func NewSimulation(config Config, scenario *Scenario) *Simulation {
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+	for _, warning := range scenario.Warnings {
+		fmt.Fprintln(config.Output, warning)
+	}
+	ledgerLog := config.LogName
+	var logSink *JSONSink
+	if config.LogFormat == LogJSON {
+		// the event trace replaces the ledger's text log
+		ledgerLog = ""
+		sink, err := NewJSONSink(config.Storage, config.LogName)
+		if err != nil {
+			fmt.Fprintln(config.Output, "error creating transaction file:", err)
+		} else {
+			config.Sinks = append(config.Sinks, sink)
+			logSink = sink
+		}
+	}
+	ledger, err := NewLedger(config.Storage, ledgerLog, scenario.Balances)
+	if err != nil {
+		fmt.Fprintln(config.Output, "error creating transaction file:", err)
+	}
+	run := &Simulation{
+		config:       config,
+		scenario:     scenario,
+		ledger:       ledger,
+		byID:         make(map[int]Transaction),
+		failures:     make(map[string]int64),
+		fundingWaits: make(map[string]int64),
+		breakerTrips: make(map[int]int64),
+		finished:     make(map[int]bool),
+		activity:     make(map[int]activity),
+		logSink:      logSink,
+		joined:       make(map[int]chan struct{}),
+		asked:        make(map[[2]int]time.Time),
+		fairness:     fairness{accounts: make(map[int]*accountEntries)},
+		costs:        costs{accounts: make(map[int]*[costCategories]time.Duration)},
+		placement:    placements{processes: make(map[int]ProcessPlacement), rtts: make(map[int][]time.Duration)},
+		barrier:      barrier{rounds: make(map[int]map[int]barrierReport)},
+	}
+	run.finished_cond = sync.NewCond(&run.finished_mutex)
+	// the accounts hold the gate from their funds check in the CS to their
+	// commit, so ledger transactions commit between two CS entries
+	ledger.cs = &run.gate
+	quorums := scenario.Quorums
+	if present := scenario.Present(); present < scenario.Accounts {
+		// the accounts joining later are added to every quorum, so the
+		// accounts present from the start ask each other
+		quorums = mutex.FullQuorums(present)
+		for id := present; id < scenario.Accounts; id++ {
+			run.joined[id] = make(chan struct{})
+		}
+	}
+	transport := config.Transport
+	if transport == nil {
+		transport = mutex.NewChannelTransport(len(quorums))
+	}
+	if ordered, ok := transport.(interface {
+		SetOrdering(mutex.Ordering, int64)
+	}); ok && config.Ordering != "" {
+		ordered.SetOrdering(config.Ordering, config.Seed)
+	}
+	if reporting, ok := transport.(interface{ SetOutput(io.Writer) }); ok {
+		reporting.SetOutput(config.Output)
+	}
+	run.clock = config.Clock
+	if run.clock == nil {
+		run.clock = mutex.RealClock{}
+	}
+	if len(scenario.Chaos) > 0 {
+		run.chaosTrace = &MemorySink{}
+		run.config.Sinks = append(run.config.Sinks, run.chaosTrace)
+	}
+	if config.Faults.Enabled() || len(scenario.Chaos) > 0 {
+		run.faults = mutex.NewFaultyTransport(transport, config.Faults)
+		run.faults.Clock = run.clock
+		transport = run.faults
+	}
+	run.network = mutex.NewNetworkOver(config.Algorithm, quorums, transport, config.Local)
+	run.network.TokenHop = config.TokenHop
+	run.network.TimeSource = run.clock
+	run.network.Output = config.Output
+	run.network.SlowAccounts = config.SlowAccounts
+	run.network.Observer = observer{run}
+	run.network.OnData = run.receive
+	run.network.HeartbeatInterval = config.HeartbeatInterval
+	run.network.FailureTimeout = config.FailureTimeout
+	run.network.RequestTimeout = config.RequestTimeout
+	run.network.RequestRetries = config.RequestRetries
+	run.network.Aging = config.Aging
+	run.network.OnFailure = run.accountFailed
+	run.network.OnRecord = run.recordCheckpoint
+	run.network.OnSnapshot = run.writeCheckpoint
+	if scenario.Groups != nil {
+		run.network.ApplyGroups(scenario.Groups)
+	}
+	return run
+}
+
+func (run *Simulation) Network() *mutex.Network {
+	return run.network
+}
+
+func (run *Simulation) Ledger() *Ledger {
+	return run.ledger
+}
+
+// Run executes the transactions of the scenario and returns the metrics of
+// the run
+func (run *Simulation) Run() Metrics {
+	run.start = run.clock.Now()
+	run.transactions = run.validateTransactions(run.scenario.Transactions, run.scenario.Funding)
+	for _, transaction := range run.transactions {
+		run.byID[transaction.ID] = transaction
+	}
+	if run.config.Funds != nil {
+		run.ledger.UseFundsRule(run.config.Funds, run.transactions)
+	}
+
+	run.network.Start()
+	if run.config.WAL != "" && !run.config.Resume {
+		run.startWAL()
+	}
+	if run.config.Transport != nil {
+		run.announcePlacement()
+	}
+
+	// process bank transactions
+	for i := 0; i < run.scenario.Funding && i < len(run.transactions); i++ {
+		run.register(run.transactions[i])
+	}
+	if run.config.Restore != nil {
+		run.restore(run.config.Restore)
+	}
+	if run.config.WAL != "" && run.config.Resume {
+		// the outcomes restored are in the log already
+		run.startWAL()
+	}
+
+	// the process running the first account takes the checkpoints
+	done := make(chan struct{})
+	if run.config.CheckpointEvery > 0 && run.network.IsLocal(0) {
+		go run.checkpointEvery(run.config.CheckpointEvery, done)
+	}
+	if run.config.Watchdog > 0 {
+		go run.watchdog(run.config.Watchdog, done)
+	}
+	if run.config.Timeout > 0 {
+		go run.timeOut(done)
+	}
+	if run.config.MaxMessages > 0 || run.config.MaxMemory > 0 {
+		go run.limits(done)
+	}
+	if run.config.Progress > 0 {
+		go run.reportProgress(run.config.Progress, done)
+	}
+	if run.config.WAL != "" && run.config.WALSnapshotEvery > 0 {
+		go run.walSnapshotEvery(run.config.WALSnapshotEvery, done)
+	}
+	chaosFinished := make(chan struct{})
+	if len(run.scenario.Chaos) > 0 {
+		go run.chaos(done, chaosFinished)
+	} else {
+		close(chaosFinished)
+	}
+
+	// the membership changes due before any commit
+	if run.config.Archive || len(run.scenario.Membership) > 0 {
+		run.sampleMembership()
+	}
+	run.switching.Add(1)
+	run.changeMembership(0)
+
+	// create a wait group to wait for all goroutines to finish
+	var wg sync.WaitGroup
+
+	// create a goroutine for each account of this process for process
+	// transactions, the accounts joining later start once they joined
+	order := make([]int, 0, run.network.Len())
+	for i := 0; i < run.network.Len(); i++ {
+		if run.network.IsLocal(i) {
+			order = append(order, i)
+		}
+	}
+	if run.config.Seed != 0 {
+		random := rand.New(rand.NewSource(run.config.Seed))
+		random.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+	for _, i := range order {
+		wg.Add(1)
+		go run.processTransaction(run.network.Account(i), &wg)
+	}
+	var joining sync.WaitGroup
+	for id := range run.joined {
+		joining.Add(1)
+		go run.awaitJoin(id, &joining)
+	}
+
+	// wait for all goroutines to finish; the other processes may still need
+	// our accounts to approve their requests until they are done as well
+	wg.Wait()
+	run.switching.Wait()
+	run.flushMembership()
+	joining.Wait()
+	run.switching.Wait()
+	close(done)
+	<-chaosFinished
+	for i := 0; i < run.network.Len(); i++ {
+		if run.network.IsLocal(i) {
+			run.finish(i)
+			run.share(i, "finished", i)
+		}
+	}
+	run.waitForAccounts()
+	if run.config.Transport != nil {
+		run.shutdownReport = run.shutdown()
+	}
+	run.network.Stop()
+	if run.config.WAL != "" {
+		run.writeWALSnapshot()
+	}
+	run.ledger.Close()
+	if run.logSink != nil {
+		if err := run.logSink.Close(); err != nil {
+			fmt.Fprintln(run.config.Output, "Error in the event log:", err)
+		}
+	}
+
+	// Calculate total duration
+	run.duration = run.clock.Since(run.start).Milliseconds()
+
+	return run.metrics()
+}
+
+func (run *Simulation) emit(event Event) {
+	if len(run.config.Sinks) == 0 {
+		return
+	}
+	event.Time = run.clock.Now()
+	if event.Clock == 0 && run.network.IsLocal(event.Account) {
+		// a transaction event of a local account
+		event.Clock = run.network.Tick(event.Account)
+	}
+	for _, sink := range run.config.Sinks {
+		sink.Emit(event)
+	}
+}
+
+// observer routes the protocol events of the network to the sinks
+type observer struct {
+	run *Simulation
+}
+
+func (o observer) Observe(kind string, account int, peer int, clock int) {
+	o.run.observeResponse(kind, account, peer)
+	event := Event{Kind: kind, Account: account, Peer: peer, Clock: clock}
+	if o.run.config.Resources && (kind == "enter" || kind == "release") {
+		event.Resources = o.run.network.Account(account).Resources()
+	}
+	o.run.emit(event)
+}
+
+func (run *Simulation) register(transaction Transaction) bool {
+	if err := run.ledger.Register(transaction); err != nil {
+		run.countFailure("overflow", transaction)
+		return false
+	}
+	run.emitTransfer(transaction)
+	return true
+}
+
+func (run *Simulation) emitTransfer(transaction Transaction) {
+	from, to, amount := transaction.moves()
+	run.emit(Event{Kind: "transfer", Account: from, Peer: to, Amount: amount, Reason: transaction.Op, Lane: transaction.Lane})
+}
+
+func (run *Simulation) recordFailure(reason string, transaction Transaction) {
+	run.ledger.MarkFailed(transaction.ID)
+	run.countFailure(reason, transaction)
+}
+
+func (run *Simulation) countFailure(reason string, transaction Transaction) {
+	// the transaction has failed in the ledger already
+	run.failures_mutex.Lock()
+	run.failures[reason]++
+	run.failures_mutex.Unlock()
+	run.emit(Event{Kind: "failure", Account: transaction.From, Peer: transaction.To, Amount: transaction.Amount, Reason: reason})
+	fmt.Fprintf(run.config.Output, "Transaction %d failed (%s): %s\n", transaction.ID, reason, transaction)
+}
+
+func (run *Simulation) accountFailed(id int) {
+	run.dropTransactions(id, "participant failed")
+	run.finish(id)
+}
+
+func (run *Simulation) dropTransactions(id int, reason string) {
+	// the transactions of an account gone from the network that we don't know
+	// the outcome of will never run
+	for i := run.scenario.Funding; i < len(run.transactions); i++ {
+		transaction := run.transactions[i]
+		if transaction.From != id {
+			continue
+		}
+		if applied, _ := run.ledger.replay(transaction, failed); !applied {
+			continue
+		}
+		run.failures_mutex.Lock()
+		run.failures[reason]++
+		run.failures_mutex.Unlock()
+		run.emit(Event{Kind: "failure", Account: transaction.From, Peer: transaction.To, Amount: transaction.Amount, Reason: reason})
+	}
+}
+
+func (run *Simulation) recordFundingWait(strategy string) {
+	run.fundingWaits_mutex.Lock()
+	run.fundingWaits[strategy]++
+	run.fundingWaits_mutex.Unlock()
+}
+
+func (run *Simulation) processTransaction(account *mutex.Account, wg *sync.WaitGroup) {
+	defer wg.Done()
+	run.setActivity(account.ID(), "idle", -1)
+	defer run.setActivity(account.ID(), "done", -1)
+	defer func() {
+		// a crashed account is declared failed so the others stop waiting for it
+		if r := recover(); r != nil {
+			fmt.Fprintln(run.config.Output, "Participant", account.ID(), "crashed:", r)
+			run.network.Halt(account.ID())
+		}
+	}()
+	transactions := run.transactions
+	ledger := run.ledger
+	strategy := run.config.Funding
+
+	// the transactions of this account still to run, in the order they will
+	// run; the funding transactions were registered before the accounts started
+	// and a restored run skips those of the checkpoint
+	queue := make([]int, 0)
+	for i := run.scenario.Funding; i < len(transactions); i++ {
+		if transactions[i].From == account.ID() && ledger.state(transactions[i].ID) == pending {
+			queue = append(queue, i)
+		}
+	}
+
+	// position in the queue of the transaction to try next; transactions before
+	// it were set aside because they couldn't be funded yet
+	next := 0
+	seen := ledger.done()
+
+	// latency: when the account started on each transaction and how long it
+	// waited for the CS for it
+	started := make(map[int]time.Time)
+	csWait := make(map[int]time.Duration)
+	var strikes breaker
+
+	for len(queue) > 0 {
+		if next == len(queue) {
+			// every remaining transaction was set aside: wait for money to come
+			// in or dependencies to complete and go back to the earliest one
+			run.setActivity(account.ID(), "set aside", transactions[queue[0]].ID)
+			ledger.waitForTransactionDone(seen)
+			seen = ledger.done()
+			next = 0
+		}
+
+		// the transactions set aside before this one; those of the system
+		// lane yielding to it aren't
+		ahead := next
+		next = run.yieldTo(queue, next)
+		transaction := transactions[queue[next]]
+		run.coolDown(account.ID(), &strikes, transaction.ID)
+		if _, ok := started[queue[next]]; !ok {
+			run.awaitArrival(account.ID(), transaction)
+			started[queue[next]] = run.clock.Now()
+		}
+		if ledger.state(transaction.ID) == failed {
+			// the watchdog gave up on the transaction
+			queue = append(queue[:next], queue[next+1:]...)
+			continue
+		}
+
+		switch ledger.dependencyState(transaction) {
+		case failed:
+			run.recordFailure("dependency failed", transaction)
+			run.share(account.ID(), "failure", transaction.ID)
+			strikes.fail("dependency failed")
+			queue = append(queue[:next], queue[next+1:]...)
+			continue
+		case pending:
+			if !strategy.OutOfOrder() {
+				run.setActivity(account.ID(), "dependencies", transaction.ID)
+				ledger.waitForTransactionDone(seen)
+				seen = ledger.done()
+				continue
+			}
+			next++
+			continue
+		}
+
+		if !ledger.CanFund(transaction) {
+			run.recordFundingWait(strategy.Name())
+			run.setActivity(account.ID(), "funds", transaction.ID)
+			switch strategy.Unfunded(ledger, transaction) {
+			case DeferTransaction:
+				next++
+				continue
+			case FailTransaction:
+				run.recordFailure("insufficient funds", transaction)
+				run.share(account.ID(), "failure", transaction.ID)
+				strikes.fail("insufficient funds")
+				queue = append(queue[:next], queue[next+1:]...)
+				continue
+			}
+		}
+
+		run.setActivity(account.ID(), "cs", transaction.ID)
+		asked := run.clock.Now()
+		run.gate.RLock()
+		if run.network.HasLeft(account.ID()) {
+			// the account left the network while waiting at the gate, and its
+			// transactions failed with it
+			run.gate.RUnlock()
+			continue
+		}
+		run.enterCS(account, transaction)
+		entered := run.clock.Now()
+		csWait[queue[next]] += entered.Sub(asked)
+		run.setActivity(account.ID(), "in cs", transaction.ID)
+		if run.slowCS(entered.Sub(asked)) {
+			strikes.fail(fmt.Sprintf("waited %s for the CS", entered.Sub(asked).Round(time.Millisecond)))
+		}
+
+		if !ledger.CanFund(transaction) || ledger.state(transaction.ID) == failed {
+			// the money can still shrink through an allowed negative transfer,
+			// and the watchdog may have given up on the transaction
+			if ledger.state(transaction.ID) != failed {
+				strikes.fail("the money was gone in the CS")
+			}
+			run.exitCS(account)
+			run.gate.RUnlock()
+			run.setActivity(account.ID(), "idle", transaction.ID)
+			continue
+		}
+
+		if run.commitTransfer(transaction) {
+			run.recordLatency(account.ID(), transaction.Lane, csWait[queue[next]], run.clock.Since(started[queue[next]]))
+			if !run.slowCS(entered.Sub(asked)) {
+				strikes.succeed()
+			}
+		} else {
+			strikes.fail("overflow")
+		}
+		if ahead > 0 {
+			atomic.AddInt64(&run.outOfOrder, 1)
+		}
+		queue = append(queue[:next], queue[next+1:]...)
+		next = 0
+
+		// coalescing: run the following transactions that are ready right away
+		// without releasing the CS
+		whileWaiting := 0
+		for {
+			keep, waiting := run.keepCS(account, queue, transaction, entered, whileWaiting)
+			if !keep {
+				break
+			}
+			start := run.clock.Now()
+			transaction = transactions[queue[0]]
+			first, ok := started[queue[0]]
+			if !ok {
+				first = start
+			}
+			if run.commitTransfer(transaction) {
+				run.recordLatency(account.ID(), transaction.Lane, 0, run.clock.Since(first))
+			}
+			queue = queue[1:]
+
+			atomic.AddInt64(&run.coalesced, 1)
+			if waiting > 0 {
+				// every waiting account takes our permission when served, so
+				// entering again would have cost a request and an approval each
+				whileWaiting++
+				atomic.AddInt64(&run.coalesceSaved, int64(2*waiting))
+				atomic.AddInt64(&run.coalesceWait, int64(waiting)*run.clock.Since(start).Microseconds())
+			}
+		}
+		run.exitCS(account)
+		run.gate.RUnlock()
+		run.setActivity(account.ID(), "idle", transaction.ID)
+		seen = ledger.done()
+
+		if transaction.Pause > 0 {
+			if run.config.Prefetch && len(queue) > 0 {
+				// the next transaction is known, so the approvals can come in
+				// while the account pauses
+				run.gate.RLock()
+				if !run.network.HasLeft(account.ID()) {
+					account.Prefetch()
+				}
+				run.gate.RUnlock()
+			}
+			run.setActivity(account.ID(), "pause", transaction.ID)
+			run.clock.Sleep(time.Duration(transaction.Pause) * time.Millisecond)
+		}
+	}
+
+	if run.config.Archive && !run.network.HasLeft(account.ID()) {
+		run.switching.Add(1)
+		go run.archive(account.ID())
+	}
+}
+
+func (run *Simulation) commitTransfer(transaction Transaction) bool {
+	start := run.clock.Now()
+	if !run.register(transaction) {
+		run.share(transaction.From, "failure", transaction.ID)
+		return false
+	}
+	run.share(transaction.From, "commit", transaction.ID)
+	run.costs.spent(transaction.From, costLedger, run.clock.Since(start))
+	run.committed()
+	return true
+}
+
+func (run *Simulation) keepCS(account *mutex.Account, queue []int, last Transaction, entered time.Time, whileWaiting int) (bool, int) {
+	// decide whether the account keeps the CS for the first transaction of
+	// its queue, which must be ready right away, and return how many other
+	// accounts are waiting for the CS
+	hold := run.config.CoalesceHold
+	if hold <= 0 || len(queue) == 0 || last.Pause > 0 || run.clock.Since(entered) >= hold {
+		return false, 0
+	}
+	transaction := run.transactions[queue[0]]
+	if run.ledger.dependencyState(transaction) != committed || !run.ledger.CanFund(transaction) {
+		return false, 0
+	}
+	if run.config.Resources && transaction.To != last.To {
+		// resource mode: the CS is only held for the accounts of the last
+		// transfer
+		return false, 0
+	}
+
+	// fairness guard: only a few transactions are added while others wait
+	waiting := account.Waiting()
+	if waiting > 0 && whileWaiting >= run.config.CoalesceWaiting {
+		return false, 0
+	}
+	return true, waiting
+}
+
+func (run *Simulation) verifyOrdering() int {
+	// check that every committed transaction was committed after the
+	// transactions it depends on and return the number of violations
+	violations := 0
+	for _, transaction := range run.transactions {
+		position, ok := run.ledger.commitPosition(transaction.ID)
+		if !ok {
+			continue
+		}
+		for _, id := range transaction.After {
+			if dependency, ok := run.ledger.commitPosition(id); !ok || dependency > position {
+				fmt.Fprintf(run.config.Output, "Ordering violation: transaction %d was committed before transaction %d\n", transaction.ID, id)
+				violations++
+			}
+		}
+	}
+	return violations
+}
+
+// WriteFinalBalances writes the balance of every account, one "id,balance"
+// line per account
+func (run *Simulation) WriteFinalBalances(name string) error {
+	file, err := run.config.Storage.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	balances := run.ledger.Balances()
+	for i := 0; i < run.scenario.Accounts; i++ {
+		total_money := balances[i]
+		fmt.Fprintf(file, "%d,%s\n", i, total_money)
+	}
+	return nil
+}
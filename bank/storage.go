@@ -0,0 +1,157 @@
+package bank
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Storage is the file access of a run: reading the test folder and writing
+// logs, final balances, metrics and events
+type Storage interface {
+	Open(name string) (io.ReadCloser, error)
+	Create(name string) (io.WriteCloser, error)
+	Append(name string) (io.WriteCloser, error)
+	Remove(name string) error
+}
+
+// DiskStorage accesses files on disk relative to the working directory
+type DiskStorage struct{}
+
+func (DiskStorage) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (DiskStorage) Create(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+func (DiskStorage) Append(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
+
+func (DiskStorage) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// OutputStorage reads files through the storage it wraps and writes them under
+// Dir, so runs with different output directories don't overwrite each other's
+// logs, balances and metrics. Absolute names are written where they point.
+type OutputStorage struct {
+	Storage
+	Dir string
+}
+
+func (storage OutputStorage) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(storage.Dir, name)
+}
+
+func (storage OutputStorage) Create(name string) (io.WriteCloser, error) {
+	return storage.Storage.Create(storage.path(name))
+}
+
+func (storage OutputStorage) Append(name string) (io.WriteCloser, error) {
+	return storage.Storage.Append(storage.path(name))
+}
+
+func (storage OutputStorage) Remove(name string) error {
+	return storage.Storage.Remove(storage.path(name))
+}
+
+// MemoryStorage keeps written files in memory; files that were never written
+// are read from the optional base file system, so a test folder can come from
+// an embed.FS or fstest.MapFS without touching the disk
+type MemoryStorage struct {
+	mutex sync.Mutex
+	files map[string][]byte
+	base  fs.FS
+}
+
+func NewMemoryStorage(base fs.FS) *MemoryStorage {
+	return &MemoryStorage{files: make(map[string][]byte), base: base}
+}
+
+func memoryName(name string) string {
+	// file names are kept in the unrooted slash-separated form used by io/fs
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+}
+
+func (storage *MemoryStorage) Open(name string) (io.ReadCloser, error) {
+	name = memoryName(name)
+	storage.mutex.Lock()
+	data, ok := storage.files[name]
+	storage.mutex.Unlock()
+	if ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	if storage.base != nil {
+		return storage.base.Open(name)
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (storage *MemoryStorage) Create(name string) (io.WriteCloser, error) {
+	name = memoryName(name)
+	storage.mutex.Lock()
+	storage.files[name] = []byte{}
+	storage.mutex.Unlock()
+	return &memoryFile{storage: storage, name: name}, nil
+}
+
+func (storage *MemoryStorage) Append(name string) (io.WriteCloser, error) {
+	name = memoryName(name)
+	storage.mutex.Lock()
+	if _, ok := storage.files[name]; !ok {
+		storage.files[name] = []byte{}
+	}
+	storage.mutex.Unlock()
+	return &memoryFile{storage: storage, name: name}, nil
+}
+
+func (storage *MemoryStorage) Remove(name string) error {
+	name = memoryName(name)
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	if _, ok := storage.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(storage.files, name)
+	return nil
+}
+
+func (storage *MemoryStorage) ReadFile(name string) ([]byte, error) {
+	// return a copy of a file written during the run
+	name = memoryName(name)
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	data, ok := storage.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// memoryFile appends the written bytes to a file of a MemoryStorage
+type memoryFile struct {
+	storage *MemoryStorage
+	name    string
+}
+
+func (file *memoryFile) Write(data []byte) (int, error) {
+	file.storage.mutex.Lock()
+	defer file.storage.mutex.Unlock()
+	file.storage.files[file.name] = append(file.storage.files[file.name], data...)
+	return len(data), nil
+}
+
+func (file *memoryFile) Close() error {
+	return nil
+}
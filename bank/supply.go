@@ -0,0 +1,139 @@
+package bank
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// supply follows the balances through the transfer events: the money held by
+// the accounts and the money they should hold, the opening balances plus what
+// the bank paid in net. The two only part if money is created or lost.
+type supply struct {
+	balances map[int]Money
+	expected Money
+	start    time.Time
+}
+
+func newSupply(balances map[int]Money) supply {
+	current := supply{balances: make(map[int]Money)}
+	for id, balance := range balances {
+		current.balances[id] = balance
+		current.expected += balance
+	}
+	return current
+}
+
+func (current *supply) apply(event Event) bool {
+	if event.Kind != "transfer" {
+		return false
+	}
+	if current.start.IsZero() {
+		current.start = event.Time
+	}
+	current.balances[event.Account] -= event.Amount
+	current.balances[event.Peer] += event.Amount
+	if event.Account == Bank {
+		current.expected += event.Amount
+	}
+	if event.Peer == Bank {
+		current.expected -= event.Amount
+	}
+	return true
+}
+
+func (current *supply) row(at time.Time, accounts int) string {
+	// the CSV line of the time series: milliseconds since the first transfer,
+	// the money held, the money expected and the balance of every account
+	var total Money
+	fields := make([]string, 0, accounts+3)
+	for id := 0; id < accounts; id++ {
+		total += current.balances[id]
+		fields = append(fields, current.balances[id].String())
+	}
+	ms := float64(at.Sub(current.start).Microseconds()) / 1000
+	return fmt.Sprintf("%.3f,%s,%s,%s", ms, total, current.expected, strings.Join(fields, ","))
+}
+
+func supplyHeader(accounts int) string {
+	fields := []string{"ms", "supply", "expected"}
+	for id := 0; id < accounts; id++ {
+		fields = append(fields, fmt.Sprintf("balance_%d", id))
+	}
+	return strings.Join(fields, ",")
+}
+
+// SupplySink writes the money supply and the balance of every account after
+// each transfer, as CSV lines over the time of the run, so a plot shows when
+// and where the balances diverged
+type SupplySink struct {
+	mutex    sync.Mutex
+	file     io.WriteCloser
+	accounts int
+	supply   supply
+}
+
+// NewSupplySink starts the time series of the given number of accounts and
+// their opening balances (which may be nil)
+func NewSupplySink(storage Storage, name string, accounts int, balances map[int]Money) (*SupplySink, error) {
+	file, err := storage.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(file, supplyHeader(accounts))
+	return &SupplySink{file: file, accounts: accounts, supply: newSupply(balances)}, nil
+}
+
+func (sink *SupplySink) Emit(event Event) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if sink.supply.apply(event) {
+		fmt.Fprintln(sink.file, sink.supply.row(event.Time, sink.accounts))
+	}
+}
+
+func (sink *SupplySink) Close() error {
+	return sink.file.Close()
+}
+
+// SupplyProjection is the time series of SupplySink rebuilt from an event
+// log, for the accounts seen in it; the opening balances aren't in the log, so
+// the series starts from 0
+type SupplyProjection struct {
+	supply supply
+	rows   []supplyRow
+}
+
+type supplyRow struct {
+	at       time.Time
+	balances map[int]Money
+	expected Money
+}
+
+func (projection *SupplyProjection) Apply(event Event) {
+	if projection.supply.balances == nil {
+		projection.supply = newSupply(nil)
+	}
+	if !projection.supply.apply(event) {
+		return
+	}
+	balances := make(map[int]Money, len(projection.supply.balances))
+	for id, balance := range projection.supply.balances {
+		balances[id] = balance
+	}
+	projection.rows = append(projection.rows, supplyRow{at: event.Time, balances: balances, expected: projection.supply.expected})
+}
+
+func (projection *SupplyProjection) Report(w io.Writer) {
+	accounts := 0
+	for id := range projection.supply.balances {
+		accounts = max(accounts, id+1)
+	}
+	fmt.Fprintln(w, supplyHeader(accounts))
+	for _, row := range projection.rows {
+		current := supply{balances: row.balances, expected: row.expected, start: projection.supply.start}
+		fmt.Fprintln(w, current.row(row.at, accounts))
+	}
+}
@@ -0,0 +1,102 @@
+package bank
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// Phase is the part of a run under one algorithm when the run switches
+// algorithms
+type Phase struct {
+	Algorithm  string         `json:"algorithm"`
+	Committed  int            `json:"committed"`
+	Messages   int64          `json:"messages"`
+	Duration   int64          `json:"durationMs"`
+	CSWait     LatencySummary `json:"csWaitMs"`
+	Latency    LatencySummary `json:"latencyMs"`
+	Throughput float64        `json:"csThroughputPerSec"`
+	Drain      int64          `json:"drainUs,omitempty"` // how long the switch waited for the CS to be free
+}
+
+func (run *Simulation) committed() {
+	// count a transaction committed in this run, switch algorithms once
+	// Config.SwitchAfter were committed and change the membership when due
+	count := atomic.AddInt64(&run.commits, 1)
+	if run.config.SwitchTo != "" && count == int64(run.config.SwitchAfter) {
+		run.switching.Add(1)
+		go run.switchAlgorithm()
+	}
+	for _, change := range run.scenario.Membership {
+		if int64(change.After) == count {
+			run.switching.Add(1)
+			go run.changeMembership(int(count))
+			break
+		}
+	}
+}
+
+func (run *Simulation) switchAlgorithm() {
+	// drain: wait for the accounts inside or asking for the CS to release it,
+	// while the others wait at the gate until the network switched
+	defer run.switching.Done()
+	asked := run.clock.Now()
+	run.gate.Lock()
+	defer run.gate.Unlock()
+	run.switched = run.clock.Now()
+	run.drain = run.switched.Sub(asked)
+	run.beforeSwitch = run.network.Counters()
+	if err := run.network.SwitchAlgorithm(run.config.SwitchTo); err != nil {
+		fmt.Fprintln(run.config.Output, "Error switching algorithm:", err)
+		run.switched = time.Time{}
+		return
+	}
+	run.emit(Event{Kind: "switch", Account: -1, Peer: -1, Reason: string(run.config.SwitchTo)})
+	fmt.Fprintf(run.config.Output, "Switched from %s to %s after %d transactions (drained in %s)\n", run.config.Algorithm, run.config.SwitchTo, run.config.SwitchAfter, run.drain)
+}
+
+func totalMessages(counters mutex.Counters) int64 {
+	return counters.Requests + counters.Approvals + counters.Revokes + counters.GivenBack + counters.TokenPasses + counters.Retries + counters.Resent + counters.Boosts
+}
+
+func (run *Simulation) phases() []Phase {
+	// the metrics before and after the switch, over the whole run
+	if run.switched.IsZero() {
+		return nil
+	}
+	run.latencies_mutex.Lock()
+	before := make([]latencySample, 0)
+	after := make([]latencySample, 0)
+	for _, sample := range run.latencies {
+		if sample.commit.Before(run.switched) {
+			before = append(before, sample)
+		} else {
+			after = append(after, sample)
+		}
+	}
+	run.latencies_mutex.Unlock()
+
+	end := run.start.Add(time.Duration(run.duration) * time.Millisecond)
+	phase := func(algorithm mutex.Algorithm, samples []latencySample, messages int64, duration time.Duration) Phase {
+		csWait, latency, _ := latencyMetrics(laneSamples(samples, LaneUser))
+		throughput := 0.0
+		if duration > 0 {
+			throughput = float64(len(samples)) / duration.Seconds()
+		}
+		return Phase{
+			Algorithm:  string(algorithm),
+			Committed:  len(samples),
+			Messages:   messages,
+			Duration:   duration.Milliseconds(),
+			CSWait:     csWait,
+			Latency:    latency,
+			Throughput: throughput,
+		}
+	}
+	first := phase(run.config.Algorithm, before, totalMessages(run.beforeSwitch), run.switched.Sub(run.start))
+	second := phase(run.config.SwitchTo, after, totalMessages(run.network.Counters())-totalMessages(run.beforeSwitch), end.Sub(run.switched))
+	second.Drain = run.drain.Microseconds()
+	return []Phase{first, second}
+}
@@ -0,0 +1,323 @@
+package bank
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+type Transaction struct {
+	// a transfer executed by an account while it is in the critical section,
+	// or an operation on that account alone (To is then the bank)
+	Op     string
+	From   int
+	Amount Money
+	To     int
+	// pause of the account after the transfer, in milliseconds
+	Pause int
+	// replayed workloads only: when the transaction arrives, from the start of
+	// the run
+	Arrival time.Duration
+	// position of the transaction in the transactions file, used as its ID
+	ID int
+	// IDs of earlier transactions that must be committed before this one
+	After []int
+	// LaneUser or LaneSystem
+	Lane string
+	// reason the transaction can't be executed, found while loading it
+	failure string
+}
+
+// Bank is the account funding the other accounts in the transactions file
+const Bank = -1
+
+// Scenario is a test folder: the accounts with their quorums and opening
+// balances and the transactions to run, which may start with funding
+// transactions from the bank
+type Scenario struct {
+	Folder       string
+	Accounts     int
+	Quorums      [][]int
+	Groups       [][]int            // hybrid mode (non-nil) only: co-located accounts
+	Balances     map[int]Money      // opening balances from balances.txt, nil without it
+	Membership   []MembershipChange // accounts joining or leaving mid-run, by the transactions committed before
+	Chaos        []ChaosExperiment  // faults injected mid-run and the invariants expected to hold
+	Funding      int                // number of leading transactions from the bank
+	Transactions []Transaction
+	Warnings     []string // lines of the folder skipped or read with a default, printed when the run starts
+}
+
+func LoadScenario(storage Storage, folder_name string) (*Scenario, error) {
+	scenario, err := readScenario(storage, folder_name)
+	if err != nil {
+		return nil, err
+	}
+	if err := mutex.ValidateQuorums(scenario.Quorums); err != nil {
+		return nil, fmt.Errorf("%s/quorum.txt: %v", folder_name, err)
+	}
+	return scenario, nil
+}
+
+func readScenario(storage Storage, folder_name string) (*Scenario, error) {
+	// read a test folder without checking its quorums, which Lint reports on
+
+	// Open the transactions file
+	file, err := storage.Open(folder_name + "/transactions.txt")
+	if err != nil {
+		// Try with Spanish filename if English one doesn't exist
+		file, err = storage.Open(folder_name + "/transacciones.txt")
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer file.Close()
+
+	// Create a scanner to read the file line by line
+	scanner := bufio.NewScanner(file)
+
+	// Read the first line containing the number of accounts and transactions
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("%s: empty transactions file", folder_name)
+	}
+	firstLine := scanner.Text()
+	parts := strings.Split(firstLine, ",")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%s: invalid header %q", folder_name, firstLine)
+	}
+	n_accounts, _ := strconv.Atoi(parts[0])
+	m_transactions, _ := strconv.Atoi(parts[1])
+
+	// Create the transaction array
+	var transactions = make([]Transaction, 0, m_transactions)
+	warnings := make([]string, 0)
+	warn := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	// Read the rest of the lines containing the transactions
+	i := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		parts := strings.Split(line, ",")
+		if len(parts) < 4 {
+			warn("Incorrect transaction format: %s", line)
+			continue
+		}
+		op := Transfer
+		if IsOperation(parts[0]) {
+			// a single-account operation, op,account,amount,pause, has the
+			// bank on the other side
+			op = parts[0]
+			parts = append([]string{parts[1], parts[2], strconv.Itoa(Bank)}, parts[3:]...)
+		}
+		from, _ := strconv.Atoi(parts[0])
+		money, err := ParseMoney(parts[1])
+		failure := ""
+		if errors.Is(err, ErrMoneyOverflow) {
+			failure = "overflow"
+		} else if err != nil {
+			warn("Error parsing money: %v", err)
+		}
+		to, _ := strconv.Atoi(parts[2])
+		pause, _ := strconv.Atoi(parts[3])
+
+		// optional fifth field: IDs of earlier transactions separated by ';'
+		after := make([]int, 0)
+		if len(parts) > 4 && parts[4] != "" {
+			for _, dependency := range strings.Split(parts[4], ";") {
+				id, err := strconv.Atoi(dependency)
+				if err != nil || id < 0 || id >= i {
+					warn("Invalid dependency %q of transaction %d", dependency, i)
+					failure = "invalid dependency"
+					continue
+				}
+				after = append(after, id)
+			}
+		}
+
+		// optional sixth field: the lane, user (the default) or system
+		lane := LaneUser
+		if len(parts) > 5 {
+			var ok bool
+			if lane, ok = parseLane(parts[5]); !ok {
+				warn("Invalid lane %q of transaction %d", parts[5], i)
+				failure = "invalid lane"
+			}
+		}
+
+		transactions = append(transactions, Transaction{
+			Op:     op,
+			From:   from,
+			To:     to,
+			Amount: money,
+			Pause:  pause,
+			ID:     i,
+			After:  after,
+			Lane:   lane,
+
+			failure: failure,
+		})
+
+		i++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	balances, err := readBalances(storage, folder_name, n_accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	funding := 0
+	for funding < len(transactions) && transactions[funding].From == Bank {
+		funding++
+	}
+
+	membership, err := readMembership(storage, folder_name, n_accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	chaos, err := readChaos(storage, folder_name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Scenario{
+		Folder:       folder_name,
+		Accounts:     n_accounts,
+		Quorums:      readQuorums(storage, folder_name, n_accounts, warn),
+		Balances:     balances,
+		Membership:   membership,
+		Chaos:        chaos,
+		Funding:      funding,
+		Transactions: transactions,
+		Warnings:     warnings,
+	}, nil
+}
+
+func readBalances(storage Storage, folder_name string, n_accounts int) (map[int]Money, error) {
+	// Read the optional opening balances from balances.txt, one "id,amount"
+	// line per account as in final.txt
+	file, err := storage.Open(folder_name + "/balances.txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	balances := make(map[int]Money)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		id_str, money_str, _ := strings.Cut(line, ",")
+		id, err := strconv.Atoi(id_str)
+		if err != nil || id < 0 || id >= n_accounts {
+			return nil, fmt.Errorf("%s/balances.txt: invalid account in %q", folder_name, line)
+		}
+		money, err := ParseMoney(money_str)
+		if err != nil {
+			return nil, fmt.Errorf("%s/balances.txt: %v", folder_name, err)
+		}
+		balances[id] = money
+	}
+	return balances, scanner.Err()
+}
+
+func readQuorums(storage Storage, folder_name string, n_accounts int, warn func(format string, args ...any)) [][]int {
+	// Read quorums from quorum.txt
+	quorums := make([][]int, n_accounts)
+
+	// Open the quorum file
+	file, err := storage.Open(folder_name + "/quorum.txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		// without a quorum file, generate √N quorums
+		return mutex.MaekawaQuorums(n_accounts)
+	}
+	if err != nil {
+		warn("Error opening quorum file: %v", err)
+		// If quorum file can't be read, create default quorums (all accounts need to approve)
+		return mutex.FullQuorums(n_accounts)
+	}
+	defer file.Close()
+
+	// Create a scanner to read the file line by line
+	scanner := bufio.NewScanner(file)
+
+	// Read quorums for each account
+	for i := 0; i < n_accounts; i++ {
+		if !scanner.Scan() {
+			warn("Error reading quorum for account %d", i)
+			// If quorum is not specified, default to all accounts
+			quorums[i] = make([]int, n_accounts)
+			for j := 0; j < n_accounts; j++ {
+				quorums[i][j] = j
+			}
+			continue
+		}
+
+		line := scanner.Text()
+		parts := strings.Split(line, ",")
+		quorum := make([]int, len(parts))
+		for j, part := range parts {
+			quorum[j], _ = strconv.Atoi(part)
+		}
+		quorums[i] = quorum
+	}
+
+	if err := scanner.Err(); err != nil {
+		warn("Error reading quorum file: %v", err)
+	}
+
+	return quorums
+}
+
+// LoadGroups reads the groups of co-located accounts from groups.txt, one
+// group per line, and returns them with the lines it skipped; the scenario
+// prints those when the run starts, like its own warnings
+func LoadGroups(storage Storage, folder_name string, n_accounts int) ([][]int, []string) {
+	warnings := make([]string, 0)
+	file, err := storage.Open(folder_name + "/groups.txt")
+	if err != nil {
+		return nil, append(warnings, fmt.Sprintf("Error opening groups file: %v", err))
+	}
+	defer file.Close()
+
+	groups := make([][]int, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		group := make([]int, 0)
+		for _, part := range strings.Split(line, ",") {
+			id, err := strconv.Atoi(part)
+			if err != nil || id < 0 || id >= n_accounts {
+				warnings = append(warnings, "Invalid account in groups file: "+part)
+				continue
+			}
+			group = append(group, id)
+		}
+		groups = append(groups, group)
+	}
+
+	if err := scanner.Err(); err != nil {
+		warnings = append(warnings, fmt.Sprintf("Error reading groups file: %v", err))
+	}
+
+	return groups, warnings
+}
@@ -0,0 +1,67 @@
+package bank
+
+import "fmt"
+
+// Policies for transactions the protocol can run but that are usually input
+// mistakes: "reject" drops and reports them, "ignore" drops them silently and
+// "allow" executes them as written
+const (
+	Reject = "reject"
+	Ignore = "ignore"
+	Allow  = "allow"
+)
+
+func ValidPolicy(policy string) bool {
+	return policy == Reject || policy == Ignore || policy == Allow
+}
+
+// ValidationReport counts the transactions matched by each policy
+type ValidationReport struct {
+	SelfTransfers   int `json:"selfTransfers"`
+	ZeroAmounts     int `json:"zeroAmounts"`
+	NegativeAmounts int `json:"negativeAmounts"`
+	Rejected        int `json:"rejected"`
+	Ignored         int `json:"ignored"`
+}
+
+func (run *Simulation) validateTransactions(transactions []Transaction, n_funding int) []Transaction {
+	// apply the self-transfer and amount policies to the transfers following
+	// the initial funding of the accounts
+	if n_funding > len(transactions) {
+		return transactions
+	}
+	valid := transactions[:n_funding:n_funding]
+	for i := n_funding; i < len(transactions); i++ {
+		transaction := transactions[i]
+		if transaction.failure != "" {
+			run.recordFailure(transaction.failure, transaction)
+			continue
+		}
+
+		policy, reason := Allow, ""
+		switch {
+		case transaction.From == transaction.To:
+			run.validation.SelfTransfers++
+			policy, reason = run.config.SelfTransfer, "self-transfer"
+		case transaction.Amount == 0:
+			run.validation.ZeroAmounts++
+			policy, reason = run.config.ZeroAmount, "zero amount"
+		case transaction.Amount < 0 && transaction.Op != BalanceAdjustment:
+			run.validation.NegativeAmounts++
+			policy, reason = run.config.NegativeAmount, "negative amount"
+		}
+
+		switch policy {
+		case Reject:
+			run.validation.Rejected++
+			run.ledger.MarkFailed(transaction.ID)
+			fmt.Fprintf(run.config.Output, "Rejected transaction %d (%s): %s\n", transaction.ID, reason, transaction)
+		case Ignore:
+			run.validation.Ignored++
+			run.ledger.MarkFailed(transaction.ID)
+		default:
+			valid = append(valid, transaction)
+		}
+	}
+	return valid
+}
@@ -0,0 +1,246 @@
+package bank
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// Crash recovery: with a write-ahead log, the outcome of every transaction is
+// appended to the log and synced to disk before any account sees it, so a run
+// killed at any point can be resumed from the outcomes it logged. A snapshot
+// taken every so often records the last transaction each account got done and
+// its Lamport clock; resuming applies the logged outcomes and moves the clocks
+// past the snapshot, and the accounts go on with their remaining transactions.
+
+// walRecord is one line of the write-ahead log
+type walRecord struct {
+	Kind     string    `json:"kind"` // commit, failure or postings
+	ID       int       `json:"id"`
+	Postings []Posting `json:"postings,omitempty"` // a committed ledger transaction
+}
+
+// WALSnapshot is where the accounts of this process were when it was taken
+type WALSnapshot struct {
+	Time      time.Time   `json:"time"`
+	Folder    string      `json:"folder"`
+	Algorithm string      `json:"algorithm"`
+	Records   int         `json:"records"`   // outcomes in the write-ahead log then
+	Positions map[int]int `json:"positions"` // the last transaction each account got done (last_message_id)
+	Clocks    map[int]int `json:"clocks"`    // the Lamport clock of each account
+}
+
+// writeAheadLog appends the outcomes to a file, syncing each of them
+type writeAheadLog struct {
+	file    io.WriteCloser
+	records int
+	output  io.Writer // where the errors of the writes are reported
+}
+
+func (ledger *Ledger) openWAL(storage Storage, name string, resume bool, output io.Writer) error {
+	// start a new log, or continue the log of the run we resume
+	var file io.WriteCloser
+	var err error
+	if resume {
+		file, err = storage.Append(name)
+	} else {
+		file, err = storage.Create(name)
+	}
+	if err != nil {
+		return err
+	}
+	ledger.funding_mutex.Lock()
+	defer ledger.funding_mutex.Unlock()
+	ledger.wal = &writeAheadLog{file: file, output: output}
+	return nil
+}
+
+func (wal *writeAheadLog) append(kind string, id int) {
+	// log an outcome; the caller holds the ledger's lock, so the log follows
+	// the order the outcomes are applied in
+	wal.write(walRecord{Kind: kind, ID: id})
+}
+
+func (wal *writeAheadLog) appendPostings(postings []Posting) {
+	wal.write(walRecord{Kind: "postings", Postings: postings})
+}
+
+func (wal *writeAheadLog) write(record walRecord) {
+	if wal == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if _, err := wal.file.Write(append(data, '\n')); err != nil {
+		fmt.Fprintln(wal.output, "Error writing the write-ahead log:", err)
+		return
+	}
+	if err := syncFile(wal.file); err != nil {
+		fmt.Fprintln(wal.output, "Error syncing file:", err)
+	}
+	wal.records++
+}
+
+func (wal *writeAheadLog) close() error {
+	if wal == nil {
+		return nil
+	}
+	return wal.file.Close()
+}
+
+func syncFile(file io.Writer) error {
+	// flush a file to disk when it is backed by one
+	if syncer, ok := file.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+func (run *Simulation) walSnapshot() WALSnapshot {
+	run.ledger.funding_mutex.Lock()
+	records := 0
+	if run.ledger.wal != nil {
+		records = run.ledger.wal.records
+	}
+	positions := make(map[int]int)
+	for _, transaction := range run.transactions {
+		if transaction.From != Bank && run.network.IsLocal(transaction.From) && run.ledger.transactionState[transaction.ID] != pending {
+			positions[transaction.From] = transaction.ID
+		}
+	}
+	run.ledger.funding_mutex.Unlock()
+
+	clocks := make(map[int]int)
+	for id := 0; id < run.network.Len(); id++ {
+		if run.network.IsLocal(id) {
+			clocks[id] = run.network.Clock(id)
+		}
+	}
+	return WALSnapshot{
+		Time:      run.clock.Now(),
+		Folder:    run.scenario.Folder,
+		Algorithm: string(run.config.Algorithm),
+		Records:   records,
+		Positions: positions,
+		Clocks:    clocks,
+	}
+}
+
+func (run *Simulation) writeWALSnapshot() {
+	file, err := run.config.Storage.Create(run.config.WALSnapshot)
+	if err != nil {
+		fmt.Fprintln(run.config.Output, "Error writing the snapshot:", err)
+		return
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(run.walSnapshot()); err != nil {
+		fmt.Fprintln(run.config.Output, "Error writing the snapshot:", err)
+		return
+	}
+	if err := syncFile(file); err != nil {
+		fmt.Fprintln(run.config.Output, "Error syncing file:", err)
+	}
+}
+
+func (run *Simulation) walSnapshotEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := run.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			run.writeWALSnapshot()
+		case <-done:
+			return
+		}
+	}
+}
+
+// LoadWAL reads back the write-ahead log of a run and its latest snapshot as
+// the checkpoint to resume from. A record torn by the crash ends the log, and
+// a snapshot that can't be read only loses the clocks; both are noted in the
+// warnings of the checkpoint, printed when it is restored. The checkpoint is
+// stamped with the time of the clock of the run (the wall clock when nil).
+func LoadWAL(storage Storage, name string, snapshotName string, clock mutex.Clock) (*Checkpoint, error) {
+	if clock == nil {
+		clock = mutex.RealClock{}
+	}
+	file, err := storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	checkpoint := &Checkpoint{Time: clock.Now(), Committed: make([]int, 0), Failed: make([]int, 0)}
+	seen := make(map[int]bool)
+	records := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			checkpoint.Warnings = append(checkpoint.Warnings, fmt.Sprintf("%s: ignoring the log after record %d: %v", name, records, err))
+			break
+		}
+		records++
+		if record.Kind == "postings" {
+			checkpoint.Postings = append(checkpoint.Postings, record.Postings)
+			continue
+		}
+		if seen[record.ID] {
+			continue
+		}
+		seen[record.ID] = true
+		switch record.Kind {
+		case "commit":
+			checkpoint.Committed = append(checkpoint.Committed, record.ID)
+		case "failure":
+			checkpoint.Failed = append(checkpoint.Failed, record.ID)
+		default:
+			return nil, fmt.Errorf("%s: record %d: unknown kind %q", name, records, record.Kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	sort.Ints(checkpoint.Failed)
+
+	snapshotFile, err := storage.Open(snapshotName)
+	if err != nil {
+		return checkpoint, nil
+	}
+	defer snapshotFile.Close()
+	var snapshot WALSnapshot
+	if err := json.NewDecoder(snapshotFile).Decode(&snapshot); err != nil {
+		checkpoint.Warnings = append(checkpoint.Warnings, fmt.Sprintf("%s: ignoring the snapshot: %v", snapshotName, err))
+		return checkpoint, nil
+	}
+	if snapshot.Records > records {
+		checkpoint.Warnings = append(checkpoint.Warnings, fmt.Sprintf("%s: the snapshot saw %d outcomes but the log has %d", snapshotName, snapshot.Records, records))
+	}
+	for account, id := range snapshot.Positions {
+		if !seen[id] {
+			checkpoint.Warnings = append(checkpoint.Warnings, fmt.Sprintf("%s: participant %d got transaction %d done, which the log lacks", snapshotName, account, id))
+		}
+	}
+	checkpoint.Folder = snapshot.Folder
+	checkpoint.Algorithm = snapshot.Algorithm
+	checkpoint.Clocks = snapshot.Clocks
+	return checkpoint, nil
+}
+
+func (run *Simulation) startWAL() {
+	if err := run.ledger.openWAL(run.config.Storage, run.config.WAL, run.config.Resume, run.config.Output); err != nil {
+		fmt.Fprintln(run.config.Output, "Error opening the write-ahead log:", err)
+		return
+	}
+	if run.config.Resume && run.config.Restore != nil {
+		// the outcomes of the earlier run are in the log already
+		run.ledger.wal.records = len(run.config.Restore.Committed) + len(run.config.Restore.Failed) + len(run.config.Restore.Postings)
+	}
+}
@@ -0,0 +1,90 @@
+package bank
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+func TestResumeKeepsMutualExclusion(t *testing.T) {
+	// a run killed halfway resumes with the accounts that were done idle, and
+	// the quorum members they share with the others must still grant the CS
+	// to one account at a time
+	for _, algorithm := range []mutex.Algorithm{mutex.Optimized, mutex.Original} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			storage := NewMemoryStorage(os.DirFS(".."))
+			config := DefaultConfig()
+			config.Algorithm = algorithm
+			config.Clock = mutex.NewScaledClock(50)
+			config.Storage = storage
+			config.WAL = "wal.jsonl"
+			scenario, err := LoadScenario(storage, "tests/test_2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			NewSimulation(config, scenario).Run()
+
+			// the log as a crash would have left it, with half of the outcomes
+			log, err := storage.ReadFile("wal.jsonl")
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := bytes.SplitAfter(log, []byte("\n"))
+			resumed := NewMemoryStorage(os.DirFS(".."))
+			file, err := resumed.Create("wal.jsonl")
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Write(bytes.Join(lines[:len(lines)/2], nil))
+			file.Close()
+			checkpoint, err := LoadWAL(resumed, "wal.jsonl", "wal-snapshot.json", config.Clock)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			trace := &MemorySink{}
+			config.Storage = resumed
+			config.Resume = true
+			config.Restore = checkpoint
+			config.Sinks = []Sink{trace}
+			scenario, err = LoadScenario(resumed, "tests/test_2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			metrics := NewSimulation(config, scenario).Run()
+			if metrics.Restored == 0 {
+				t.Fatal("nothing restored from the write-ahead log")
+			}
+			report := CheckSafety(trace.Events(), scenario.Balances, 0)
+			if !report.Passed {
+				t.Fatalf("resumed run: %s", report)
+			}
+			if report.Entries == 0 {
+				t.Fatal("the resumed run didn't enter the CS")
+			}
+		})
+	}
+}
+
+func TestLoadWALWarnings(t *testing.T) {
+	// a record torn by the crash ends the log, and a snapshot ahead of the
+	// log is noted: both come back with the checkpoint instead of being
+	// printed
+	storage := NewMemoryStorage(fstest.MapFS{
+		"wal.jsonl":         {Data: []byte("{\"kind\":\"commit\",\"id\":4}\n{\"kind\":\"fail")},
+		"wal-snapshot.json": {Data: []byte(`{"records":3,"positions":{"0":4}}`)},
+	})
+	checkpoint, err := LoadWAL(storage, "wal.jsonl", "wal-snapshot.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoint.Committed) != 1 || checkpoint.Committed[0] != 4 {
+		t.Fatalf("committed %v, expected [4]", checkpoint.Committed)
+	}
+	if len(checkpoint.Warnings) != 2 {
+		t.Fatalf("warnings %q, expected the torn record and the snapshot", checkpoint.Warnings)
+	}
+}
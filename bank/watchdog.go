@@ -0,0 +1,145 @@
+package bank
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Watchdog actions on a run that stopped making progress
+const (
+	SkipStuck  = "skip"  // fail the transactions the accounts wait on for money or dependencies
+	AbortStuck = "abort" // end the run
+)
+
+// activity is what an account of this process is doing, for the watchdog
+type activity struct {
+	state       string // "idle", "funds", "dependencies", "set aside", "cs", "in cs", "pause", "breaker" or "done"
+	transaction int
+	since       time.Time
+}
+
+func (run *Simulation) setActivity(account int, state string, transaction int) {
+	// the time spent in the previous state goes to its cost category
+	now := run.clock.Now()
+	run.activity_mutex.Lock()
+	previous, ok := run.activity[account]
+	run.activity[account] = activity{state: state, transaction: transaction, since: now}
+	run.activity_mutex.Unlock()
+	if ok && previous.state != "done" {
+		run.costs.spent(account, costOf(previous.state), now.Sub(previous.since))
+	}
+}
+
+func (run *Simulation) watchdog(interval time.Duration, done <-chan struct{}) {
+	// no transaction committed or failed for the interval while no account was
+	// pausing between its transactions or cooling down: the run is stuck
+	ticker := run.clock.NewTicker(interval / 4)
+	defer ticker.Stop()
+	seen := run.ledger.done()
+	progress := run.clock.Now()
+	for {
+		select {
+		case <-ticker.C():
+		case <-done:
+			return
+		}
+		if now := run.ledger.done(); now != seen || run.pausing() {
+			seen = now
+			progress = run.clock.Now()
+			continue
+		}
+		if run.clock.Since(progress) < interval {
+			continue
+		}
+
+		stalled := run.clock.Since(progress).Round(time.Millisecond)
+		fmt.Fprintf(run.config.Output, "Watchdog: no progress for %s\n", stalled)
+		run.dump()
+		if run.config.WatchdogAction == AbortStuck || !run.skipStuck(seen) {
+			fmt.Fprintln(run.config.Output, "Watchdog: aborting the run")
+			run.abort(fmt.Sprintf("no progress for %s", stalled))
+		}
+		progress = run.clock.Now()
+	}
+}
+
+func (run *Simulation) timeOut(done <-chan struct{}) {
+	// the run took longer than Config.Timeout: dump its state and give up
+	timer := run.clock.NewTimer(run.config.Timeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+	case <-done:
+		return
+	}
+	fmt.Fprintf(run.config.Output, "Run timed out after %s\n", run.config.Timeout)
+	run.dump()
+	run.abort(fmt.Sprintf("timed out after %s", run.config.Timeout))
+}
+
+func (run *Simulation) pausing() bool {
+	run.activity_mutex.Lock()
+	defer run.activity_mutex.Unlock()
+	for _, current := range run.activity {
+		if current.state == "pause" || current.state == "breaker" {
+			return true
+		}
+	}
+	return false
+}
+
+func (run *Simulation) dump() {
+	// what every account of this process waits for, and its protocol state
+	run.activity_mutex.Lock()
+	ids := make([]int, 0, len(run.activity))
+	for id := range run.activity {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		current := run.activity[id]
+		fmt.Fprintf(run.config.Output, "  participant %d: %s", id, current.state)
+		if current.state != "done" {
+			fmt.Fprintf(run.config.Output, " (transaction %d) for %s", current.transaction, run.clock.Since(current.since).Round(time.Millisecond))
+		}
+		fmt.Fprintln(run.config.Output)
+	}
+	run.activity_mutex.Unlock()
+	for _, state := range run.network.Diagnose() {
+		fmt.Fprintln(run.config.Output, "  "+state.String())
+	}
+}
+
+func (run *Simulation) skipStuck(seen int) bool {
+	// fail the transactions the accounts wait on for money or dependencies;
+	// the ledger only fails them while nothing else was done since the
+	// watchdog's last look, so none of them can be running meanwhile. Accounts
+	// waiting for the CS can't be helped.
+	run.activity_mutex.Lock()
+	stuck := make([]int, 0)
+	for _, current := range run.activity {
+		switch current.state {
+		case "funds", "dependencies", "set aside":
+			stuck = append(stuck, current.transaction)
+		}
+	}
+	run.activity_mutex.Unlock()
+
+	skipped := false
+	for _, id := range stuck {
+		transaction := run.byID[id]
+		if !run.ledger.abandon(id, seen) {
+			continue
+		}
+		run.failures_mutex.Lock()
+		run.failures["stuck"]++
+		run.failures_mutex.Unlock()
+		run.emit(Event{Kind: "failure", Account: transaction.From, Peer: transaction.To, Amount: transaction.Amount, Reason: "stuck"})
+		fmt.Fprintf(run.config.Output, "Transaction %d failed (stuck): %s\n", transaction.ID, transaction)
+		run.share(transaction.From, "failure", transaction.ID)
+		seen++
+		skipped = true
+	}
+	return skipped
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// the name the runs with prefetching are reported under, after the algorithm
+const prefetchSuffix = "+prefetch"
+
+// benchSummary averages the runs of one algorithm over one test folder
+type benchSummary struct {
+	Folder     string  `json:"folder"`
+	Algorithm  string  `json:"algorithm"`
+	Ordering   string  `json:"ordering"`
+	Runs       int     `json:"runs"`
+	Messages   float64 `json:"messages"`
+	MinMessage int64   `json:"minMessages"`
+	MaxMessage int64   `json:"maxMessages"`
+	Duration   float64 `json:"durationMs"`
+	MinDur     int64   `json:"minDurationMs"`
+	MaxDur     int64   `json:"maxDurationMs"`
+	CSWait     float64 `json:"csWaitAvgMs"`
+	Latency    float64 `json:"latencyAvgMs"`
+	LatencyP95 float64 `json:"latencyP95Ms"`
+	Throughput float64 `json:"csThroughputPerSec"`
+	Unsafe     int     `json:"unsafeRuns,omitempty"` // -verify only: runs failing the safety check
+}
+
+func bench(args []string) {
+	// run every algorithm over every test folder a number of times and write
+	// a comparison of their metrics
+	folders := make([]string, 0)
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		folders = append(folders, args[0])
+		args = args[1:]
+	}
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	algorithms := flags.String("algorithms", "original,optimized,token-ring,suzuki-kasami", "comma-separated algorithms to compare")
+	runs := flags.Int("runs", 3, "runs of each algorithm on each folder")
+	out := flags.String("out", "bench", "directory the outputs of the runs and the comparison are written to")
+	chart := flags.Bool("chart", false, "print an ASCII chart of the messages and duration of each algorithm")
+	prefetch := flags.Bool("prefetch", false, "also run the original and optimized algorithms with prefetching, as <algorithm>+prefetch")
+	orderings := flags.String("orderings", string(mutex.FIFO), "comma-separated message orderings to run each algorithm under: fifo, causal, unordered")
+	verifySafety := flags.Bool("verify", false, "check mutual exclusion and the balances on the events of every run")
+	latencyRounds := flags.Int("transport-latency", 0, "first compare the round-trip time of this many messages over the channel, TCP and shared memory transports")
+	flags.Parse(args)
+
+	if len(folders) == 0 {
+		dirs, err := filepath.Glob(filepath.Join("tests", "*"))
+		if err != nil {
+			fmt.Println("Error listing test folders:", err)
+			return
+		}
+		for _, dir := range dirs {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				folders = append(folders, dir)
+			}
+		}
+	}
+	names := strings.Split(*algorithms, ",")
+	for _, name := range names {
+		switch mutex.Algorithm(name) {
+		case mutex.Original, mutex.Optimized, mutex.TokenRing, mutex.SuzukiKasami:
+		default:
+			fmt.Println("Invalid algorithm:", name, "(expected original, optimized, token-ring or suzuki-kasami)")
+			return
+		}
+	}
+	modes := make([]mutex.Ordering, 0)
+	for _, name := range strings.Split(*orderings, ",") {
+		if !validOrdering(mutex.Ordering(name)) {
+			fmt.Println("Invalid ordering:", name, "(expected fifo, causal or unordered)")
+			return
+		}
+		modes = append(modes, mutex.Ordering(name))
+	}
+	if *prefetch {
+		for _, name := range names {
+			if mutex.Algorithm(name) == mutex.Original || mutex.Algorithm(name) == mutex.Optimized {
+				names = append(names, name+prefetchSuffix)
+			}
+		}
+	}
+	if len(folders) == 0 || *runs < 1 {
+		fmt.Println("Usage: go run ./cmd/banksim bench [folder...] [-algorithms LIST] [-orderings LIST] [-runs N] [-out DIR] [-verify] [-chart] [-transport-latency N]")
+		return
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		fmt.Println("Error creating output directory:", err)
+		return
+	}
+
+	if *latencyRounds > 0 {
+		fmt.Printf("Bench: round trips over each transport, %d rounds\n", *latencyRounds)
+		latencies := measureTransports(*latencyRounds)
+		fmt.Printf("\n%-10s %10s %10s %10s %10s\n", "transport", "avg ms", "p50 ms", "p95 ms", "p99 ms")
+		for _, result := range latencies {
+			if result.Error != "" {
+				fmt.Printf("%-10s %s\n", result.Transport, result.Error)
+				continue
+			}
+			fmt.Printf("%-10s %10.3f %10.3f %10.3f %10.3f\n", result.Transport, result.RoundTrip.Avg, result.RoundTrip.P50, result.RoundTrip.P95, result.RoundTrip.P99)
+		}
+		fmt.Println()
+		data, err := json.MarshalIndent(latencies, "", "  ")
+		if err == nil {
+			err = os.WriteFile(filepath.Join(*out, "transports.json"), data, 0644)
+		}
+		if err != nil {
+			fmt.Println("Error writing the transport latencies:", err)
+		}
+	}
+
+	rows := [][]string{{"folder", "algorithm", "ordering", "run", "accounts", "transactions", "messages", "requests", "approvals", "token_passes", "duration_ms", "cs_wait_avg_ms", "cs_wait_p95_ms", "latency_avg_ms", "latency_p95_ms", "throughput", "safety"}}
+	summaries := make([]benchSummary, 0, len(folders)*len(names)*len(modes))
+	for _, folder := range folders {
+		for _, name := range names {
+			for _, ordering := range modes {
+				results := make([]bank.Metrics, 0, *runs)
+				for k := 1; k <= *runs; k++ {
+					fmt.Printf("Bench: %s with %s (%s), run %d of %d\n", folder, name, ordering, k, *runs)
+					dir := filepath.Join(*out, filepath.Base(folder), name, fmt.Sprintf("run_%d", k))
+					if len(modes) > 1 {
+						dir = filepath.Join(*out, filepath.Base(folder), name, string(ordering), fmt.Sprintf("run_%d", k))
+					}
+					metrics, err := benchRun(folder, name, ordering, dir, *verifySafety)
+					if err != nil {
+						fmt.Println("Error running", folder+":", err)
+						continue
+					}
+					results = append(results, metrics)
+					safety := ""
+					if metrics.Safety != nil {
+						safety = "pass"
+						if !metrics.Safety.Passed {
+							safety = "fail: " + metrics.Safety.Violation
+						}
+					}
+					rows = append(rows, []string{
+						folder, name, string(ordering), strconv.Itoa(k),
+						strconv.Itoa(metrics.Accounts), strconv.Itoa(metrics.Transactions),
+						strconv.FormatInt(metrics.TotalMessages, 10), strconv.FormatInt(metrics.Requests, 10),
+						strconv.FormatInt(metrics.Approvals, 10), strconv.FormatInt(metrics.TokenPasses, 10),
+						strconv.FormatInt(metrics.Duration, 10),
+						formatFloat(metrics.CSWait.Avg), formatFloat(metrics.CSWait.P95),
+						formatFloat(metrics.Latency.Avg), formatFloat(metrics.Latency.P95),
+						formatFloat(metrics.Throughput), safety,
+					})
+				}
+				if len(results) > 0 {
+					summaries = append(summaries, summarizeBench(folder, name, ordering, results))
+				}
+			}
+		}
+	}
+
+	if err := writeBenchCSV(filepath.Join(*out, "bench.csv"), rows); err != nil {
+		fmt.Println("Error writing the comparison:", err)
+		return
+	}
+	data, err := json.MarshalIndent(summaries, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(*out, "bench.json"), data, 0644)
+	}
+	if err != nil {
+		fmt.Println("Error writing the comparison:", err)
+		return
+	}
+
+	fmt.Printf("\n%-20s %-14s %-10s %5s %10s %12s %12s %12s\n", "folder", "algorithm", "ordering", "runs", "messages", "duration ms", "cs wait ms", "latency p95")
+	for _, summary := range summaries {
+		fmt.Printf("%-20s %-14s %-10s %5d %10.1f %12.1f %12.3f %12.3f", filepath.Base(summary.Folder), summary.Algorithm, summary.Ordering, summary.Runs, summary.Messages, summary.Duration, summary.CSWait, summary.LatencyP95)
+		if summary.Unsafe > 0 {
+			fmt.Printf("  UNSAFE in %d runs", summary.Unsafe)
+		}
+		fmt.Println()
+	}
+	if *chart {
+		printBenchChart(summaries)
+	}
+	fmt.Println("Comparison saved to", filepath.Join(*out, "bench.csv"), "and", filepath.Join(*out, "bench.json"))
+}
+
+func benchRun(folder string, name string, ordering mutex.Ordering, dir string, verifySafety bool) (bank.Metrics, error) {
+	// one run, its files written to its own directory
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return bank.Metrics{}, err
+	}
+	config := bank.DefaultConfig()
+	algorithm, prefetch := strings.CutSuffix(name, prefetchSuffix)
+	config.Algorithm = mutex.Algorithm(algorithm)
+	config.Prefetch = prefetch
+	config.Ordering = ordering
+	config.Storage = bank.OutputStorage{Storage: config.Storage, Dir: dir}
+	scenario, err := bank.LoadScenario(config.Storage, folder)
+	if err != nil {
+		return bank.Metrics{}, err
+	}
+	var trace *bank.MemorySink
+	if verifySafety {
+		trace = &bank.MemorySink{}
+		config.Sinks = append(config.Sinks, trace)
+	}
+	run := bank.NewSimulation(config, scenario)
+	metrics := run.Run()
+	if trace != nil {
+		report := bank.CheckSafety(trace.Events(), scenario.Balances, bank.BalanceFloor(config.Funds))
+		metrics.Safety = &report
+	}
+	if err := run.WriteFinalBalances("final.txt"); err != nil {
+		return metrics, err
+	}
+	return metrics, metrics.Write(config.Storage, fmt.Sprintf("metrics_%s.json", algorithm))
+}
+
+func summarizeBench(folder string, algorithm string, ordering mutex.Ordering, results []bank.Metrics) benchSummary {
+	summary := benchSummary{
+		Folder:     folder,
+		Algorithm:  algorithm,
+		Ordering:   string(ordering),
+		Runs:       len(results),
+		MinMessage: results[0].TotalMessages,
+		MaxMessage: results[0].TotalMessages,
+		MinDur:     results[0].Duration,
+		MaxDur:     results[0].Duration,
+	}
+	n := float64(len(results))
+	for _, metrics := range results {
+		summary.Messages += float64(metrics.TotalMessages) / n
+		summary.Duration += float64(metrics.Duration) / n
+		summary.CSWait += metrics.CSWait.Avg / n
+		summary.Latency += metrics.Latency.Avg / n
+		summary.LatencyP95 += metrics.Latency.P95 / n
+		summary.Throughput += metrics.Throughput / n
+		summary.MinMessage = min(summary.MinMessage, metrics.TotalMessages)
+		summary.MaxMessage = max(summary.MaxMessage, metrics.TotalMessages)
+		summary.MinDur = min(summary.MinDur, metrics.Duration)
+		summary.MaxDur = max(summary.MaxDur, metrics.Duration)
+		if metrics.Safety != nil && !metrics.Safety.Passed {
+			summary.Unsafe++
+		}
+	}
+	return summary
+}
+
+func writeBenchCSV(name string, rows [][]string) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	writer.WriteAll(rows)
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
+
+func printBenchChart(summaries []benchSummary) {
+	// one bar per folder and algorithm, scaled to the largest value of each
+	// chart
+	const width = 40
+	chart := func(title string, value func(benchSummary) float64) {
+		largest := 0.0
+		for _, summary := range summaries {
+			largest = max(largest, value(summary))
+		}
+		fmt.Printf("\n%s\n", title)
+		sorted := append([]benchSummary(nil), summaries...)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Folder < sorted[j].Folder })
+		for _, summary := range sorted {
+			bar := 0
+			if largest > 0 {
+				bar = int(value(summary) / largest * width)
+			}
+			fmt.Printf("%-12s %-14s %-10s %s %.1f\n", filepath.Base(summary.Folder), summary.Algorithm, summary.Ordering, strings.Repeat("#", bar), value(summary))
+		}
+	}
+	chart("Messages", func(summary benchSummary) float64 { return summary.Messages })
+	chart("Duration (ms)", func(summary benchSummary) float64 { return summary.Duration })
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// writeRunBundle zips what the run read and wrote into one archive laid out
+// as manifest.json, input/, balances/, metrics/, logs/, traces/,
+// checkpoints/, reports/ and other/, each file under its base name, created
+// at the time of the clock of the run
+func writeRunBundle(storage bank.Storage, recorder *bank.RecordingStorage, name string, sections map[string]string, metrics bank.Metrics, folder string, clock mutex.Clock) error {
+	read, written := recorder.Files()
+	entries := make([]bank.BundleEntry, 0, len(read)+len(written)+2)
+	for _, file := range read {
+		entries = append(entries, bank.BundleEntry{Path: path.Join("input", filepath.Base(file)), Source: file})
+	}
+	for _, file := range written {
+		section, ok := sections[filepath.Base(file)]
+		if !ok {
+			section = "other"
+		}
+		entries = append(entries, bank.BundleEntry{Path: path.Join(section, filepath.Base(file)), Source: file})
+	}
+	report := func(name string, result any) error {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err == nil {
+			entries = append(entries, bank.BundleEntry{Path: path.Join("reports", name), Data: data})
+		}
+		return err
+	}
+	if metrics.Safety != nil {
+		if err := report("safety.json", metrics.Safety); err != nil {
+			return err
+		}
+	}
+	if metrics.Acceptance != nil {
+		if err := report("acceptance.json", metrics.Acceptance); err != nil {
+			return err
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	manifest := bank.BundleManifest{Created: clock.Now(), Command: os.Args, Folder: folder, Algorithm: metrics.Algorithm}
+	return bank.WriteBundle(storage, name, manifest, entries)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyConfigFile sets the options listed in a JSON config file, an object
+// mapping option names to their values, e.g.
+//
+//	{"input": "tests/test_5", "algorithm": "token-ring", "output-dir": "runs/a", "warm-up": "200ms"}
+//
+// The options given on the command line take precedence over the file.
+func applyConfigFile(options *flag.FlagSet, name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	given := make(map[string]bool)
+	options.Visit(func(option *flag.Flag) {
+		given[option.Name] = true
+	})
+	for key, raw := range values {
+		if options.Lookup(key) == nil {
+			return fmt.Errorf("%s: unknown option %q", name, key)
+		}
+		if given[key] {
+			continue
+		}
+		// strings are given without their quotes, numbers and booleans as written
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		if err := options.Set(key, value); err != nil {
+			return fmt.Errorf("%s: option %q: %v", name, key, err)
+		}
+	}
+	return nil
+}
+
+// parseSlowAccounts reads the stragglers of a run as comma-separated
+// id:delay pairs, e.g. "3:5ms,7:20ms"
+func parseSlowAccounts(spec string) (map[int]time.Duration, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	slow := make(map[int]time.Duration)
+	for _, field := range strings.Split(spec, ",") {
+		id, delay, ok := strings.Cut(strings.TrimSpace(field), ":")
+		if !ok {
+			return nil, fmt.Errorf("expected id:delay, got %q", field)
+		}
+		account, err := strconv.Atoi(id)
+		if err != nil || account < 0 {
+			return nil, fmt.Errorf("invalid account %q", id)
+		}
+		duration, err := time.ParseDuration(delay)
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("invalid delay %q", delay)
+		}
+		slow[account] = duration
+	}
+	return slow, nil
+}
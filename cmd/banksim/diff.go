@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// diffResult is one algorithm on one seed, compared with the reference
+type diffResult struct {
+	Seed       int64             `json:"seed"`
+	Outcome    bank.Outcome      `json:"outcome"`
+	Safety     bank.SafetyReport `json:"safety"`
+	Divergence *bank.Divergence  `json:"divergence,omitempty"` // nil for the reference
+}
+
+func diff(args []string) {
+	// run a test folder with several algorithms on the same delivery schedule
+	// and diff what they did against the first one
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("Usage: go run ./cmd/banksim diff <folder> [-algorithms LIST] [-seed N] [-runs N] [-ordering MODE] [-drop P] [-duplicate P] [-reorder P] [-delay D] [-out DIR]")
+		return
+	}
+	folder := args[0]
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	algorithms := flags.String("algorithms", "original,optimized", "comma-separated algorithms, the first one being the reference")
+	seed := flags.Int64("seed", 1, "seed of the first run, drawing the start order, the deliveries and the faults")
+	runs := flags.Int("runs", 1, "runs of every algorithm, on the seeds from -seed on")
+	ordering := flags.String("ordering", string(mutex.Unordered), "delivery order of the messages to an account: fifo, causal or unordered")
+	var faults mutex.Faults
+	flags.Float64Var(&faults.Drop, "drop", 0, "probability a protocol message is lost")
+	flags.Float64Var(&faults.Duplicate, "duplicate", 0, "probability a protocol message is delivered twice")
+	flags.Float64Var(&faults.Reorder, "reorder", 0, "probability a protocol message is held back behind the next one to its account")
+	flags.DurationVar(&faults.Delay, "delay", 0, "delay each protocol message by a random time up to this long")
+	out := flags.String("out", "diff", "directory the outputs of the runs and the comparison are written to")
+	flags.Parse(args[1:])
+
+	names := strings.Split(*algorithms, ",")
+	if len(names) < 2 {
+		fmt.Println("Expected at least two algorithms to compare")
+		return
+	}
+	for _, name := range names {
+		switch mutex.Algorithm(name) {
+		case mutex.Original, mutex.Optimized, mutex.TokenRing, mutex.SuzukiKasami:
+		default:
+			fmt.Println("Invalid algorithm:", name, "(expected original, optimized, token-ring or suzuki-kasami)")
+			return
+		}
+	}
+	if !validOrdering(mutex.Ordering(*ordering)) {
+		fmt.Println("Invalid ordering:", *ordering, "(expected fifo, causal or unordered)")
+		return
+	}
+	if err := faults.Validate(); err != nil {
+		fmt.Println("Invalid fault injection:", err)
+		return
+	}
+
+	results := make([]diffResult, 0, *runs*len(names))
+	diverged := false
+	for k := 0; k < *runs; k++ {
+		runSeed := *seed + int64(k)
+		var reference bank.Outcome
+		for i, name := range names {
+			dir := filepath.Join(*out, fmt.Sprintf("seed_%d", runSeed), name)
+			result, transactions, err := diffRun(folder, mutex.Algorithm(name), mutex.Ordering(*ordering), faults, runSeed, dir)
+			if err != nil {
+				fmt.Println("Error running", folder+":", err)
+				return
+			}
+			if i == 0 {
+				reference = result.Outcome
+				fmt.Printf("Seed %d: %s is the reference, safety %s\n", runSeed, name, result.Safety)
+			} else {
+				divergence := bank.CompareOutcomes(reference, result.Outcome, transactions)
+				result.Divergence = &divergence
+				fmt.Printf("Seed %d: %s, safety %s\n", runSeed, divergence, result.Safety)
+				for _, line := range append(append(divergence.Balances, divergence.Outcomes...), divergence.Accounts...) {
+					fmt.Println("  " + line)
+				}
+				diverged = diverged || divergence.Diverged()
+			}
+			diverged = diverged || !result.Safety.Passed
+			results = append(results, result)
+		}
+	}
+
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(*out, "diff.json"), data, 0644)
+	}
+	if err != nil {
+		fmt.Println("Error writing the comparison:", err)
+	}
+	if diverged {
+		os.Exit(1)
+	}
+}
+
+func diffRun(folder string, algorithm mutex.Algorithm, ordering mutex.Ordering, faults mutex.Faults, seed int64, dir string) (diffResult, []bank.Transaction, error) {
+	// one run on the given seed, its files written to its own directory
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return diffResult{}, nil, err
+	}
+	config := bank.DefaultConfig()
+	config.Algorithm = algorithm
+	config.Ordering = ordering
+	config.Seed = seed
+	config.Faults = faults
+	config.Faults.Seed = seed
+	config.Storage = bank.OutputStorage{Storage: config.Storage, Dir: dir}
+	scenario, err := bank.LoadScenario(config.Storage, folder)
+	if err != nil {
+		return diffResult{}, nil, err
+	}
+	trace := &bank.MemorySink{}
+	config.Sinks = append(config.Sinks, trace)
+	run := bank.NewSimulation(config, scenario)
+	metrics := run.Run()
+	if err := run.WriteFinalBalances("final.txt"); err != nil {
+		return diffResult{}, nil, err
+	}
+	if err := metrics.Write(config.Storage, fmt.Sprintf("metrics_%s.json", algorithm)); err != nil {
+		return diffResult{}, nil, err
+	}
+	result := diffResult{Seed: seed, Outcome: run.Outcome(), Safety: bank.CheckSafety(trace.Events(), scenario.Balances, bank.BalanceFloor(config.Funds))}
+	return result, scenario.Transactions, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// e2eNode is one process of the end-to-end run: its accounts, and what it
+// ended with
+type e2eNode struct {
+	local   []int
+	trace   *bank.MemorySink
+	metrics bank.Metrics
+	ledger  map[int]bank.Money
+}
+
+func TestE2E(t *testing.T) {
+	// run a scenario as several processes inside this one, each with its own
+	// accounts, storage and TCP transport on the loopback interface, and
+	// check the balances, mutual exclusion across the processes and their
+	// shutdown against a run of the same scenario in a single process
+	if testing.Short() {
+		t.Skip("runs the scenario over TCP for every algorithm")
+	}
+	const folder = "../../tests/test_5"
+	const nodes = 3
+	for _, algorithm := range []mutex.Algorithm{mutex.Original, mutex.Optimized, mutex.TokenRing, mutex.SuzukiKasami} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			// one clock for every process, so their CS entries can be ordered
+			clock := mutex.NewScaledClock(10)
+			scenario, err := bank.LoadScenario(bank.DiskStorage{}, folder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := e2eReference(folder, algorithm, clock)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goroutines := runtime.NumGoroutine()
+			processes, err := e2eRun(folder, algorithm, clock, nodes, scenario.Accounts, 2*time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// every process agrees with the single process on the balances
+			for i, node := range processes {
+				for id := 0; id < scenario.Accounts; id++ {
+					if node.ledger[id] != expected[id] {
+						t.Errorf("process %d ends with %s for participant %d, the single process with %s", i, node.ledger[id], id, expected[id])
+					}
+				}
+			}
+
+			// the balances on the events of each process, and mutual
+			// exclusion over the CS entries of all of them, on the clock
+			// they share
+			merged := make([]bank.Event, 0)
+			for i, node := range processes {
+				events := node.trace.Events()
+				if report := bank.CheckSafety(events, scenario.Balances, 0); !report.Passed {
+					t.Errorf("process %d: safety %s", i, report)
+				}
+				for _, event := range events {
+					if event.Kind == "enter" || event.Kind == "release" {
+						merged = append(merged, event)
+					}
+				}
+			}
+			sort.SliceStable(merged, func(i, j int) bool {
+				return merged[i].Time.Before(merged[j].Time)
+			})
+			report := bank.CheckSafety(merged, nil, 0)
+			if !report.Passed {
+				t.Errorf("mutual exclusion across the processes: %s", report)
+			}
+			if report.Entries == 0 {
+				t.Error("no CS entry across the processes")
+			}
+
+			// a clean shutdown: the barrier agreed, and the transports and
+			// accounts stopped their goroutines
+			for i, node := range processes {
+				switch {
+				case node.metrics.Shutdown == nil:
+					t.Errorf("process %d didn't go through the shutdown barrier", i)
+				case !node.metrics.Shutdown.Agreed:
+					t.Errorf("process %d: shutdown barrier %s", i, node.metrics.Shutdown)
+				}
+			}
+			deadline := time.Now().Add(time.Second)
+			for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if lingering := runtime.NumGoroutine() - goroutines; lingering > 0 {
+				t.Errorf("%d goroutines still running after the processes stopped", lingering)
+			}
+		})
+	}
+}
+
+func e2eReference(folder string, algorithm mutex.Algorithm, clock mutex.Clock) (map[int]bank.Money, error) {
+	// the final balances of the scenario run in a single process
+	config := bank.DefaultConfig()
+	config.Algorithm = algorithm
+	config.Clock = clock
+	config.Storage = bank.NewMemoryStorage(nil)
+	scenario, err := bank.LoadScenario(bank.DiskStorage{}, folder)
+	if err != nil {
+		return nil, err
+	}
+	run := bank.NewSimulation(config, scenario)
+	run.Run()
+	return run.Ledger().Balances(), nil
+}
+
+func e2eRun(folder string, algorithm mutex.Algorithm, clock mutex.Clock, nodes int, accounts int, timeout time.Duration) ([]*e2eNode, error) {
+	// one simulation per process, its accounts a contiguous block, all
+	// started together
+	// the accounts of a process share a free port of the loopback interface
+	addresses := make([]string, accounts)
+	for i := 0; i < nodes; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		for id := i * accounts / nodes; id < (i+1)*accounts/nodes; id++ {
+			addresses[id] = listener.Addr().String()
+		}
+		listener.Close()
+	}
+
+	processes := make([]*e2eNode, nodes)
+	runs := make([]*bank.Simulation, nodes)
+	for i := range processes {
+		node := &e2eNode{trace: &bank.MemorySink{}}
+		for id := i * accounts / nodes; id < (i+1)*accounts/nodes; id++ {
+			node.local = append(node.local, id)
+		}
+		scenario, err := bank.LoadScenario(bank.DiskStorage{}, folder)
+		if err != nil {
+			return nil, err
+		}
+		transport, err := mutex.NewTCPTransport(addresses, node.local)
+		if err != nil {
+			return nil, fmt.Errorf("starting the transport of process %d: %w", i, err)
+		}
+		config := bank.DefaultConfig()
+		config.Algorithm = algorithm
+		config.Clock = clock
+		config.Storage = bank.NewMemoryStorage(nil)
+		config.Sinks = []bank.Sink{node.trace}
+		config.Transport = transport
+		config.Local = node.local
+		processes[i] = node
+		runs[i] = bank.NewSimulation(config, scenario)
+	}
+
+	done := make(chan int, nodes)
+	for i := range runs {
+		go func(i int) {
+			processes[i].metrics = runs[i].Run()
+			processes[i].ledger = runs[i].Ledger().Balances()
+			done <- i
+		}(i)
+	}
+	expired := time.After(timeout)
+	for finished := 0; finished < nodes; finished++ {
+		select {
+		case <-done:
+		case <-expired:
+			return nil, fmt.Errorf("%d of %d processes still running after %s", nodes-finished, nodes, timeout)
+		}
+	}
+	return processes, nil
+}
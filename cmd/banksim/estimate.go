@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// latencyProfiles are the one-way message delays selectable by name; any
+// other profile is read as a duration
+var latencyProfiles = map[string]time.Duration{
+	"local": 0,
+	"lan":   500 * time.Microsecond,
+	"wan":   40 * time.Millisecond,
+}
+
+// entryCost is what one CS entry costs an algorithm under its protocol
+type entryCost struct {
+	fewest float64 // messages when the account still holds the votes or the token
+	most   float64 // messages when it holds nothing
+	delays float64 // one-way message delays from a release to the next entry, under contention
+}
+
+func algorithmCost(algorithm mutex.Algorithm, n_accounts int) entryCost {
+	n := float64(n_accounts)
+	switch algorithm {
+	case mutex.Original:
+		// a request to every other account and its approval, every time
+		return entryCost{fewest: 2 * (n - 1), most: 2 * (n - 1), delays: 1}
+	case mutex.Optimized:
+		// a request, a vote and a release or revoke for every other member
+		// of a √N quorum, and nothing while the votes are kept; the vote
+		// released goes through the member to the next requester
+		members := quorumMembers(n_accounts)
+		return entryCost{fewest: 0, most: 3 * members, delays: 2}
+	case mutex.TokenRing:
+		// the token goes around the ring to the account
+		return entryCost{fewest: 0, most: n, delays: 1}
+	case mutex.SuzukiKasami:
+		// a request to every other account and the token back
+		return entryCost{fewest: 0, most: n, delays: 1}
+	}
+	return entryCost{}
+}
+
+func quorumMembers(n_accounts int) float64 {
+	// the other members of a generated Maekawa quorum, on average
+	quorums := mutex.MaekawaQuorums(n_accounts)
+	total := 0
+	for i, quorum := range quorums {
+		for _, member := range quorum {
+			if member != i {
+				total++
+			}
+		}
+	}
+	if len(quorums) == 0 {
+		return 0
+	}
+	return float64(total) / float64(len(quorums))
+}
+
+func parseLatency(profile string) (time.Duration, error) {
+	if latency, ok := latencyProfiles[profile]; ok {
+		return latency, nil
+	}
+	latency, err := time.ParseDuration(profile)
+	if err != nil || latency < 0 {
+		return 0, fmt.Errorf("invalid latency profile %q (expected local, lan, wan or a duration)", profile)
+	}
+	return latency, nil
+}
+
+type costModel struct {
+	// calibrated constants of one algorithm, fitted on prior runs
+	algorithm  string
+	runs       int
+	messageFit float64 // share of the messages of the most costly entries
+	msPerTx    float64 // duration per transaction
+}
+
+func calibrate(results_dir string) []costModel {
+	// fit the cost model of each algorithm on the metrics files of prior runs,
+	// using a least squares fit through the origin
+	files, err := filepath.Glob(filepath.Join(results_dir, "*", "metrics_*.json"))
+	if err != nil {
+		fmt.Println("Error listing metrics files:", err)
+		return nil
+	}
+
+	type sums struct {
+		runs                   int
+		msgXY, msgXX           float64
+		durationXY, durationXX float64
+	}
+	fits := make(map[string]*sums)
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Println("Error reading metrics file:", err)
+			continue
+		}
+		var metrics bank.Metrics
+		if err := json.Unmarshal(data, &metrics); err != nil {
+			fmt.Println("Error parsing metrics file", name+":", err)
+			continue
+		}
+		if metrics.Accounts < 2 || metrics.Transactions == 0 {
+			continue
+		}
+
+		fit := fits[metrics.Algorithm]
+		if fit == nil {
+			fit = &sums{}
+			fits[metrics.Algorithm] = fit
+		}
+		most := float64(metrics.Transactions) * algorithmCost(mutex.Algorithm(metrics.Algorithm), metrics.Accounts).most
+		transactions := float64(metrics.Transactions)
+		fit.runs++
+		fit.msgXY += most * float64(metrics.TotalMessages)
+		fit.msgXX += most * most
+		fit.durationXY += transactions * float64(metrics.Duration)
+		fit.durationXX += transactions * transactions
+	}
+
+	models := make([]costModel, 0, len(fits))
+	for algorithm, fit := range fits {
+		model := costModel{
+			algorithm: algorithm,
+			runs:      fit.runs,
+			msPerTx:   fit.durationXY / fit.durationXX,
+		}
+		if fit.msgXX > 0 {
+			model.messageFit = fit.msgXY / fit.msgXX
+		}
+		models = append(models, model)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].algorithm < models[j].algorithm })
+	return models
+}
+
+// runEstimate is the prediction for one algorithm
+type runEstimate struct {
+	algorithm    mutex.Algorithm
+	runs         int     // prior runs calibrating it, 0 for the protocol alone
+	fewest, most float64 // total messages
+	messages     float64 // calibrated total messages, when there are prior runs
+	messageDelay float64 // ms the transactions wait for messages under contention
+	durationMs   float64 // calibrated duration, with the message delays
+}
+
+func estimateRun(n_accounts int, m_transactions int, latency time.Duration, models []costModel) []runEstimate {
+	calibrated := make(map[string]costModel)
+	for _, model := range models {
+		calibrated[model.algorithm] = model
+	}
+	m := float64(m_transactions)
+	estimates := make([]runEstimate, 0, 4)
+	for _, algorithm := range []mutex.Algorithm{mutex.Original, mutex.Optimized, mutex.TokenRing, mutex.SuzukiKasami} {
+		cost := algorithmCost(algorithm, n_accounts)
+		estimate := runEstimate{
+			algorithm:    algorithm,
+			fewest:       m * cost.fewest,
+			most:         m * cost.most,
+			messageDelay: m * cost.delays * float64(latency) / float64(time.Millisecond),
+		}
+		if model, ok := calibrated[string(algorithm)]; ok {
+			// the prior runs were local, so their duration is the work of the
+			// accounts and the message delays come on top
+			estimate.runs = model.runs
+			estimate.messages = model.messageFit * estimate.most
+			estimate.durationMs = model.msPerTx*m + estimate.messageDelay
+		}
+		estimates = append(estimates, estimate)
+	}
+	return estimates
+}
+
+func estimate(args []string) {
+	// predict message counts and duration of each algorithm before running
+	usage := "Usage: go run ./cmd/banksim estimate <accounts> <transactions> [results_dir] [-latency PROFILE]"
+	if len(args) < 2 {
+		fmt.Println(usage)
+		return
+	}
+	n_accounts, err := strconv.Atoi(args[0])
+	if err != nil || n_accounts < 1 {
+		fmt.Println("Invalid number of accounts:", args[0])
+		return
+	}
+	m_transactions, err := strconv.Atoi(args[1])
+	if err != nil || m_transactions < 0 {
+		fmt.Println("Invalid number of transactions:", args[1])
+		return
+	}
+	args = args[2:]
+	results_dir := "results"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		results_dir = args[0]
+		args = args[1:]
+	}
+	flags := flag.NewFlagSet("estimate", flag.ExitOnError)
+	profile := flags.String("latency", "local", "one-way message delay: local, lan (0.5ms), wan (40ms) or a duration")
+	flags.Parse(args)
+	latency, err := parseLatency(*profile)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	models := calibrate(results_dir)
+	if len(models) == 0 {
+		fmt.Println("No prior runs found in", results_dir, "to calibrate the estimate, so it comes from the protocols alone")
+		fmt.Printf("Estimate for %d accounts and %d transactions with %s of latency\n", n_accounts, m_transactions, latency)
+	} else {
+		fmt.Printf("Estimate for %d accounts and %d transactions with %s of latency (calibrated on %s)\n", n_accounts, m_transactions, latency, results_dir)
+	}
+	for _, prediction := range estimateRun(n_accounts, m_transactions, latency, models) {
+		fmt.Printf("\nAlgorithm: %s (%d prior runs)\n", prediction.algorithm, prediction.runs)
+		fmt.Printf("Total messages: %.0f to %.0f\n", prediction.fewest, prediction.most)
+		if prediction.runs > 0 {
+			fmt.Printf("Expected total messages: %.0f\n", prediction.messages)
+			fmt.Printf("Expected duration: %.0f ms (%.0f ms of message delays)\n", prediction.durationMs, prediction.messageDelay)
+		} else {
+			fmt.Printf("Message delays under contention: %.0f ms\n", prediction.messageDelay)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+func TestAlgorithmCosts(t *testing.T) {
+	// Ricart-Agrawala pays 2(N-1) messages per entry, the quorums about 3√N
+	// and the tokens N or nothing
+	for _, n := range []int{4, 7, 10, 16, 31, 50, 100} {
+		sqrt := math.Sqrt(float64(n))
+		original := algorithmCost(mutex.Original, n)
+		if original.fewest != float64(2*(n-1)) || original.most != float64(2*(n-1)) {
+			t.Errorf("%d accounts: original sends %v to %v messages, expected %d", n, original.fewest, original.most, 2*(n-1))
+		}
+		optimized := algorithmCost(mutex.Optimized, n)
+		if optimized.fewest != 0 || optimized.most < 3*(sqrt-1) || optimized.most > 3*(sqrt+1) {
+			t.Errorf("%d accounts: optimized sends %v to %v messages, expected 0 to about 3√N = %.1f", n, optimized.fewest, optimized.most, 3*sqrt)
+		}
+		if n >= 16 && optimized.most >= original.most {
+			t.Errorf("%d accounts: the quorums cost %v messages, no fewer than the %v of original", n, optimized.most, original.most)
+		}
+		for _, algorithm := range []mutex.Algorithm{mutex.TokenRing, mutex.SuzukiKasami} {
+			cost := algorithmCost(algorithm, n)
+			if cost.fewest != 0 || cost.most != float64(n) {
+				t.Errorf("%d accounts: %s sends %v to %v messages, expected 0 to %d", n, algorithm, cost.fewest, cost.most, n)
+			}
+		}
+		if optimized.delays != 2*original.delays {
+			t.Errorf("%d accounts: optimized hands the CS over in %v message delays, expected twice the %v of original", n, optimized.delays, original.delays)
+		}
+	}
+}
+
+func TestEstimateRun(t *testing.T) {
+	// prior local runs of original calibrate the messages and the work per
+	// transaction, and the latency profile adds the message delays
+	results := t.TempDir()
+	metrics := bank.Metrics{Algorithm: "original", Accounts: 5, Transactions: 10, TotalMessages: 60, Duration: 100}
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(results, "run"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(results, "run", "metrics_original.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	latency, err := parseLatency("lan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	estimates := estimateRun(5, 20, latency*4, calibrate(results))
+	if len(estimates) != 4 {
+		t.Fatalf("%d estimates, expected one per algorithm", len(estimates))
+	}
+	original := estimates[0]
+	// 8 messages per transaction at most, 6 in the prior run
+	if original.runs != 1 || original.most != 160 || math.Abs(original.messages-120) > 1e-9 {
+		t.Fatalf("original: %+v", original)
+	}
+	// 10 ms of work and one 2 ms delay per transaction
+	if math.Abs(original.messageDelay-40) > 1e-9 || math.Abs(original.durationMs-240) > 1e-9 {
+		t.Fatalf("original: %v ms with %v ms of delays, expected 240 with 40", original.durationMs, original.messageDelay)
+	}
+	for _, uncalibrated := range estimates[1:] {
+		if uncalibrated.runs != 0 || uncalibrated.durationMs != 0 {
+			t.Errorf("%s was calibrated without prior runs", uncalibrated.algorithm)
+		}
+	}
+	if estimates[1].messageDelay != 2*original.messageDelay {
+		t.Errorf("optimized waits %v ms for messages, expected twice the %v of original", estimates[1].messageDelay, original.messageDelay)
+	}
+}
+
+func TestParseLatency(t *testing.T) {
+	tests := map[string]time.Duration{"local": 0, "lan": 500 * time.Microsecond, "wan": 40 * time.Millisecond, "3ms": 3 * time.Millisecond}
+	for profile, expected := range tests {
+		if latency, err := parseLatency(profile); err != nil || latency != expected {
+			t.Errorf("latency profile %q is %v (%v), expected %v", profile, latency, err, expected)
+		}
+	}
+	for _, profile := range []string{"moon", "-1ms", ""} {
+		if _, err := parseLatency(profile); err == nil {
+			t.Errorf("latency profile %q accepted", profile)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+)
+
+func lint(args []string) {
+	// report the problems of test folders before running them
+	options := flag.NewFlagSet("lint", flag.ExitOnError)
+	maxPause := options.Duration("max-pause", 10*time.Second, "the longest pause of a transaction not reported (0 doesn't check the pauses)")
+	if len(args) < 1 {
+		fmt.Println("Usage: go run ./cmd/banksim lint <folder>... [-max-pause D]")
+		return
+	}
+	folders := make([]string, 0)
+	for len(args) > 0 {
+		if err := options.Parse(args); err != nil {
+			return
+		}
+		args = options.Args()
+		if len(args) > 0 {
+			folders = append(folders, args[0])
+			args = args[1:]
+		}
+	}
+
+	problems := 0
+	for _, folder := range folders {
+		findings, err := bank.LintFolder(bank.DiskStorage{}, folder, *maxPause)
+		if err != nil {
+			fmt.Println("Error reading test folder:", err)
+			problems++
+			continue
+		}
+		fmt.Printf("%s: %d problems\n", folder, len(findings))
+		for _, finding := range findings {
+			fmt.Println("  " + finding.String())
+		}
+		problems += len(findings)
+	}
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,591 @@
+// Command banksim runs the bank transactions of a test folder with one of the
+// mutual exclusion algorithms and reports the final balances and metrics.
+//
+//	go run ./cmd/banksim <folder> [original|optimized|token-ring|suzuki-kasami] [options]
+//	go run ./cmd/banksim -input <folder> -algorithm <algorithm> [-output-dir DIR] [-config FILE] [-bundle ZIP] [options]
+//	go run ./cmd/banksim new-test <name> [options]
+//	go run ./cmd/banksim generate [options]
+//	go run ./cmd/banksim estimate <accounts> <transactions> [results_dir] [-latency PROFILE]
+//	go run ./cmd/banksim project <events.jsonl> [projection...]
+//	go run ./cmd/banksim verify <events.jsonl> [folder]
+//	go run ./cmd/banksim restore <checkpoint.json> [options]
+//	go run ./cmd/banksim replay <events.jsonl> [algorithm] [options]
+//	go run ./cmd/banksim diff <folder> [-algorithms LIST] [-seed N] [-runs N] [-ordering MODE] [fault options]
+//	go run ./cmd/banksim bench [folder...] [-algorithms LIST] [-orderings LIST] [-runs N] [-out DIR] [-verify] [-chart] [-transport-latency N]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+func main() {
+	// Scaffold a new test folder instead of running
+	if len(os.Args) > 1 && os.Args[1] == "new-test" {
+		newTest(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		generate(os.Args[2:])
+		return
+	}
+
+	// Estimate the cost of a run instead of running it
+	if len(os.Args) > 1 && os.Args[1] == "estimate" {
+		estimate(os.Args[2:])
+		return
+	}
+
+	// Rebuild projections from a structured event log instead of running
+	if len(os.Args) > 1 && os.Args[1] == "project" {
+		project(os.Args[2:])
+		return
+	}
+
+	// Check the safety invariants on a structured event log instead of running
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		verify(os.Args[2:])
+		return
+	}
+
+	// Report the problems of test folders instead of running
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		lint(os.Args[2:])
+		return
+	}
+
+	// Diff what the algorithms do on the same delivery schedule instead of
+	// running once
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		diff(os.Args[2:])
+		return
+	}
+
+	// Compare the algorithms over several test folders instead of one run
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		bench(os.Args[2:])
+		return
+	}
+
+	config := bank.DefaultConfig()
+
+	// Resume a run from a checkpoint, which names its folder and algorithm
+	if len(os.Args) > 2 && os.Args[1] == "restore" {
+		checkpoint, err := bank.LoadCheckpoint(config.Storage, os.Args[2])
+		if err != nil {
+			fmt.Println("Error reading checkpoint:", err)
+			return
+		}
+		config.Restore = checkpoint
+		os.Args = append([]string{os.Args[0], checkpoint.Folder, checkpoint.Algorithm}, os.Args[3:]...)
+	}
+
+	// Replay the workload recorded in an event log instead of a test folder
+	replayLog := ""
+	if len(os.Args) > 2 && os.Args[1] == "replay" {
+		replayLog = os.Args[2]
+		os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+	}
+
+	// the folder and the algorithm may come first, as the scripts give them,
+	// or as -input and -algorithm among the options
+	args := os.Args[1:]
+	positional := make([]string, 0, 2)
+	for len(args) > 0 && len(positional) < 2 && !strings.HasPrefix(args[0], "-") {
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	options := flag.NewFlagSet("options", flag.ExitOnError)
+	input := options.String("input", "tests/test_5", "test folder to run")
+	algorithm := options.String("algorithm", string(config.Algorithm), "original, optimized, token-ring or suzuki-kasami")
+	outputDir := options.String("output-dir", "", "write the logs, final balances, metrics and checkpoints to this directory instead of the working directory")
+	configFile := options.String("config", "", "JSON file of options by name, overridden by the command line")
+	bundle := options.String("bundle", "", "zip the inputs, logs, traces, metrics, reports and final balances of the run into this archive (e.g. run.zip)")
+	options.DurationVar(&config.Timeout, "timeout", 0, "abort the run with status 2 and partial results after this long (0 for no limit)")
+	options.DurationVar(&config.Timeout, "max-duration", 0, "same as -timeout")
+	options.Int64Var(&config.MaxMessages, "max-messages", 0, "abort the run with status 2 and partial results once it sent more protocol messages than this (0 for no limit)")
+	maxMemory := options.Uint64("max-memory", 0, "abort the run with status 2 and partial results once its heap exceeds this many MB (0 for no limit)")
+	timeScale := options.Float64("time-scale", 1, "run the clock this many times faster than the wall clock: pauses, delays, timeouts and the reported times scale with it")
+	options.Int64Var(&config.Seed, "seed", 0, "shuffle the order the accounts start in with this seed (0 starts them in account order)")
+	ordering := options.String("ordering", string(config.Ordering), "delivery order of the messages to an account: fifo, causal or unordered (drawn from -seed)")
+	options.Float64Var(&config.Faults.Drop, "drop", 0, "fault injection: probability a protocol message is lost")
+	options.Float64Var(&config.Faults.Duplicate, "duplicate", 0, "fault injection: probability a protocol message is delivered twice")
+	options.Float64Var(&config.Faults.Reorder, "reorder", 0, "fault injection: probability a protocol message is held back behind the next one to its account")
+	options.DurationVar(&config.Faults.Delay, "delay", 0, "fault injection: delay each protocol message by a random time up to this long")
+	options.Int64Var(&config.Faults.Seed, "fault-seed", 0, "fault injection: seed the faults are drawn from (0 uses -seed, or the clock)")
+	options.StringVar(&config.SelfTransfer, "self-transfer", config.SelfTransfer, "reject, ignore or allow transfers to the same account")
+	options.StringVar(&config.ZeroAmount, "zero-amount", config.ZeroAmount, "reject, ignore or allow transfers of 0")
+	options.StringVar(&config.NegativeAmount, "negative-amount", config.NegativeAmount, "reject, ignore or allow negative transfers")
+	options.StringVar(&config.LogFormat, "log-format", config.LogFormat, "text: log committed transfers to logs.txt, json: log every event with its Lamport clock to logs.jsonl")
+	verifySafety := options.Bool("verify", false, "check mutual exclusion, non-negative balances and the total money on the events of the run")
+	events := options.String("events", "", "write protocol and transaction events to stdout or to the given file (JSON lines if it ends in .jsonl)")
+	supplySeries := options.String("supply", "", "write the money supply and the balances after every transfer to the given CSV file")
+	options.DurationVar(&config.CoalesceHold, "coalesce-hold", 0, "keep the CS up to this long for the next ready transactions (0 disables coalescing)")
+	options.IntVar(&config.CoalesceWaiting, "coalesce-waiting", config.CoalesceWaiting, "transactions coalesced at most while other accounts wait for the CS")
+	options.DurationVar(&config.TokenHop, "token-hop", config.TokenHop, "token-ring: simulated latency of passing the token to the next account")
+	slow := options.String("slow", "", "stragglers: comma-separated id:delay, each account waiting its delay before it approves a request or passes the token (e.g. 3:5ms,7:20ms)")
+	options.BoolVar(&config.Prefetch, "prefetch", false, "ask for the CS during the pause before an account's next transaction (original and optimized)")
+	options.BoolVar(&config.Archive, "archive", false, "take every account out of the network once it ran its transactions")
+	options.BoolVar(&config.Resources, "resources", false, "hold the CS for the two accounts of each transfer only, so transfers between disjoint accounts run in parallel (original and optimized)")
+	options.DurationVar(&config.Aging, "aging", 0, "boost a CS request waiting longer than this for its approvals ahead of the others (original and optimized, 0 disables it)")
+	quorums := options.String("quorums", "", "generate the quorums instead of reading quorum.txt: maekawa, grid or full")
+	hybrid := options.Bool("hybrid", false, "co-located accounts listed in groups.txt share a local lock and a single site in the distributed protocol")
+	fundingWait := options.String("funding-wait", "block", "what an account does without the money for a transaction: block, reorder or fail-fast")
+	fundsRule := options.String("funds-rule", "balance", "whether an account has the money for a transaction: balance, pending (balance minus its earlier pending transactions) or credit")
+	creditLine := options.String("credit-line", "0", "how far below 0 the balances may go with -funds-rule credit")
+	options.DurationVar(&config.HeartbeatInterval, "heartbeat", 0, "send heartbeats to the accounts of other processes this often (0 disables them)")
+	options.DurationVar(&config.FailureTimeout, "failure-timeout", 0, "declare failed an account of another process silent for this long (0 disables it)")
+	options.DurationVar(&config.RequestTimeout, "request-timeout", 0, "send a CS request, or any protocol message not acknowledged, again after this long (0 waits forever)")
+	options.IntVar(&config.RequestRetries, "request-retries", 3, "times a request is sent again before the silent accounts are declared failed")
+	options.StringVar(&config.Checkpoint, "checkpoint", config.Checkpoint, "file the checkpoints of the run are written to")
+	options.DurationVar(&config.CheckpointEvery, "checkpoint-every", 0, "take a checkpoint of every process this often (0 never)")
+	options.StringVar(&config.WAL, "wal", "", "crash recovery: sync the outcome of every transaction to this write-ahead log (e.g. wal.jsonl)")
+	options.StringVar(&config.WALSnapshot, "wal-snapshot", config.WALSnapshot, "crash recovery: file the position and Lamport clock of every account are snapshotted to")
+	options.DurationVar(&config.WALSnapshotEvery, "wal-snapshot-every", time.Second, "crash recovery: snapshot the accounts this often (0 only at the end)")
+	options.BoolVar(&config.Resume, "resume", false, "crash recovery: go on from the outcomes in the write-ahead log of a killed run, instead of starting over")
+	options.DurationVar(&config.Watchdog, "watchdog", 0, "dump the state of the accounts when no transaction completes for this long (0 disables it)")
+	options.StringVar(&config.WatchdogAction, "watchdog-action", config.WatchdogAction, "what the watchdog does with a stuck run: skip (fail the transactions waiting for money or dependencies) or abort")
+	options.IntVar(&config.BreakerThreshold, "breaker-threshold", 0, "circuit breaker: pause an account after this many failed or slow transactions in a row (0 disables it)")
+	options.DurationVar(&config.BreakerCoolDown, "breaker-cool-down", time.Second, "circuit breaker: how long a tripped account pauses before it tries again")
+	options.DurationVar(&config.BreakerTimeout, "breaker-timeout", 0, "circuit breaker: count a CS wait longer than this as a strike (0 never)")
+	metricsAddr := options.String("metrics-addr", "", "serve live Prometheus metrics on this address (e.g. :9090) at /metrics and a feed of balance and CS changes at /events, and print a progress line")
+	options.DurationVar(&config.Progress, "progress", 0, "print a progress line this often (0 never, 5s with -metrics-addr)")
+	options.DurationVar(&config.WarmUp, "warm-up", 0, "leave this first part of the run out of the duration, latency and throughput metrics")
+	options.IntVar(&config.WarmUpTransactions, "warm-up-transactions", 0, "leave the first transactions committed out of the duration, latency and throughput metrics")
+	switchTo := options.String("switch-to", "", "switch to this algorithm mid-run (single process, without -hybrid)")
+	options.IntVar(&config.SwitchAfter, "switch-after", 0, "switch algorithms once this many transactions were committed")
+	replaySpeed := options.Float64("replay-speed", 1, "replay: how many times faster than recorded the transactions arrive")
+	peers := options.String("peers", "", "multi-process run: comma-separated host:port of the process running each account, in account order")
+	local := options.String("local", "", "multi-process run: comma-separated accounts run by this process, which share one address in -peers")
+	options.DurationVar(&config.BarrierTimeout, "barrier-timeout", config.BarrierTimeout, "multi-process run: how long the processes wait at the end to agree the workload is complete (0 forever)")
+	shm := options.String("shm", "", "multi-process run on one host: exchange the messages through ring buffers in this directory (e.g. /dev/shm/run) instead of -peers")
+	options.Parse(args)
+	if *configFile != "" {
+		if err := applyConfigFile(options, *configFile); err != nil {
+			fmt.Println("Error reading config file:", err)
+			return
+		}
+	}
+	if len(positional) > 0 {
+		*input = positional[0]
+	}
+	if len(positional) > 1 {
+		*algorithm = positional[1]
+	}
+
+	config.Algorithm = mutex.Algorithm(*algorithm)
+	switch config.Algorithm {
+	case mutex.Original, mutex.Optimized, mutex.TokenRing, mutex.SuzukiKasami:
+	default:
+		fmt.Println("Invalid algorithm:", config.Algorithm, "(expected original, optimized, token-ring or suzuki-kasami)")
+		return
+	}
+
+	config.Ordering = mutex.Ordering(*ordering)
+	if !validOrdering(config.Ordering) {
+		fmt.Println("Invalid ordering:", config.Ordering, "(expected fifo, causal or unordered)")
+		return
+	}
+
+	if *timeScale <= 0 {
+		fmt.Println("Invalid time scale:", *timeScale, "(expected a positive factor)")
+		return
+	}
+	if *timeScale != 1 {
+		config.Clock = mutex.NewScaledClock(*timeScale)
+	}
+	if err := config.Faults.Validate(); err != nil {
+		fmt.Println("Invalid fault injection:", err)
+		return
+	}
+	if config.Faults.Seed == 0 {
+		config.Faults.Seed = config.Seed
+	}
+
+	// a bundle holds every file the run reads and writes
+	var recorder *bank.RecordingStorage
+	if *bundle != "" {
+		recorder = bank.NewRecordingStorage(config.Storage)
+		config.Storage = recorder
+	}
+
+	// outputs go to their own directory, so runs in parallel don't overwrite
+	// each other's files
+	if *outputDir != "" {
+		if err := os.MkdirAll(*outputDir, 0755); err != nil {
+			fmt.Println("Error creating output directory:", err)
+			return
+		}
+		config.Storage = bank.OutputStorage{Storage: config.Storage, Dir: *outputDir}
+	}
+	for _, policy := range []string{config.SelfTransfer, config.ZeroAmount, config.NegativeAmount} {
+		if !bank.ValidPolicy(policy) {
+			fmt.Println("Invalid policy:", policy, "(expected reject, ignore or allow)")
+			return
+		}
+	}
+
+	if config.LogFormat != bank.LogText && config.LogFormat != bank.LogJSON {
+		fmt.Println("Invalid log format:", config.LogFormat, "(expected text or json)")
+		return
+	}
+	if config.WatchdogAction != bank.SkipStuck && config.WatchdogAction != bank.AbortStuck {
+		fmt.Println("Invalid watchdog action:", config.WatchdogAction, "(expected skip or abort)")
+		return
+	}
+	if config.MaxMessages < 0 {
+		fmt.Println("Invalid message limit:", config.MaxMessages)
+		return
+	}
+	config.MaxMemory = *maxMemory << 20
+	if config.BreakerThreshold < 0 || config.BreakerCoolDown < 0 || config.BreakerTimeout < 0 {
+		fmt.Println("Invalid circuit breaker: the threshold, cool-down and timeout can't be negative")
+		return
+	}
+
+	config.SwitchTo = mutex.Algorithm(*switchTo)
+	switch config.SwitchTo {
+	case "", mutex.Original, mutex.Optimized, mutex.TokenRing, mutex.SuzukiKasami:
+	default:
+		fmt.Println("Invalid algorithm to switch to:", config.SwitchTo, "(expected original, optimized, token-ring or suzuki-kasami)")
+		return
+	}
+	if config.Resume && config.WAL == "" {
+		fmt.Println("Resuming (-resume) needs the write-ahead log of the earlier run (-wal)")
+		return
+	}
+	if config.Resume && config.Restore != nil {
+		fmt.Println("A run resumes either from a checkpoint or from a write-ahead log")
+		return
+	}
+	multiProcess := *peers != "" || *shm != ""
+	if *peers != "" && *shm != "" {
+		fmt.Println("A multi-process run uses either -peers or -shm")
+		return
+	}
+	if config.SwitchTo != "" && (multiProcess || *hybrid) {
+		fmt.Println("Switching algorithms needs every account in this process and no -hybrid")
+		return
+	}
+	if config.Resources && (config.Algorithm != mutex.Original && config.Algorithm != mutex.Optimized || config.SwitchTo != "" && config.SwitchTo != mutex.Original && config.SwitchTo != mutex.Optimized) {
+		fmt.Println("Per-account critical sections (-resources) need the original or optimized algorithm")
+		return
+	}
+	if config.SwitchTo != "" && config.Prefetch {
+		fmt.Println("Prefetching can't be combined with switching algorithms")
+		return
+	}
+
+	slowAccounts, err := parseSlowAccounts(*slow)
+	if err != nil {
+		fmt.Println("Invalid slow accounts:", err)
+		return
+	}
+	config.SlowAccounts = slowAccounts
+
+	strategy, ok := bank.FundingStrategies[*fundingWait]
+	if !ok {
+		fmt.Println("Invalid funding wait strategy:", *fundingWait, "(expected block, reorder or fail-fast)")
+		return
+	}
+	config.Funding = strategy
+
+	rule, ok := bank.FundsRules[*fundsRule]
+	if !ok {
+		fmt.Println("Invalid funds rule:", *fundsRule, "(expected balance, pending or credit)")
+		return
+	}
+	if credit, ok := rule.(bank.CreditLineRule); ok {
+		if credit.Limit, err = bank.ParseMoney(*creditLine); err != nil || credit.Limit < 0 {
+			fmt.Println("Invalid credit line:", *creditLine)
+			return
+		}
+		rule = credit
+	}
+	config.Funds = rule
+
+	// Route events to the requested sink
+	switch *events {
+	case "":
+	case "stdout":
+		config.Sinks = append(config.Sinks, &bank.StdoutSink{})
+	default:
+		var sink interface {
+			bank.Sink
+			Close() error
+		}
+		var err error
+		if strings.HasSuffix(*events, ".jsonl") {
+			sink, err = bank.NewJSONSink(config.Storage, *events)
+		} else {
+			sink, err = bank.NewFileSink(config.Storage, *events)
+		}
+		if err != nil {
+			fmt.Println("Error creating events file:", err)
+			return
+		}
+		defer func() {
+			if err := sink.Close(); err != nil {
+				fmt.Println("Error in the events file:", err)
+			}
+		}()
+		config.Sinks = append(config.Sinks, sink)
+	}
+
+	// the safety check replays every event of the run
+	var trace *bank.MemorySink
+	if *verifySafety {
+		trace = &bank.MemorySink{}
+		config.Sinks = append(config.Sinks, trace)
+	}
+
+	// live metrics, counted from the events of the run, and the feed of
+	// balance and CS ownership changes
+	var live *bank.LiveMetrics
+	var feed *bank.BalanceFeed
+	var metricsListener net.Listener
+	if *metricsAddr != "" {
+		var err error
+		if metricsListener, err = net.Listen("tcp", *metricsAddr); err != nil {
+			fmt.Println("Error serving metrics:", err)
+			return
+		}
+		live = bank.NewLiveMetrics()
+		feed = bank.NewBalanceFeed()
+		config.Sinks = append(config.Sinks, live, feed)
+		if config.Progress == 0 {
+			config.Progress = 5 * time.Second
+		}
+	}
+
+	// the original algorithm keeps its own log and balances next to the
+	// optimized ones
+	finalName := "final.txt"
+	if config.Algorithm == mutex.Original {
+		config.LogName = "logs_og.txt"
+		finalName = "final_og.txt"
+	}
+	if config.LogFormat == bank.LogJSON {
+		config.LogName = strings.TrimSuffix(config.LogName, ".txt") + ".jsonl"
+	}
+
+	folder_name := *input
+
+	// resume a killed run from the outcomes of its write-ahead log, which is
+	// in the output directory like the other files of the run
+	if config.Resume {
+		walName, snapshotName := config.WAL, config.WALSnapshot
+		if *outputDir != "" {
+			if !filepath.IsAbs(walName) {
+				walName = filepath.Join(*outputDir, walName)
+			}
+			if !filepath.IsAbs(snapshotName) {
+				snapshotName = filepath.Join(*outputDir, snapshotName)
+			}
+		}
+		checkpoint, err := bank.LoadWAL(config.Storage, walName, snapshotName, config.Clock)
+		if err != nil {
+			fmt.Println("Error reading the write-ahead log:", err)
+			return
+		}
+		if checkpoint.Folder != "" && checkpoint.Folder != folder_name {
+			fmt.Println("The write-ahead log is of a run of", checkpoint.Folder, "not", folder_name)
+			return
+		}
+		fmt.Printf("Resuming from %s: %d transactions committed, %d failed\n", walName, len(checkpoint.Committed), len(checkpoint.Failed))
+		config.Restore = checkpoint
+	}
+
+	var scenario *bank.Scenario
+	var acceptance *bank.Acceptance
+	if replayLog != "" {
+		events, err := bank.ReadEvents(config.Storage, replayLog)
+		if err != nil {
+			fmt.Println("Error reading events:", err)
+			return
+		}
+		if scenario, err = bank.ReplayScenario(replayLog, events, *replaySpeed); err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else {
+		var err error
+		if scenario, err = bank.LoadScenario(config.Storage, folder_name); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		// acceptance criteria turning the run into a pass/fail test
+		if acceptance, err = bank.LoadAcceptance(config.Storage, folder_name); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	// generated quorums replace those of the folder
+	if *quorums != "" {
+		generate, ok := mutex.QuorumGenerators[*quorums]
+		if !ok {
+			fmt.Println("Invalid quorums:", *quorums, "(expected maekawa, grid or full)")
+			return
+		}
+		scenario.Quorums = generate(scenario.Accounts)
+	}
+
+	// hybrid mode: local locks inside groups, distributed protocol across them
+	if *hybrid {
+		groups, warnings := bank.LoadGroups(config.Storage, folder_name, scenario.Accounts)
+		scenario.Groups = groups
+		scenario.Warnings = append(scenario.Warnings, warnings...)
+	}
+
+	// multi-process run: this process runs some accounts and reaches the
+	// others over TCP, or through shared memory on the same host
+	if multiProcess {
+		for _, field := range strings.Split(*local, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				fmt.Println("Invalid local account:", field)
+				return
+			}
+			config.Local = append(config.Local, id)
+		}
+		var transport mutex.Transport
+		var err error
+		if *shm != "" {
+			if err := os.MkdirAll(*shm, 0755); err != nil {
+				fmt.Println("Error creating the shared memory directory:", err)
+				return
+			}
+			transport, err = mutex.NewSharedMemoryTransport(*shm, scenario.Accounts, config.Local)
+		} else {
+			addresses := strings.Split(*peers, ",")
+			if len(addresses) != scenario.Accounts {
+				fmt.Println("Invalid peers:", len(addresses), "addresses for", scenario.Accounts, "accounts")
+				return
+			}
+			transport, err = mutex.NewTCPTransport(addresses, config.Local)
+		}
+		if err != nil {
+			fmt.Println("Error starting the transport:", err)
+			return
+		}
+		config.Transport = transport
+	}
+
+	if len(scenario.Membership) > 0 && (multiProcess || *hybrid) {
+		fmt.Println("Accounts joining or leaving (membership.txt) need every account in this process and no -hybrid")
+		return
+	}
+	if config.Archive && (multiProcess || *hybrid) {
+		fmt.Println("Archiving accounts needs every account in this process and no -hybrid")
+		return
+	}
+
+	// the money supply and the balances over the time of the run
+	if *supplySeries != "" {
+		sink, err := bank.NewSupplySink(config.Storage, *supplySeries, scenario.Accounts, scenario.Balances)
+		if err != nil {
+			fmt.Println("Error creating money supply file:", err)
+			return
+		}
+		defer sink.Close()
+		config.Sinks = append(config.Sinks, sink)
+	}
+
+	// a run aborted by a limit, the timeout or the watchdog still leaves its
+	// balances and metrics so far
+	var run *bank.Simulation
+	config.OnAbort = func(metrics bank.Metrics) {
+		if err := run.WriteFinalBalances(finalName); err != nil {
+			fmt.Println(err)
+		}
+		outFile := fmt.Sprintf("metrics_%s.json", metrics.Algorithm)
+		if err := metrics.Write(config.Storage, outFile); err != nil {
+			fmt.Println("Error writing metrics file:", err)
+			return
+		}
+		fmt.Println("Partial metrics saved to", filepath.Join(*outputDir, outFile))
+		metrics.Print()
+	}
+	run = bank.NewSimulation(config, scenario)
+	if live != nil {
+		live.Attach(run)
+		feed.Attach(run)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", live)
+		mux.Handle("/events", feed)
+		go http.Serve(metricsListener, mux)
+		fmt.Printf("Serving metrics on http://%s/metrics and the balance feed on http://%s/events\n", metricsListener.Addr(), metricsListener.Addr())
+	}
+	if *hybrid {
+		fmt.Printf("Hybrid mode: %d accounts in %d sites\n", scenario.Accounts, run.Network().Sites())
+	}
+	metrics := run.Run()
+	if acceptance != nil {
+		result := run.Check(*acceptance, metrics)
+		metrics.Acceptance = &result
+	}
+	if trace != nil {
+		report := bank.CheckSafety(trace.Events(), scenario.Balances, bank.BalanceFloor(config.Funds))
+		metrics.Safety = &report
+	}
+
+	// register the final balances of the accounts
+	if err := run.WriteFinalBalances(finalName); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output metrics
+	outFile := fmt.Sprintf("metrics_%s.json", metrics.Algorithm)
+	if err := metrics.Write(config.Storage, outFile); err != nil {
+		fmt.Println("Error writing metrics file:", err)
+		return
+	}
+	fmt.Println("Performance metrics saved to", filepath.Join(*outputDir, outFile))
+	metrics.Print()
+
+	if recorder != nil {
+		sections := map[string]string{
+			finalName:          "balances",
+			outFile:            "metrics",
+			config.LogName:     "logs",
+			config.Checkpoint:  "checkpoints",
+			config.WALSnapshot: "checkpoints",
+		}
+		for _, trace := range []string{*events, config.WAL} {
+			if trace != "" {
+				sections[filepath.Base(trace)] = "traces"
+			}
+		}
+		if err := writeRunBundle(config.Storage, recorder, *bundle, sections, metrics, folder_name, run.Network().TimeSource); err != nil {
+			fmt.Println("Error writing the bundle:", err)
+		} else {
+			fmt.Println("Run bundle saved to", filepath.Join(*outputDir, *bundle))
+		}
+	}
+
+	if metrics.Acceptance != nil && !metrics.Acceptance.Passed || metrics.Safety != nil && !metrics.Safety.Passed || !metrics.ChaosPassed() || metrics.Shutdown != nil && !metrics.Shutdown.Agreed {
+		os.Exit(1)
+	}
+}
+
+func validOrdering(ordering mutex.Ordering) bool {
+	for _, known := range mutex.Orderings {
+		if ordering == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// amountDistributions draw the amount of a transfer between 1 and largest
+var amountDistributions = map[string]func(random *rand.Rand, largest int) int{
+	"uniform": func(random *rand.Rand, largest int) int {
+		return 1 + random.Intn(largest)
+	},
+	// mostly small amounts, averaging a tenth of the largest
+	"exponential": func(random *rand.Rand, largest int) int {
+		return min(largest, 1+int(random.ExpFloat64()*float64(largest)/10))
+	},
+	// heavy tail: many tiny amounts and a few close to the largest
+	"pareto": func(random *rand.Rand, largest int) int {
+		scale := max(1.0, float64(largest)/100)
+		return min(largest, int(scale/math.Pow(1-random.Float64(), 1/1.16)))
+	},
+}
+
+const scaffoldUsage = "[--accounts N] [--transactions M] [--seed S] [--amounts uniform|exponential|pareto] [--max-sleep MS] [--pattern SPEC] [--profiles SPEC] [--quorums maekawa|grid|full] [--dir DIR]"
+
+func newTest(args []string) {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("Usage: go run ./cmd/banksim new-test <name>", scaffoldUsage)
+		return
+	}
+	scaffold("new-test", args[0], args[1:])
+}
+
+func generate(args []string) {
+	// like new-test, in the next free test_N folder
+	scaffold("generate", "", args)
+}
+
+func scaffold(command string, name string, args []string) {
+	// scaffold a test folder with fundable transactions, quorums and the
+	// expected final balances
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	n_accounts := flags.Int("accounts", 5, "number of accounts")
+	m_transactions := flags.Int("transactions", 40, "number of transfers between accounts")
+	seed := flags.Int64("seed", 1, "seed for the random generator")
+	max_sleep := flags.Int("max-sleep", 0, "maximum pause after a transfer in ms")
+	patternSpec := flags.String("pattern", "", "think-time pattern replacing --max-sleep, e.g. burst:50,idle:2000,diurnal:200:5:100")
+	profileSpec := flags.String("profiles", "", "accounts with a behaviour, e.g. trader:3,payer:1,dormant:2; the others are regular")
+	amounts := flags.String("amounts", "uniform", "distribution of the transfer amounts: uniform, exponential or pareto")
+	quorumLayout := flags.String("quorums", "grid", "quorum layout: maekawa, grid or full")
+	dir := flags.String("dir", "tests", "folder the test is created in")
+	if err := flags.Parse(args); err != nil {
+		return
+	}
+	if *n_accounts < 2 || *m_transactions < 0 || *max_sleep < 0 {
+		fmt.Println("A test needs at least 2 accounts and non-negative transactions and sleep")
+		return
+	}
+	distribution, ok := amountDistributions[*amounts]
+	if !ok {
+		fmt.Println("Unknown amount distribution:", *amounts)
+		return
+	}
+	layout, ok := mutex.QuorumGenerators[*quorumLayout]
+	if !ok {
+		fmt.Println("Unknown quorum layout:", *quorumLayout)
+		return
+	}
+
+	var pattern *loadPattern
+	if *patternSpec != "" {
+		var err error
+		if pattern, err = parsePattern(*patternSpec); err != nil {
+			fmt.Println("Invalid pattern:", err)
+			return
+		}
+	}
+
+	random := rand.New(rand.NewSource(*seed))
+	load, err := parseProfiles(*profileSpec, *n_accounts, random)
+	if err != nil {
+		fmt.Println("Invalid profiles:", err)
+		return
+	}
+
+	if name == "" {
+		for n := 1; ; n++ {
+			name = fmt.Sprintf("test_%d", n)
+			if _, err := os.Stat(filepath.Join(*dir, name)); err != nil {
+				break
+			}
+		}
+	}
+	folder_name := filepath.Join(*dir, name)
+	if _, err := os.Stat(folder_name); err == nil {
+		fmt.Println("Test folder already exists:", folder_name)
+		return
+	}
+	if err := os.MkdirAll(folder_name, 0755); err != nil {
+		fmt.Println("Error creating test folder:", err)
+		return
+	}
+
+	balances := make([]int, *n_accounts)
+	lines := make([]string, 0, *n_accounts+*m_transactions)
+
+	// initial funding of every account by the bank (-1)
+	for i := range balances {
+		balances[i] = 100 * (10 + random.Intn(91))
+		lines = append(lines, fmt.Sprintf("-1,%d,%d,0", balances[i], i))
+		if load != nil {
+			load.fund(i, balances[i])
+		}
+	}
+
+	// transfers are affordable when executed in file order, which guarantees
+	// that every account eventually gets the money it waits for
+	for len(lines) < *n_accounts+*m_transactions {
+		var from, to, money int
+		if load != nil {
+			from = load.sender(balances)
+			to = load.receiver(from)
+			money = load.amount(from, balances[from], distribution)
+		} else {
+			from = random.Intn(*n_accounts)
+			if balances[from] == 0 {
+				continue
+			}
+			to = random.Intn(*n_accounts - 1)
+			if to >= from {
+				to++
+			}
+			money = distribution(random, balances[from])
+		}
+		sleep := 0
+		if pattern != nil {
+			sleep = pattern.pause(len(lines)-*n_accounts, random)
+		} else if *max_sleep > 0 {
+			sleep = random.Intn(*max_sleep + 1)
+		}
+		balances[from] -= money
+		balances[to] += money
+		lines = append(lines, fmt.Sprintf("%d,%d,%d,%d", from, money, to, sleep))
+	}
+
+	transactions := fmt.Sprintf("%d,%d\n%s\n", *n_accounts, len(lines), strings.Join(lines, "\n"))
+
+	var quorum strings.Builder
+	for _, members := range layout(*n_accounts) {
+		parts := make([]string, len(members))
+		for j, member := range members {
+			parts[j] = strconv.Itoa(member)
+		}
+		quorum.WriteString(strings.Join(parts, ",") + "\n")
+	}
+
+	final := ""
+	for i, balance := range balances {
+		final += fmt.Sprintf("%d,%s\n", i, bank.Money(balance*bank.MinorUnits))
+	}
+
+	files := map[string]string{
+		"transactions.txt": transactions,
+		"quorum.txt":       quorum.String(),
+		"final.txt":        final,
+		"acceptance.txt":   "non-negative-balances\nno-failures\n",
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(folder_name, file), []byte(content), 0644); err != nil {
+			fmt.Println("Error writing test file:", err)
+			return
+		}
+	}
+
+	fmt.Printf("Created %s with %d accounts and %d transfers\n", folder_name, *n_accounts, *m_transactions)
+	if load != nil {
+		fmt.Println("Profiles:", load.summary())
+	}
+}
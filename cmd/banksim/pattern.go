@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// loadPattern shapes the think time of generated transfers, i.e. the pause of
+// an account after a transfer. The spec is a comma-separated list of phases,
+// repeated until every transfer is generated:
+//
+//	burst:N                N transfers back to back
+//	steady:N:MS            N transfers with an average pause of MS
+//	idle:MS                one transfer followed by a pause of MS
+//	diurnal:N:MIN:MAX      N transfers over one "day": the average pause goes
+//	                       from MAX at night down to MIN at midday and back
+//
+// Pauses other than idle ones are drawn from an exponential distribution. The
+// accounts run their transfers concurrently, so a phase sets the load of the
+// stretch of the transactions file it covers rather than an exact schedule.
+type loadPattern struct {
+	phases []loadPhase
+	length int // transfers in one repetition of the phases
+}
+
+type loadPhase struct {
+	kind      string
+	count     int
+	low, high int // average pause in ms
+}
+
+func parsePattern(spec string) (*loadPattern, error) {
+	pattern := &loadPattern{}
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		numbers := make([]int, len(parts)-1)
+		for i, part := range parts[1:] {
+			number, err := strconv.Atoi(part)
+			if err != nil || number < 0 {
+				return nil, fmt.Errorf("invalid number %q in phase %q", part, field)
+			}
+			numbers[i] = number
+		}
+
+		phase := loadPhase{kind: parts[0]}
+		switch {
+		case phase.kind == "burst" && len(numbers) == 1:
+			phase.count = numbers[0]
+		case phase.kind == "steady" && len(numbers) == 2:
+			phase.count, phase.low, phase.high = numbers[0], numbers[1], numbers[1]
+		case phase.kind == "idle" && len(numbers) == 1:
+			phase.count, phase.low, phase.high = 1, numbers[0], numbers[0]
+		case phase.kind == "diurnal" && len(numbers) == 3:
+			phase.count, phase.low, phase.high = numbers[0], numbers[1], numbers[2]
+		default:
+			return nil, fmt.Errorf("invalid phase %q (expected burst:N, steady:N:MS, idle:MS or diurnal:N:MIN:MAX)", field)
+		}
+		pattern.phases = append(pattern.phases, phase)
+		pattern.length += phase.count
+	}
+	if pattern.length == 0 {
+		return nil, fmt.Errorf("pattern %q has no transfers", spec)
+	}
+	return pattern, nil
+}
+
+func (pattern *loadPattern) pause(i int, random *rand.Rand) int {
+	// the pause after the i-th generated transfer
+	i %= pattern.length
+	for _, phase := range pattern.phases {
+		if i >= phase.count {
+			i -= phase.count
+			continue
+		}
+		switch phase.kind {
+		case "burst":
+			return 0
+		case "idle":
+			return phase.low
+		case "diurnal":
+			day := (1 - math.Cos(2*math.Pi*float64(i)/float64(phase.count))) / 2
+			mean := float64(phase.high) - float64(phase.high-phase.low)*day
+			return int(random.ExpFloat64() * mean)
+		default:
+			return int(random.ExpFloat64() * float64(phase.low))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// accountProfile is the behaviour of a generated account: how often it sends
+// a transfer, how much it sends and to whom
+type accountProfile struct {
+	rate  float64 // chance of sending the next transfer relative to a regular account
+	share int     // largest amount sent at once, in percent of the balance
+	peers string  // "" any account, "same" mostly accounts of the same profile, "payroll" every other account in turn
+}
+
+// accountProfiles are the behaviours new-test can give accounts with --profiles;
+// the other accounts are regular
+var accountProfiles = map[string]accountProfile{
+	"regular": {rate: 1, share: 100},
+	// many small trades, mostly between traders: a hot spot of contention
+	"trader": {rate: 8, share: 5, peers: "same"},
+	// pays equal salaries to every other account in turn
+	"payer": {rate: 2, share: 100, peers: "payroll"},
+	// hardly ever moves money, but then a lot of it
+	"dormant": {rate: 0.1, share: 100},
+}
+
+// workload draws the transfers of accounts with profiles
+type workload struct {
+	random   *rand.Rand
+	profiles []string // profile of each account
+	salaries []int    // payer only: amount of a salary
+	payroll  []int    // payer only: the next account to pay
+}
+
+func parseProfiles(spec string, n_accounts int, random *rand.Rand) (*workload, error) {
+	// spec is a comma-separated list of profile:count; the accounts of each
+	// profile are picked at random
+	if spec == "" {
+		return nil, nil
+	}
+	load := &workload{
+		random:   random,
+		profiles: make([]string, n_accounts),
+		salaries: make([]int, n_accounts),
+		payroll:  make([]int, n_accounts),
+	}
+	order := random.Perm(n_accounts)
+	next := 0
+	for _, field := range strings.Split(spec, ",") {
+		name, count_str, _ := strings.Cut(strings.TrimSpace(field), ":")
+		count, err := strconv.Atoi(count_str)
+		if _, ok := accountProfiles[name]; !ok || err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid profile %q (expected name:count with a name among %s)", field, strings.Join(profileNames(), ", "))
+		}
+		if next+count > n_accounts {
+			return nil, fmt.Errorf("more profiles than the %d accounts", n_accounts)
+		}
+		for _, id := range order[next : next+count] {
+			load.profiles[id] = name
+		}
+		next += count
+	}
+	for _, id := range order[next:] {
+		load.profiles[id] = "regular"
+	}
+	return load, nil
+}
+
+func profileNames() []string {
+	names := make([]string, 0, len(accountProfiles))
+	for name := range accountProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (load *workload) fund(id int, balance int) {
+	// a payer's salary splits its funding among the other accounts
+	if load.profiles[id] == "payer" {
+		load.salaries[id] = max(1, balance/(len(load.profiles)-1))
+	}
+}
+
+func (load *workload) sender(balances []int) int {
+	// pick the account sending the next transfer by the rates of the profiles;
+	// accounts without money can't send
+	total := 0.0
+	for id, balance := range balances {
+		if balance > 0 {
+			total += accountProfiles[load.profiles[id]].rate
+		}
+	}
+	pick := load.random.Float64() * total
+	last := 0
+	for id, balance := range balances {
+		if balance <= 0 {
+			continue
+		}
+		last = id
+		pick -= accountProfiles[load.profiles[id]].rate
+		if pick < 0 {
+			return id
+		}
+	}
+	return last
+}
+
+func (load *workload) receiver(from int) int {
+	n := len(load.profiles)
+	profile := accountProfiles[load.profiles[from]]
+	switch profile.peers {
+	case "payroll":
+		to := load.payroll[from]
+		if to == from {
+			to = (to + 1) % n
+		}
+		load.payroll[from] = (to + 1) % n
+		return to
+	case "same":
+		// three trades in four go to another account of the same profile
+		if load.random.Intn(4) > 0 {
+			same := make([]int, 0)
+			for id, name := range load.profiles {
+				if id != from && name == load.profiles[from] {
+					same = append(same, id)
+				}
+			}
+			if len(same) > 0 {
+				return same[load.random.Intn(len(same))]
+			}
+		}
+	}
+	to := load.random.Intn(n - 1)
+	if to >= from {
+		to++
+	}
+	return to
+}
+
+func (load *workload) amount(from int, balance int, distribution func(*rand.Rand, int) int) int {
+	if load.profiles[from] == "payer" {
+		return min(balance, load.salaries[from])
+	}
+	largest := max(1, balance*accountProfiles[load.profiles[from]].share/100)
+	return distribution(load.random, largest)
+}
+
+func (load *workload) summary() string {
+	// the accounts of each profile other than regular, for the console
+	accounts := make(map[string][]string)
+	for id, name := range load.profiles {
+		if name != "regular" {
+			accounts[name] = append(accounts[name], strconv.Itoa(id))
+		}
+	}
+	parts := make([]string, 0, len(accounts))
+	for _, name := range profileNames() {
+		if len(accounts[name]) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", name, strings.Join(accounts[name], ",")))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+)
+
+func project(args []string) {
+	// rebuild projections from the structured event log of a run
+	if len(args) < 1 {
+		fmt.Println("Usage: go run ./cmd/banksim project <events.jsonl> [projection...]")
+		return
+	}
+	names := args[1:]
+	if len(names) == 0 {
+		for name := range bank.Projections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	projections := make([]bank.Projection, 0, len(names))
+	for _, name := range names {
+		newProjection, ok := bank.Projections[name]
+		if !ok {
+			fmt.Println("Unknown projection:", name)
+			return
+		}
+		projections = append(projections, newProjection())
+	}
+
+	events, err := bank.ReadEvents(bank.DiskStorage{}, args[0])
+	if err != nil {
+		fmt.Println("Error reading events:", err)
+		return
+	}
+	bank.Project(events, projections...)
+
+	for i, projection := range projections {
+		if len(projections) > 1 {
+			fmt.Printf("# %s\n", names[i])
+		}
+		projection.Report(os.Stdout)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// transportLatency is the round-trip time of a message between two accounts
+// over one transport
+type transportLatency struct {
+	Transport string              `json:"transport"`
+	Rounds    int                 `json:"rounds"`
+	RoundTrip bank.LatencySummary `json:"roundTripMs"`
+	Error     string              `json:"error,omitempty"`
+}
+
+func measureTransports(rounds int) []transportLatency {
+	// bounce a message between two accounts over each transport; with TCP and
+	// shared memory the two accounts have transports of their own, as if they
+	// ran in two processes
+	results := make([]transportLatency, 0, 3)
+	for _, name := range []string{"channel", "tcp", "shm"} {
+		result := transportLatency{Transport: name, Rounds: rounds}
+		pair, cleanup, err := transportPair(name)
+		if err == nil {
+			var durations []time.Duration
+			durations, err = pingPong(pair, rounds)
+			result.RoundTrip = bank.Summarize(durations)
+		}
+		if cleanup != nil {
+			cleanup()
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func transportPair(name string) ([2]mutex.Transport, func(), error) {
+	// the transports accounts 0 and 1 receive their messages from
+	switch name {
+	case "channel":
+		transport := mutex.NewChannelTransport(2)
+		return [2]mutex.Transport{transport, transport}, func() { transport.Close() }, nil
+	case "tcp":
+		addresses := make([]string, 2)
+		for i := range addresses {
+			// a free port of the loopback interface
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				return [2]mutex.Transport{}, nil, err
+			}
+			addresses[i] = listener.Addr().String()
+			listener.Close()
+		}
+		a, err := mutex.NewTCPTransport(addresses, []int{0})
+		if err != nil {
+			return [2]mutex.Transport{}, nil, err
+		}
+		b, err := mutex.NewTCPTransport(addresses, []int{1})
+		if err != nil {
+			a.Close()
+			return [2]mutex.Transport{}, nil, err
+		}
+		return [2]mutex.Transport{a, b}, func() { a.Close(); b.Close() }, nil
+	default:
+		dir, err := os.MkdirTemp(shmDir(), "banksim-bench-")
+		if err != nil {
+			return [2]mutex.Transport{}, nil, err
+		}
+		a, err := mutex.NewSharedMemoryTransport(dir, 2, []int{0})
+		if err != nil {
+			os.RemoveAll(dir)
+			return [2]mutex.Transport{}, nil, err
+		}
+		b, err := mutex.NewSharedMemoryTransport(dir, 2, []int{1})
+		if err != nil {
+			a.Close()
+			os.RemoveAll(dir)
+			return [2]mutex.Transport{}, nil, err
+		}
+		return [2]mutex.Transport{a, b}, func() { a.Close(); b.Close(); os.RemoveAll(dir) }, nil
+	}
+}
+
+func shmDir() string {
+	// in memory where the system has it
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+func pingPong(pair [2]mutex.Transport, rounds int) ([]time.Duration, error) {
+	// account 1 sends every message back to account 0
+	go func() {
+		for message := range pair[1].Receive(1) {
+			pair[1].Send(mutex.Message{Kind: "data", From: 1, To: 0, Data: message.Data})
+		}
+	}()
+	durations := make([]time.Duration, 0, rounds)
+	for i := 0; i < rounds; i++ {
+		start := time.Now()
+		if err := pair[0].Send(mutex.Message{Kind: "data", From: 0, To: 1, Data: []byte("ping")}); err != nil {
+			return durations, err
+		}
+		select {
+		case <-pair[0].Receive(0):
+		case <-time.After(5 * time.Second):
+			return durations, fmt.Errorf("no answer after %d rounds", i)
+		}
+		durations = append(durations, time.Since(start))
+	}
+	return durations, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+)
+
+func verify(args []string) {
+	// check the safety invariants on the structured event log of a run
+	if len(args) < 1 {
+		fmt.Println("Usage: go run ./cmd/banksim verify <events.jsonl> [folder] [-credit-line amount]")
+		return
+	}
+	positional := 1
+	if len(args) > 1 && args[1] != "" && args[1][0] != '-' {
+		positional = 2
+	}
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	creditLine := flags.String("credit-line", "0", "the credit line of the run, if it ran with -funds-rule credit")
+	flags.Parse(args[positional:])
+	limit, err := bank.ParseMoney(*creditLine)
+	if err != nil || limit < 0 {
+		fmt.Println("Invalid credit line:", *creditLine)
+		return
+	}
+
+	storage := bank.DiskStorage{}
+	events, err := bank.ReadEvents(storage, args[0])
+	if err != nil {
+		fmt.Println("Error reading events:", err)
+		return
+	}
+
+	// the opening balances of the test folder, if the run had any
+	var balances map[int]bank.Money
+	if positional > 1 {
+		scenario, err := bank.LoadScenario(storage, args[1])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		balances = scenario.Balances
+	}
+
+	report := bank.CheckSafety(events, balances, bank.BalanceFloor(bank.CreditLineRule{Limit: limit}))
+	fmt.Println("Safety:", report)
+	if !report.Passed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,198 @@
+// Command libbanksim is the simulation core built as a C shared library, so
+// other languages (Python notebooks through ctypes, for instance) can run
+// scenarios and collect their metrics without shelling out to banksim:
+//
+//	go build -buildmode=c-shared -o libbanksim.so ./cmd/libbanksim
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/bank"
+	"github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion/mutex"
+)
+
+// options of a run, given as a JSON object; all of them are optional
+type options struct {
+	OutputDir   string  `json:"outputDir"`   // where the files of the run go; kept in memory when empty
+	Quorums     string  `json:"quorums"`     // generated quorums: maekawa, grid or full
+	Seed        int64   `json:"seed"`        // shuffle the order the accounts start in
+	TimeScale   float64 `json:"timeScale"`   // speed factor of the arrivals, pauses and timeouts
+	FundingWait string  `json:"fundingWait"` // block, reorder or fail-fast
+	FundsRule   string  `json:"fundsRule"`   // balance, pending or credit
+	CreditLine  string  `json:"creditLine"`  // the limit of the credit rule
+	Verify      bool    `json:"verify"`      // check safety from the events of the run
+}
+
+// result is what banksim_run returns: the metrics of the run and the lines
+// the run would have printed, since the library writes nothing to stdout
+type result struct {
+	bank.Metrics
+	Output []string `json:"output,omitempty"`
+}
+
+// output collects the lines printed by the accounts of a run
+type output struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (out *output) Write(p []byte) (int, error) {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	return out.buffer.Write(p)
+}
+
+func (out *output) lines() []string {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	text := strings.TrimSuffix(out.buffer.String(), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// banksim_run runs the scenario of a test folder with an algorithm (original,
+// optimized, token-ring or suzuki-kasami; empty for the default) and options
+// (a JSON object, or NULL), and returns the metrics of the run as JSON, with
+// what the run printed under "output", or {"error": "..."} if it couldn't
+// run. The caller frees the result with banksim_free.
+//
+//export banksim_run
+func banksim_run(folder *C.char, algorithm *C.char, optionsJSON *C.char) *C.char {
+	metrics, err := run(C.GoString(folder), C.GoString(algorithm), C.GoString(optionsJSON))
+	if err != nil {
+		data, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return C.CString(string(data))
+	}
+	return C.CString(string(metrics))
+}
+
+// banksim_free frees a result of banksim_run
+//
+//export banksim_free
+func banksim_free(result *C.char) {
+	C.free(unsafe.Pointer(result))
+}
+
+func run(folder string, algorithm string, optionsJSON string) ([]byte, error) {
+	var opts options
+	if strings.TrimSpace(optionsJSON) != "" {
+		if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+	}
+
+	config := bank.DefaultConfig()
+	if algorithm != "" {
+		config.Algorithm = mutex.Algorithm(algorithm)
+	}
+	switch config.Algorithm {
+	case mutex.Original, mutex.Optimized, mutex.TokenRing, mutex.SuzukiKasami:
+	default:
+		return nil, fmt.Errorf("invalid algorithm: %s (expected original, optimized, token-ring or suzuki-kasami)", config.Algorithm)
+	}
+	config.Seed = opts.Seed
+	config.Faults.Seed = opts.Seed
+	if opts.TimeScale < 0 {
+		return nil, fmt.Errorf("invalid time scale: %g (expected a positive factor)", opts.TimeScale)
+	}
+	if opts.TimeScale > 0 && opts.TimeScale != 1 {
+		config.Clock = mutex.NewScaledClock(opts.TimeScale)
+	}
+
+	if opts.FundingWait == "" {
+		opts.FundingWait = "block"
+	}
+	strategy, ok := bank.FundingStrategies[opts.FundingWait]
+	if !ok {
+		return nil, fmt.Errorf("invalid funding wait strategy: %s (expected block, reorder or fail-fast)", opts.FundingWait)
+	}
+	config.Funding = strategy
+	if opts.FundsRule != "" {
+		rule, ok := bank.FundsRules[opts.FundsRule]
+		if !ok {
+			return nil, fmt.Errorf("invalid funds rule: %s (expected balance, pending or credit)", opts.FundsRule)
+		}
+		if credit, ok := rule.(bank.CreditLineRule); ok {
+			limit, err := bank.ParseMoney(opts.CreditLine)
+			if err != nil || limit < 0 {
+				return nil, fmt.Errorf("invalid credit line: %q", opts.CreditLine)
+			}
+			credit.Limit = limit
+			rule = credit
+		}
+		config.Funds = rule
+	}
+
+	// the test folder is read from disk; without an output directory the
+	// files of the run are only kept in memory
+	if opts.OutputDir != "" {
+		if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+			return nil, err
+		}
+		config.Storage = bank.OutputStorage{Storage: bank.DiskStorage{}, Dir: opts.OutputDir}
+	} else {
+		abs, err := filepath.Abs(folder)
+		if err != nil {
+			return nil, err
+		}
+		folder = abs
+		config.Storage = bank.NewMemoryStorage(os.DirFS("/"))
+	}
+	out := &output{}
+	config.Output = out
+	var trace *bank.MemorySink
+	if opts.Verify {
+		trace = &bank.MemorySink{}
+		config.Sinks = append(config.Sinks, trace)
+	}
+	finalName := "final.txt"
+	if config.Algorithm == mutex.Original {
+		config.LogName = "logs_og.txt"
+		finalName = "final_og.txt"
+	}
+
+	scenario, err := bank.LoadScenario(config.Storage, folder)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Quorums != "" {
+		generate, ok := mutex.QuorumGenerators[opts.Quorums]
+		if !ok {
+			return nil, fmt.Errorf("invalid quorums: %s (expected maekawa, grid or full)", opts.Quorums)
+		}
+		scenario.Quorums = generate(scenario.Accounts)
+	}
+
+	simulation := bank.NewSimulation(config, scenario)
+	metrics := simulation.Run()
+	if trace != nil {
+		report := bank.CheckSafety(trace.Events(), scenario.Balances, bank.BalanceFloor(config.Funds))
+		metrics.Safety = &report
+	}
+	if err := simulation.WriteFinalBalances(finalName); err != nil {
+		return nil, err
+	}
+	if opts.OutputDir != "" {
+		if err := metrics.Write(config.Storage, fmt.Sprintf("metrics_%s.json", metrics.Algorithm)); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(result{Metrics: metrics, Output: out.lines()})
+}
+
+func main() {}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestRunWritesNothingToStdout(t *testing.T) {
+	// the failed transactions of a fail-fast run come back in the metrics
+	// JSON instead of on the standard output of the host process
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		printed <- data
+	}()
+	stdout := os.Stdout
+	os.Stdout = writer
+	data, err := run("../../tests/test_1", "optimized", `{"fundingWait": "fail-fast", "timeScale": 20}`)
+	os.Stdout = stdout
+	writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := <-printed; len(data) > 0 {
+		t.Fatalf("the run printed to stdout:\n%s", data)
+	}
+
+	var metrics struct {
+		Output []string `json:"output"`
+	}
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics.Output) == 0 {
+		t.Fatal("no output in the metrics JSON")
+	}
+}
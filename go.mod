@@ -0,0 +1,3 @@
+module github.com/abhinavsaluja2004/BankTransaction_using_mutual_exclusion
+
+go 1.21
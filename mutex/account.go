@@ -0,0 +1,534 @@
+package mutex
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Account struct {
+	// an account in the bank
+	network           *Network
+	id                int
+	turn              int
+	highestTurn       int
+	requestCS         bool
+	deferred_queue    []Request
+	deferred_mutex    sync.Mutex
+	outstandingPermit map[int]bool   // RC optimization: keep track of permissions
+	grantedPermit     map[int]grant  // optimized: the accounts holding our vote
+	permitSeq         map[int]int    // the last approval received from each account, by its sequence number
+	early             map[int]Signal // optimized: revocations that overtook the approval they claim back
+	deferred_revokes  []int
+	entered           bool         // permission-based: set while inside the CS, where every conflicting request is deferred
+	resources         []int        // resource mode: the accounts requested or held, nil for the whole CS
+	single            map[int]bool // resource mode: permissions good for the current entry only
+	prefetched        map[int]bool // prefetching: quorum members asked ahead of the next entry
+	stale             map[int]int  // prefetching and aging: approvals to drop when they arrive, given back before they did
+	aged              bool         // aging: the pending request waited longer than Network.Aging
+	background        bool         // the pending request is for background work (EnterBackground)
+	permit_mutex      sync.Mutex
+	quorum            []int       // Quorum-based communication: list of accounts needed for approval
+	wantsToken        int32       // token-ring: set while the account waits for or holds the CS
+	site              *Account    // hybrid mode: the group member taking part in the distributed protocol
+	group             *sync.Mutex // hybrid mode: local lock shared by the co-located accounts
+	tokenGrant        chan struct{}
+	tokenRelease      chan struct{}
+	rn                []int    // Suzuki-Kasami: highest request number received from each account
+	token             *skToken // Suzuki-Kasami: the token, while this account holds it
+	inCS              bool     // Suzuki-Kasami: set while the account uses the token
+	sk_mutex          sync.Mutex
+	requestSeq        sequencer
+	approveSeq        sequencer
+	revokeSeq         sequencer
+	yieldSeq          sequencer
+	requestInbox      inbox           // only used by the listen goroutine
+	revokeInbox       inbox           // only used by the listen goroutine
+	approveInbox      inbox           // only used by the listen goroutine
+	yieldInbox        inbox           // only used by the listen goroutine
+	lastRequest       map[int]Message // the last request sent to each account, sent again on timeouts
+	wake              chan struct{}   // signalled when an approval arrives or a peer fails
+	gone              chan struct{}   // closed once the account left, ending its goroutines
+	halted            int32
+	clock             int64 // Lamport clock, advanced by every observed event
+}
+
+func newAccount(network *Network, id int, quorum []int, n_accounts int) *Account {
+	// create a new account with the given id and quorum
+	duplicates := &network.counters.Duplicates
+	return &Account{
+		network:           network,
+		id:                id,
+		turn:              0,
+		highestTurn:       0,
+		requestCS:         false,
+		deferred_queue:    make([]Request, 0),
+		outstandingPermit: make(map[int]bool),
+		grantedPermit:     make(map[int]grant),
+		permitSeq:         make(map[int]int),
+		early:             make(map[int]Signal),
+		deferred_revokes:  make([]int, 0),
+		prefetched:        make(map[int]bool),
+		stale:             make(map[int]int),
+		single:            make(map[int]bool),
+		quorum:            quorum,
+		requestSeq:        newSequencer(),
+		approveSeq:        newSequencer(),
+		revokeSeq:         newSequencer(),
+		yieldSeq:          newSequencer(),
+		requestInbox:      newInbox(duplicates),
+		revokeInbox:       newInbox(duplicates),
+		approveInbox:      newInbox(duplicates),
+		yieldInbox:        newInbox(duplicates),
+		tokenGrant:        make(chan struct{}),
+		tokenRelease:      make(chan struct{}),
+		rn:                make([]int, n_accounts),
+		lastRequest:       make(map[int]Message),
+		wake:              make(chan struct{}, 1),
+		gone:              make(chan struct{}),
+	}
+}
+
+func (account *Account) ID() int {
+	return account.id
+}
+
+func (account *Account) Quorum() []int {
+	return append([]int(nil), account.quorum...)
+}
+
+func (account *Account) NewRequest() Request {
+	// create a new request with the given turn and id
+	return Request{
+		turn: account.turn,
+		id:   account.id,
+	}
+}
+
+// Enter blocks until the account holds the critical section. In hybrid mode
+// co-located accounts first take their local lock, then the group's site asks
+// for the distributed CS.
+func (account *Account) Enter() {
+	if account.group != nil {
+		account.group.Lock()
+	}
+	site := account.siteAccount()
+	site.askCS(site.NewRequest())
+}
+
+// EnterBackground is Enter, or EnterFor with resources, for background work
+// such as the system lane of the bank: with the permission-based algorithms
+// its request goes after the requests that aren't, unless it ages first. The
+// token-based algorithms serve it like any other. Release it with Exit.
+func (account *Account) EnterBackground(resources ...int) {
+	if account.group != nil {
+		account.group.Lock()
+	}
+	site := account.siteAccount()
+	request := site.NewRequest()
+	request.resources = normalizeResources(resources)
+	request.background = true
+	site.askCS(request)
+}
+
+// Exit releases the critical section entered with Enter
+func (account *Account) Exit() {
+	account.siteAccount().releaseCS()
+	if account.group != nil {
+		account.group.Unlock()
+	}
+}
+
+// Waiting returns how many other accounts are waiting for this account (or
+// its site) to release the CS
+func (account *Account) Waiting() int {
+	site := account.siteAccount()
+	if account.network.Algorithm() == SuzukiKasami {
+		return site.skWaiting()
+	}
+	site.deferred_mutex.Lock()
+	defer site.deferred_mutex.Unlock()
+	waiting := make(map[int]bool)
+	for _, request := range site.deferred_queue {
+		waiting[request.id] = true
+	}
+	return len(waiting)
+}
+
+func (account *Account) siteAccount() *Account {
+	// the account running the distributed protocol for this one
+	if account.site != nil {
+		return account.site
+	}
+	return account
+}
+
+func (account *Account) sendRequest(request Request) {
+	// RC optimization: send request only to accounts not in outstandingPermit
+	// and only to accounts in the quorum
+	var sentCount int64 = 0
+
+	account.permit_mutex.Lock()
+	targets := account.missingPermits()
+	account.permit_mutex.Unlock()
+
+	for _, qid := range targets {
+		if account.isPrefetched(qid) {
+			// prefetching: the speculative request is still answered
+			continue
+		}
+		account.request(qid, request.turn)
+		sentCount++
+	}
+
+	// Update metrics
+	atomic.AddInt64(&account.network.counters.Requests, sentCount)
+}
+
+func (account *Account) request(to int, turn int) {
+	// send a request for the given turn, keeping it in case it has to be sent
+	// again
+	message := Message{Kind: "request", From: account.id, To: to, Turn: turn, Seq: account.requestSeq.stamp(to)}
+	account.permit_mutex.Lock()
+	message.Resources = account.resources
+	message.Aged = account.aged
+	message.Background = account.background
+	account.lastRequest[to] = message
+	account.permit_mutex.Unlock()
+	account.network.observe("request", account.id, to)
+	account.network.send(message)
+}
+
+func (account *Account) slowDown() {
+	// the processing delay of a slow account before it answers
+	if delay := account.network.SlowAccounts[account.id]; delay > 0 {
+		account.network.clock().Sleep(delay)
+	}
+}
+
+func (account *Account) approveRequest(request Request, once bool) {
+	// send an approval to the account that made the request; an approval
+	// given while we ask for or hold other accounts (resource mode) is only
+	// good for that request, as the requester could otherwise use it later
+	// for the accounts we hold
+	account.sendApproval(request.id, account.approveSeq.stamp(request.id), once)
+}
+
+func (account *Account) sendApproval(to int, seq int, once bool) {
+	account.slowDown()
+	account.network.observe("approve", account.id, to)
+	account.network.send(Message{Kind: "approve", From: account.id, To: to, Seq: seq, Once: once})
+
+	// Update metrics
+	atomic.AddInt64(&account.network.counters.Approvals, 1)
+}
+
+func (account *Account) receiveApproval(approval Signal) {
+	// take the permission of a quorum member, and wake the account waiting
+	// for it
+	network := account.network
+	account.approveInbox.accept(approval.id, approval.seq, func() {
+		network.observe("approved", account.id, approval.id)
+		account.permit_mutex.Lock()
+		if account.stale[approval.id] > 0 {
+			// prefetching: an approval we already gave back
+			account.stale[approval.id]--
+		} else {
+			account.outstandingPermit[approval.id] = true
+			account.single[approval.id] = approval.once
+		}
+		account.permitSeq[approval.id] = approval.seq
+		revoke, early := account.early[approval.id]
+		back, again := false, false
+		if early && revoke.grant <= approval.seq {
+			delete(account.early, approval.id)
+			if revoke.grant == approval.seq {
+				back, again = account.claimed(revoke)
+			}
+		}
+		turn := account.turn
+		account.permit_mutex.Unlock()
+		account.answerClaim(revoke, back, again, turn)
+
+		// Update metrics
+		atomic.AddInt64(&network.counters.Delivered, 1)
+	})
+	select {
+	case account.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (account *Account) missingPermits() []int {
+	// list the live quorum members we don't have a standing permission from;
+	// with the optimized algorithm that includes our own vote. The caller
+	// must hold permit_mutex.
+	voting := account.network.Algorithm() == Optimized
+	missing := make([]int, 0, len(account.quorum))
+	for _, qid := range account.quorum {
+		if (qid != account.id || voting) && !account.outstandingPermit[qid] && !account.network.isDead(qid) {
+			missing = append(missing, qid)
+		}
+	}
+	return missing
+}
+
+func (account *Account) waitForApproval() {
+	// wait until we hold a permission from every quorum member; a permission
+	// can be lost while waiting if we have to answer a higher priority request
+	network := account.network
+	retries := 0
+	var expired <-chan time.Time
+	if network.RequestTimeout > 0 {
+		ticker := network.clock().NewTicker(network.RequestTimeout)
+		defer ticker.Stop()
+		expired = ticker.C()
+	}
+	var aging <-chan time.Time
+	if network.Aging > 0 {
+		timer := network.clock().NewTimer(network.Aging)
+		defer timer.Stop()
+		aging = timer.C()
+	}
+	for {
+		account.permit_mutex.Lock()
+		missing := len(account.missingPermits())
+		if missing == 0 {
+			// from now on every request waits for the release; the approvals
+			// prefetched for this entry are used up
+			account.entered = true
+			account.prefetched = make(map[int]bool)
+		}
+		account.permit_mutex.Unlock()
+		if missing == 0 {
+			return
+		}
+
+		select {
+		case <-account.wake:
+		case <-aging:
+			account.boost()
+		case <-expired:
+			if retries < network.RequestRetries && account.retryRequests() {
+				retries++
+			} else {
+				account.suspectSilentPeers()
+				retries = 0
+			}
+		}
+	}
+}
+
+func (account *Account) askCS(request Request) {
+	// ask to enter the critical section
+	if account.network.Algorithm() == TokenRing {
+		atomic.StoreInt32(&account.wantsToken, 1)
+		<-account.tokenGrant
+		account.network.observe("enter", account.id, 0)
+		return
+	}
+	if account.network.Algorithm() == SuzukiKasami {
+		account.skAsk()
+		account.network.observe("enter", account.id, 0)
+		return
+	}
+
+	// the turns are read by the listen goroutine, under permit_mutex
+	account.permit_mutex.Lock()
+	account.turn += account.highestTurn + 1
+	request.turn = account.turn
+	account.resources = request.resources
+	account.background = request.background
+	account.requestCS = true
+	account.permit_mutex.Unlock()
+	account.sendRequest(request)
+	account.waitForApproval()
+	account.network.observe("enter", account.id, 0)
+}
+
+func (account *Account) isPrefetched(id int) bool {
+	account.permit_mutex.Lock()
+	defer account.permit_mutex.Unlock()
+	return account.prefetched[id]
+}
+
+func (account *Account) releaseCS() {
+	// release the critical section
+	account.network.observe("release", account.id, 0)
+	if account.network.Algorithm() == TokenRing {
+		atomic.StoreInt32(&account.wantsToken, 0)
+		account.tokenRelease <- struct{}{}
+		return
+	}
+	if account.network.Algorithm() == SuzukiKasami {
+		account.skRelease()
+		return
+	}
+	if account.network.Algorithm() == Optimized {
+		account.releaseVotes()
+		return
+	}
+	account.deferred_mutex.Lock()
+	account.permit_mutex.Lock()
+	account.requestCS = false
+	account.entered = false
+	account.resources = nil
+	account.aged = false
+	account.background = false
+	account.permit_mutex.Unlock()
+	for len(account.deferred_queue) > 0 {
+		request := account.deferred_queue[0]
+		account.deferred_queue = account.deferred_queue[1:]
+		account.approveRequest(request, false)
+	}
+	account.deferred_mutex.Unlock()
+
+	// every approval is only good for one entry, and so are the approvals we
+	// kept while giving ours for other resources (resource mode)
+	account.permit_mutex.Lock()
+	account.outstandingPermit = make(map[int]bool)
+	account.single = make(map[int]bool)
+	account.deferred_revokes = account.deferred_revokes[:0]
+	account.permit_mutex.Unlock()
+}
+
+func (account *Account) receiveRequest(request Request) {
+	// receive a request to enter the critical section
+	if account.network.Algorithm() == Optimized {
+		account.arbitrate(request)
+		return
+	}
+	if request.boost {
+		account.receiveBoost(request)
+		return
+	}
+	// decide under the locks taken to enter and release the CS, so a request
+	// is neither approved once we entered nor deferred once we released
+	account.deferred_mutex.Lock()
+	account.permit_mutex.Lock()
+	// change highetsTurn to the highest turn received
+	if request.turn > account.highestTurn {
+		account.highestTurn = request.turn
+	}
+	if account.conflicts(request.resources) && (account.entered || account.requestCS && !account.yields(request)) {
+		account.permit_mutex.Unlock()
+		account.deferred_queue = append(account.deferred_queue, request)
+		account.deferred_mutex.Unlock()
+		return
+	}
+
+	// resource mode: a request for other accounts than ours is approved for
+	// its entry only, as the accounts we ask for next may be its own
+	once := account.requestCS && !account.conflicts(request.resources)
+
+	// prefetching: answering the request gives away the speculative
+	// approval of the requester; if we are still waiting for the CS we have
+	// to ask again
+	revoked := false
+	if !once {
+		revoked = account.revokePrefetch(request.id)
+		if (request.aged || account.background && !request.background) && account.requestCS {
+			// aging, background work: the requester goes first although it
+			// may have approved us before it aged or asked for the CS
+			revoked = revoked || account.voidApproval(request.id)
+		}
+	}
+	requesting := account.requestCS
+	turn := account.turn
+	account.permit_mutex.Unlock()
+	account.deferred_mutex.Unlock()
+
+	account.approveRequest(request, once)
+	if revoked && requesting {
+		account.request(request.id, turn)
+		atomic.AddInt64(&account.network.counters.Requests, 1)
+	}
+}
+
+// RevokePermits claims back every vote the account gave with the optimized
+// algorithm (e.g. before leaving) so the holders have to ask it again for the
+// CS; they give it back at once unless they are inside the CS, then on their
+// release
+func (account *Account) RevokePermits() {
+	account.permit_mutex.Lock()
+	claims := make([]grant, 0, len(account.grantedPermit))
+	for id, vote := range account.grantedPermit {
+		vote.claimed = true
+		vote.claim = Request{id: -1}
+		account.grantedPermit[id] = vote
+		claims = append(claims, vote)
+	}
+	account.permit_mutex.Unlock()
+
+	account.sendVotes(nil, claims)
+}
+
+func (account *Account) listen(stop <-chan struct{}) {
+	// receive the requests, approvals, revocations and give-backs addressed
+	// to this account
+	routes := account.network.registry.route(account.id)
+	for {
+		select {
+		case request := <-routes.request:
+			account.requestInbox.accept(request.id, request.seq, func() {
+				if account.network.Algorithm() == SuzukiKasami {
+					account.skReceiveRequest(request)
+					return
+				}
+				account.receiveRequest(request)
+			})
+		case approval := <-routes.approve:
+			account.receiveApproval(approval)
+		case revoke := <-routes.revoke:
+			account.revokeInbox.accept(revoke.id, revoke.seq, func() {
+				account.receiveRevoke(revoke)
+			})
+		case yield := <-routes.yield:
+			account.yieldInbox.accept(yield.id, yield.seq, func() {
+				account.receiveYield(yield)
+			})
+		case <-stop:
+			return
+		case <-account.gone:
+			return
+		}
+	}
+}
+
+func (account *Account) circulateToken(stop <-chan struct{}) {
+	// token-ring: receive the token, let this account use the CS if it needs
+	// it and pass the token to the next account of the ring
+	network := account.network
+	for {
+		var epoch int
+		select {
+		case epoch = <-network.registry.route(account.id).token:
+		case <-stop:
+			return
+		case <-account.gone:
+			return
+		}
+		if !network.currentToken(epoch) || network.Algorithm() != TokenRing {
+			// a token of an older epoch, or the network switched to another
+			// algorithm
+			continue
+		}
+
+		if atomic.LoadInt32(&account.wantsToken) == 1 {
+			account.tokenGrant <- struct{}{}
+			<-account.tokenRelease
+		} else {
+			atomic.AddInt64(&network.counters.IdleTokenPasses, 1)
+		}
+
+		network.clock().Sleep(network.TokenHop)
+		account.slowDown()
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		network.send(Message{Kind: "token", From: account.id, To: network.nextAlive(account.id), Turn: epoch})
+		atomic.AddInt64(&network.counters.TokenPasses, 1)
+	}
+}
@@ -0,0 +1,112 @@
+package mutex
+
+import "sync/atomic"
+
+// Aging keeps a request from being passed over indefinitely. A request waiting
+// longer than Network.Aging for its approvals becomes aged: the account sends
+// a boost to the quorum members still missing, and its requests go before the
+// requests that aren't aged until it releases the CS. Between two aged (or two
+// fresh) requests the (turn, id) priority still decides. A member that
+// deferred the request approves it on the boost unless it is inside the CS or
+// its own request is aged and goes first. An approval the requester may have
+// given us before it aged is void: we drop it when it arrives and ask the
+// requester again, so the two can't both hold the other's approval. Background
+// requests (EnterBackground) go after the others of the same age, and the
+// approval a requester gave our background request before asking for the CS
+// is void the same way.
+
+func (account *Account) yields(request Request) bool {
+	// whether the request goes before our own; the caller must hold
+	// permit_mutex
+	if request.aged != account.aged {
+		return request.aged
+	}
+	if request.background != account.background {
+		return account.background
+	}
+	return request.turn < account.turn || (request.turn == account.turn && request.id < account.id)
+}
+
+func (account *Account) boost() {
+	// our request waited too long: mark it aged at the quorum members whose
+	// approval is missing
+	account.permit_mutex.Lock()
+	if account.aged {
+		account.permit_mutex.Unlock()
+		return
+	}
+	account.aged = true
+	targets := account.missingPermits()
+	turn := account.turn
+	account.permit_mutex.Unlock()
+
+	for _, qid := range targets {
+		account.network.observe("boost", account.id, qid)
+		account.network.send(Message{Kind: "request", From: account.id, To: qid, Turn: turn, Seq: account.requestSeq.stamp(qid), Aged: true, Boost: true})
+	}
+
+	// Update metrics
+	atomic.AddInt64(&account.network.counters.Boosts, int64(len(targets)))
+}
+
+func (account *Account) receiveBoost(boost Request) {
+	// the requests of the account that we deferred are aged now; it arrives
+	// after them, as requests are delivered in order, so a request we already
+	// approved has nothing to boost
+	account.deferred_mutex.Lock()
+	account.permit_mutex.Lock()
+	kept := make([]Request, 0, len(account.deferred_queue))
+	boosted := make([]Request, 0, 1)
+	for _, request := range account.deferred_queue {
+		if request.id != boost.id {
+			kept = append(kept, request)
+			continue
+		}
+		request.aged = true
+		if account.entered || !account.yields(request) {
+			kept = append(kept, request)
+			continue
+		}
+		boosted = append(boosted, request)
+	}
+	account.deferred_queue = kept
+	revoked := false
+	if len(boosted) > 0 {
+		revoked = account.revokePrefetch(boost.id) || account.voidApproval(boost.id)
+	}
+	requesting := account.requestCS
+	turn := account.turn
+	account.permit_mutex.Unlock()
+	account.deferred_mutex.Unlock()
+
+	for _, request := range boosted {
+		account.approveRequest(request, false)
+	}
+	if revoked && requesting {
+		account.request(boost.id, turn)
+		atomic.AddInt64(&account.network.counters.Requests, 1)
+	}
+}
+
+func (account *Account) voidApproval(from int) bool {
+	// give back the approval of a quorum member we approve while requesting,
+	// held or still on its way, and report whether we have to ask it again;
+	// the caller must hold permit_mutex
+	if from == account.id || !account.inQuorum(from) {
+		return false
+	}
+	if !account.outstandingPermit[from] {
+		account.stale[from]++
+	}
+	account.outstandingPermit[from] = false
+	return true
+}
+
+func (account *Account) inQuorum(id int) bool {
+	for _, qid := range account.quorum {
+		if qid == id {
+			return true
+		}
+	}
+	return false
+}
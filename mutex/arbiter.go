@@ -0,0 +1,247 @@
+package mutex
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// Arbitration: with the optimized algorithm the permission of an account is a
+// vote it gives to one requester at a time (Maekawa), which the requester
+// keeps after its entry until the account claims it back (Roucairol-Carvalho).
+// Two requesters whose quorums share an account can't both hold its vote, so
+// quorums that only intersect are enough for mutual exclusion, whether the
+// account they share is idle or not. An account in its own quorum votes for
+// itself with the same messages. A request waiting for a vote held by another
+// account makes the arbiter revoke it with the priority of the waiting
+// request: an idle holder gives it back at once, a holder inside the CS when
+// it releases it, and a holder still waiting for other votes gives it back
+// and asks again if the waiting request goes before its own, otherwise when
+// it releases the CS. The arbiter then votes for the waiting requests in
+// order of priority, so no cycle of requesters can wait on each other. In
+// resource mode the arbiter votes at once for requests whose resources don't
+// conflict, and such a vote is given back when its holder releases the CS.
+
+// grant is a vote given by an arbiter: the request it answered, the approval
+// carrying it by its sequence number, and the waiting request it was last
+// claimed back for
+type grant struct {
+	request Request
+	seq     int
+	claimed bool
+	claim   Request
+}
+
+func precedes(a Request, b Request) bool {
+	// whether request a goes before request b: aged requests first, then
+	// those not for background work, then the (turn, id) priority
+	if a.aged != b.aged {
+		return a.aged
+	}
+	if a.background != b.background {
+		return b.background
+	}
+	return a.turn < b.turn || (a.turn == b.turn && a.id < b.id)
+}
+
+func (account *Account) arbitrate(request Request) {
+	// queue a request for our vote, or age the queued request of a boost, and
+	// vote for the requests first in line
+	account.deferred_mutex.Lock()
+	account.permit_mutex.Lock()
+	if request.boost {
+		for i := range account.deferred_queue {
+			if account.deferred_queue[i].id == request.id {
+				account.deferred_queue[i].aged = true
+			}
+		}
+	} else {
+		if request.turn > account.highestTurn {
+			account.highestTurn = request.turn
+		}
+		account.deferred_queue = append(account.deferred_queue, request)
+	}
+	votes, claims := account.serve()
+	account.permit_mutex.Unlock()
+	account.deferred_mutex.Unlock()
+
+	account.sendVotes(votes, claims)
+}
+
+func (account *Account) serve() ([]grant, []grant) {
+	// vote for the waiting requests in order of priority unless they conflict
+	// with a holder of our vote or an earlier request, and claim the vote back
+	// from the holders a waiting request conflicts with; the caller must hold
+	// deferred_mutex and permit_mutex
+	queue := account.deferred_queue
+	sort.SliceStable(queue, func(i, j int) bool {
+		return precedes(queue[i], queue[j])
+	})
+	votes := make([]grant, 0)
+	waiting := queue[:0]
+	for _, request := range queue {
+		if account.voteTaken(request, waiting) {
+			waiting = append(waiting, request)
+			continue
+		}
+		vote := grant{request: request, seq: account.approveSeq.stamp(request.id)}
+		account.grantedPermit[request.id] = vote
+		votes = append(votes, vote)
+	}
+	account.deferred_queue = waiting
+
+	claims := make([]grant, 0)
+	for id, vote := range account.grantedPermit {
+		for _, request := range waiting {
+			if request.id == id || !ResourcesOverlap(vote.request.resources, request.resources) {
+				continue
+			}
+			// the first conflicting request goes before the others
+			if !vote.claimed || precedes(request, vote.claim) {
+				vote.claimed = true
+				vote.claim = request
+				account.grantedPermit[id] = vote
+				claims = append(claims, vote)
+			}
+			break
+		}
+	}
+	return votes, claims
+}
+
+func (account *Account) voteTaken(request Request, earlier []Request) bool {
+	// whether a holder of our vote or an earlier waiting request conflicts
+	// with the request; the caller must hold permit_mutex
+	for _, vote := range account.grantedPermit {
+		if ResourcesOverlap(vote.request.resources, request.resources) {
+			return true
+		}
+	}
+	for _, other := range earlier {
+		if ResourcesOverlap(other.resources, request.resources) {
+			return true
+		}
+	}
+	return false
+}
+
+func (account *Account) sendVotes(votes []grant, claims []grant) {
+	// a vote for resources is good for that entry only
+	for _, vote := range votes {
+		account.sendApproval(vote.request.id, vote.seq, vote.request.resources != nil)
+	}
+	for _, vote := range claims {
+		account.revoke(vote.request.id, vote.seq, vote.claim)
+	}
+}
+
+func (account *Account) revoke(to int, seq int, waiting Request) {
+	// claim our vote back from its holder for the waiting request
+	account.network.observe("revoke", account.id, to)
+	account.network.send(Message{Kind: "revoke", From: account.id, To: to, Seq: account.revokeSeq.stamp(to), Grant: seq, Turn: waiting.turn, Aged: waiting.aged, Background: waiting.background, Requester: waiting.id})
+
+	// Update metrics
+	atomic.AddInt64(&account.network.counters.Revokes, 1)
+}
+
+func (account *Account) receiveYield(yield Signal) {
+	// a holder gave our vote back: vote for the requests first in line
+	account.deferred_mutex.Lock()
+	account.permit_mutex.Lock()
+	if vote, ok := account.grantedPermit[yield.id]; ok && vote.seq == yield.grant {
+		delete(account.grantedPermit, yield.id)
+	}
+	votes, claims := account.serve()
+	account.permit_mutex.Unlock()
+	account.deferred_mutex.Unlock()
+
+	account.sendVotes(votes, claims)
+}
+
+func (account *Account) receiveRevoke(revoke Signal) {
+	// an arbiter claims back its vote; a revocation overtaking the approval
+	// it claims back waits for it
+	account.permit_mutex.Lock()
+	seq, ok := account.permitSeq[revoke.id]
+	if !ok || revoke.grant > seq {
+		account.early[revoke.id] = revoke
+		account.permit_mutex.Unlock()
+		return
+	}
+	back, again := false, false
+	if revoke.grant == seq && account.outstandingPermit[revoke.id] {
+		back, again = account.claimed(revoke)
+	}
+	turn := account.turn
+	account.permit_mutex.Unlock()
+
+	account.answerClaim(revoke, back, again, turn)
+}
+
+func (account *Account) claimed(revoke Signal) (bool, bool) {
+	// whether to give back a vote claimed back now, and to ask for it again:
+	// we keep it until we release the CS if we are inside or our request goes
+	// before the waiting one; a revocation without a waiting request
+	// (RevokePermits) goes before ours. The caller must hold permit_mutex.
+	if account.requestCS && (account.entered || revoke.waiting.id >= 0 && !account.yields(revoke.waiting)) {
+		account.deferred_revokes = append(account.deferred_revokes, revoke.id)
+		return false, false
+	}
+	account.outstandingPermit[revoke.id] = false
+	if account.prefetched[revoke.id] {
+		// prefetching: Enter asks the arbiter again
+		delete(account.prefetched, revoke.id)
+		atomic.AddInt64(&account.network.counters.PrefetchRevoked, 1)
+	}
+	return true, account.requestCS
+}
+
+func (account *Account) answerClaim(revoke Signal, back bool, again bool, turn int) {
+	if back {
+		account.giveBack(revoke.id, revoke.grant)
+	}
+	if again {
+		account.request(revoke.id, turn)
+		atomic.AddInt64(&account.network.counters.Requests, 1)
+	}
+}
+
+func (account *Account) giveBack(to int, seq int) {
+	// give the vote of an arbiter back
+	account.network.observe("yield", account.id, to)
+	account.network.send(Message{Kind: "yield", From: account.id, To: to, Seq: account.yieldSeq.stamp(to), Grant: seq})
+
+	// Update metrics
+	atomic.AddInt64(&account.network.counters.GivenBack, 1)
+}
+
+func (account *Account) releaseVotes() {
+	// keep the votes we hold, except those claimed back while we used them
+	// and those good for this entry only (resource mode)
+	account.permit_mutex.Lock()
+	account.requestCS = false
+	account.entered = false
+	account.resources = nil
+	account.aged = false
+	account.background = false
+	back := make(map[int]int)
+	for id, once := range account.single {
+		if once && account.outstandingPermit[id] {
+			back[id] = account.permitSeq[id]
+		}
+	}
+	for _, id := range account.deferred_revokes {
+		if account.outstandingPermit[id] {
+			back[id] = account.permitSeq[id]
+		}
+	}
+	for id := range back {
+		account.outstandingPermit[id] = false
+	}
+	account.single = make(map[int]bool)
+	account.deferred_revokes = account.deferred_revokes[:0]
+	account.permit_mutex.Unlock()
+
+	for id, seq := range back {
+		account.giveBack(id, seq)
+	}
+}
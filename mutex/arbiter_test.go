@@ -0,0 +1,150 @@
+package mutex
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdleArbiterVotesOnce(t *testing.T) {
+	// accounts 0 and 1 only share account 2, which never asks for the CS: it
+	// must not let 1 in while 0 is inside
+	network := NewNetwork(Optimized, [][]int{{0, 2}, {1, 2}, {0, 1, 2}})
+	network.Start()
+	defer network.Stop()
+
+	network.Account(0).Enter()
+	entered := make(chan struct{})
+	go func() {
+		network.Account(1).Enter()
+		close(entered)
+	}()
+	select {
+	case <-entered:
+		t.Fatal("account 1 entered the CS while account 0 was inside")
+	case <-time.After(100 * time.Millisecond):
+	}
+	network.Account(0).Exit()
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("account 1 didn't enter the CS after account 0 released it")
+	}
+	network.Account(1).Exit()
+}
+
+func TestMutualExclusionUnderContention(t *testing.T) {
+	// every account enters the CS over and over, now and then for background
+	// work; no two may be inside at once
+	quorums := map[string][][]int{
+		"full":    FullQuorums(7),
+		"grid":    GridQuorums(7),
+		"maekawa": MaekawaQuorums(7),
+	}
+	for _, algorithm := range []Algorithm{Original, Optimized, TokenRing, SuzukiKasami} {
+		for name, quorums := range quorums {
+			t.Run(string(algorithm)+"/"+name, func(t *testing.T) {
+				network := NewNetwork(algorithm, quorums)
+				network.TokenHop = 0
+				network.Start()
+				defer network.Stop()
+
+				var inside, entries int32
+				var wg sync.WaitGroup
+				for id := 0; id < network.Len(); id++ {
+					wg.Add(1)
+					go func(account *Account) {
+						defer wg.Done()
+						for i := 0; i < 20; i++ {
+							if (account.ID()+i)%3 == 0 {
+								account.EnterBackground()
+							} else {
+								account.Enter()
+							}
+							if atomic.AddInt32(&inside, 1) != 1 {
+								t.Errorf("account %d entered the CS while another account was inside", account.ID())
+							}
+							atomic.AddInt32(&entries, 1)
+							atomic.AddInt32(&inside, -1)
+							account.Exit()
+						}
+					}(network.Account(id))
+				}
+				wg.Wait()
+				if entries != int32(20*network.Len()) {
+					t.Fatalf("%d CS entries, expected %d", entries, 20*network.Len())
+				}
+			})
+		}
+	}
+}
+
+func TestRevokePermitsClaimsStandingVotes(t *testing.T) {
+	// account 0 keeps the vote of account 2 after its entry until account 2
+	// claims it back, then has to ask for it again
+	network := NewNetwork(Optimized, [][]int{{0, 2}, {1, 2}, {0, 1, 2}})
+	network.Start()
+	defer network.Stop()
+
+	holder, arbiter := network.Account(0), network.Account(2)
+	holder.Enter()
+	holder.Exit()
+	if arbiter.votesOut() != 1 {
+		t.Fatalf("account 2 has %d votes out after the entry of account 0, expected 1", arbiter.votesOut())
+	}
+
+	arbiter.RevokePermits()
+	deadline := time.Now().Add(5 * time.Second)
+	for arbiter.votesOut() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if arbiter.votesOut() != 0 {
+		t.Fatal("account 0 didn't give the vote of account 2 back")
+	}
+	holder.permit_mutex.Lock()
+	kept := holder.outstandingPermit[2]
+	holder.permit_mutex.Unlock()
+	if kept {
+		t.Fatal("account 0 still counts on the vote it gave back")
+	}
+
+	holder.Enter()
+	holder.Exit()
+	if arbiter.votesOut() != 1 {
+		t.Fatal("account 0 entered the CS again without the vote of account 2")
+	}
+}
+
+func TestBackgroundRequestGoesLast(t *testing.T) {
+	// account 1 asks for background work before account 2 asks for the CS,
+	// while account 0 is inside: account 2 goes first all the same
+	for _, algorithm := range []Algorithm{Original, Optimized} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			network := NewNetwork(algorithm, FullQuorums(3))
+			network.Start()
+			defer network.Stop()
+
+			network.Account(0).Enter()
+			order := make(chan int, 2)
+			go func() {
+				network.Account(1).EnterBackground()
+				order <- 1
+				network.Account(1).Exit()
+			}()
+			time.Sleep(50 * time.Millisecond)
+			go func() {
+				network.Account(2).Enter()
+				order <- 2
+				network.Account(2).Exit()
+			}()
+			time.Sleep(50 * time.Millisecond)
+			network.Account(0).Exit()
+
+			if first := <-order; first != 2 {
+				t.Fatalf("account %d entered first, expected account 2", first)
+			}
+			<-order
+		})
+	}
+}
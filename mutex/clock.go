@@ -0,0 +1,299 @@
+package mutex
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of a network and of the runs on it, so timing
+// can run faster than the wall clock or be driven by hand. Waiting for the
+// network itself (dialing TCP peers, polling shared memory) stays on the
+// wall clock.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a Clock's time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker is a Clock's time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the wall clock
+type RealClock struct{}
+
+func (RealClock) Now() time.Time                         { return time.Now() }
+func (RealClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (RealClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (RealClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (RealClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct{ timer *time.Timer }
+
+func (timer realTimer) C() <-chan time.Time { return timer.timer.C }
+func (timer realTimer) Stop() bool          { return timer.timer.Stop() }
+
+type realTicker struct{ ticker *time.Ticker }
+
+func (ticker realTicker) C() <-chan time.Time { return ticker.ticker.C }
+func (ticker realTicker) Stop()               { ticker.ticker.Stop() }
+
+// ScaledClock runs Scale times faster than the wall clock from the moment it
+// is created: a 10ms sleep takes 1ms at scale 10, and Now moves 10ms per
+// millisecond
+type ScaledClock struct {
+	Scale float64
+	start time.Time
+}
+
+func NewScaledClock(scale float64) *ScaledClock {
+	return &ScaledClock{Scale: scale, start: time.Now()}
+}
+
+func (clock *ScaledClock) real(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / clock.Scale)
+}
+
+func (clock *ScaledClock) Now() time.Time {
+	return clock.start.Add(time.Duration(float64(time.Since(clock.start)) * clock.Scale))
+}
+
+func (clock *ScaledClock) Since(t time.Time) time.Duration { return clock.Now().Sub(t) }
+func (clock *ScaledClock) Sleep(d time.Duration)           { time.Sleep(clock.real(d)) }
+
+func (clock *ScaledClock) After(d time.Duration) <-chan time.Time {
+	return clock.NewTimer(d).C()
+}
+
+func (clock *ScaledClock) NewTimer(d time.Duration) Timer {
+	// the channel gets the scaled time the timer fired at
+	timer := &scaledTimer{c: make(chan time.Time, 1)}
+	timer.timer = time.AfterFunc(clock.real(d), func() {
+		select {
+		case timer.c <- clock.Now():
+		default:
+		}
+	})
+	return timer
+}
+
+func (clock *ScaledClock) NewTicker(d time.Duration) Ticker {
+	// the channel gets the scaled time of each tick, dropping the ticks
+	// nobody read like time.Ticker
+	ticker := &scaledTicker{ticker: time.NewTicker(max(clock.real(d), 1)), c: make(chan time.Time, 1), done: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case <-ticker.ticker.C:
+			case <-ticker.done:
+				return
+			}
+			select {
+			case ticker.c <- clock.Now():
+			default:
+			}
+		}
+	}()
+	return ticker
+}
+
+func (clock *ScaledClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(clock.real(d), f)}
+}
+
+type scaledTimer struct {
+	timer *time.Timer
+	c     chan time.Time
+}
+
+func (timer *scaledTimer) C() <-chan time.Time { return timer.c }
+func (timer *scaledTimer) Stop() bool          { return timer.timer.Stop() }
+
+type scaledTicker struct {
+	ticker *time.Ticker
+	c      chan time.Time
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (ticker *scaledTicker) C() <-chan time.Time { return ticker.c }
+
+func (ticker *scaledTicker) Stop() {
+	ticker.once.Do(func() {
+		ticker.ticker.Stop()
+		close(ticker.done)
+	})
+}
+
+// VirtualClock only moves when it is told to: Advance moves it forward and
+// fires the sleeps, timers and tickers due by then, in order of their
+// deadlines. Nothing else moves it, so a run on a virtual clock waits until
+// the driver advances it.
+type VirtualClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*virtualWaiter
+}
+
+// virtualWaiter is a sleep, timer or ticker waiting for the virtual clock to
+// reach its deadline
+type virtualWaiter struct {
+	clock    *VirtualClock
+	deadline time.Time
+	period   time.Duration // tickers only
+	c        chan time.Time
+	f        func() // AfterFunc only
+}
+
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (clock *VirtualClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.now
+}
+
+func (clock *VirtualClock) Since(t time.Time) time.Duration { return clock.Now().Sub(t) }
+
+func (clock *VirtualClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	<-clock.After(d)
+}
+
+func (clock *VirtualClock) After(d time.Duration) <-chan time.Time {
+	return clock.NewTimer(d).C()
+}
+
+func (clock *VirtualClock) NewTimer(d time.Duration) Timer {
+	return clock.add(d, 0, nil)
+}
+
+func (clock *VirtualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("mutex: non-positive interval for VirtualClock.NewTicker")
+	}
+	return virtualTicker{clock.add(d, d, nil)}
+}
+
+func (clock *VirtualClock) AfterFunc(d time.Duration, f func()) Timer {
+	return clock.add(d, 0, f)
+}
+
+func (clock *VirtualClock) add(d time.Duration, period time.Duration, f func()) *virtualWaiter {
+	clock.mutex.Lock()
+	waiter := &virtualWaiter{clock: clock, deadline: clock.now.Add(d), period: period, c: make(chan time.Time, 1), f: f}
+	clock.waiters = append(clock.waiters, waiter)
+	clock.mutex.Unlock()
+	if d <= 0 {
+		clock.Advance(0)
+	}
+	return waiter
+}
+
+// Advance moves the clock forward by d, firing what is due on the way
+func (clock *VirtualClock) Advance(d time.Duration) {
+	clock.mutex.Lock()
+	target := clock.now.Add(d)
+	clock.mutex.Unlock()
+	clock.advanceTo(target)
+}
+
+// Next returns the earliest deadline waited for, and false when nothing
+// waits; a driver advancing to it skips the idle time of a run
+func (clock *VirtualClock) Next() (time.Time, bool) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	if len(clock.waiters) == 0 {
+		return time.Time{}, false
+	}
+	next := clock.waiters[0].deadline
+	for _, waiter := range clock.waiters[1:] {
+		if waiter.deadline.Before(next) {
+			next = waiter.deadline
+		}
+	}
+	return next, true
+}
+
+func (clock *VirtualClock) advanceTo(target time.Time) {
+	for {
+		clock.mutex.Lock()
+		sort.SliceStable(clock.waiters, func(i, j int) bool { return clock.waiters[i].deadline.Before(clock.waiters[j].deadline) })
+		if len(clock.waiters) == 0 || clock.waiters[0].deadline.After(target) {
+			if target.After(clock.now) {
+				clock.now = target
+			}
+			clock.mutex.Unlock()
+			return
+		}
+		waiter := clock.waiters[0]
+		if waiter.deadline.After(clock.now) {
+			clock.now = waiter.deadline
+		}
+		if waiter.period > 0 {
+			waiter.deadline = waiter.deadline.Add(waiter.period)
+		} else {
+			clock.waiters = clock.waiters[1:]
+		}
+		now := clock.now
+		clock.mutex.Unlock()
+
+		if waiter.f != nil {
+			go waiter.f()
+			continue
+		}
+		select {
+		case waiter.c <- now:
+		default: // a ticker nobody read drops the tick, like time.Ticker
+		}
+	}
+}
+
+func (waiter *virtualWaiter) C() <-chan time.Time { return waiter.c }
+
+func (waiter *virtualWaiter) Stop() bool {
+	clock := waiter.clock
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	for i, other := range clock.waiters {
+		if other == waiter {
+			clock.waiters = append(clock.waiters[:i], clock.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type virtualTicker struct{ waiter *virtualWaiter }
+
+func (ticker virtualTicker) C() <-chan time.Time { return ticker.waiter.c }
+func (ticker virtualTicker) Stop()               { ticker.waiter.Stop() }
+
+func clockOr(clock Clock) Clock {
+	// the wall clock unless another one is set
+	if clock == nil {
+		return RealClock{}
+	}
+	return clock
+}
@@ -0,0 +1,131 @@
+package mutex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtualClockFiresInDeadlineOrder(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+	late := clock.NewTimer(3 * time.Second)
+	early := clock.NewTimer(time.Second)
+	ticker := clock.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	clock.Advance(1500 * time.Millisecond)
+	select {
+	case now := <-early.C():
+		if !now.Equal(start.Add(time.Second)) {
+			t.Fatalf("timer fired at %s, expected its deadline", now.Sub(start))
+		}
+	default:
+		t.Fatal("timer due at 1s didn't fire at 1.5s")
+	}
+	select {
+	case <-late.C():
+		t.Fatal("timer due at 3s fired at 1.5s")
+	case <-ticker.C():
+		t.Fatal("ticker due at 2s fired at 1.5s")
+	default:
+	}
+	if now := clock.Now(); !now.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Fatalf("clock at %s, expected 1.5s", now.Sub(start))
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	if now := <-ticker.C(); !now.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("ticker fired at %s, expected 2s", now.Sub(start))
+	}
+	if now := <-late.C(); !now.Equal(start.Add(3 * time.Second)) {
+		t.Fatalf("timer fired at %s, expected 3s", now.Sub(start))
+	}
+	if next, ok := clock.Next(); !ok || !next.Equal(start.Add(4*time.Second)) {
+		t.Fatalf("next deadline %s, expected the tick at 4s", next.Sub(start))
+	}
+}
+
+func TestVirtualClockSleepWaitsForAdvance(t *testing.T) {
+	clock := NewVirtualClock(time.Now())
+	woke := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Hour)
+		close(woke)
+	}()
+	for _, waiting := clock.Next(); !waiting; _, waiting = clock.Next() {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-woke:
+		t.Fatal("Sleep returned before the clock moved")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(time.Hour)
+	select {
+	case <-woke:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sleep didn't return once the clock moved past it")
+	}
+}
+
+func TestScaledTickerDeliversScaledTimes(t *testing.T) {
+	// a 1s ticker at scale 1000 ticks every millisecond of wall time, with
+	// the times of the scaled clock
+	clock := NewScaledClock(1000)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+	first := <-ticker.C()
+	second := <-ticker.C()
+	if first.Sub(clock.start) < 500*time.Millisecond {
+		t.Fatalf("first tick %s after the start of the clock, expected about 1s", first.Sub(clock.start))
+	}
+	if gap := second.Sub(first); gap < 500*time.Millisecond {
+		t.Fatalf("ticks %s apart, expected about 1s", gap)
+	}
+}
+
+func TestResendOnVirtualClock(t *testing.T) {
+	// the unacknowledged messages are only sent again once the virtual clock
+	// passes the request timeout
+	clock := NewVirtualClock(time.Now())
+	transport := NewFaultyTransport(NewChannelTransport(2), Faults{Drop: 1, Seed: 1})
+	network := NewNetworkOver(Original, FullQuorums(2), transport, nil)
+	network.TimeSource = clock
+	network.RequestTimeout = time.Second
+	network.Start()
+	defer network.Stop()
+
+	entered := make(chan struct{})
+	go func() {
+		network.Account(0).Enter()
+		close(entered)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if resent := network.Counters().Resent; resent != 0 {
+		t.Fatalf("%d messages sent again before the clock moved", resent)
+	}
+
+	// the request was lost: it goes again every second of the virtual clock
+	// until the faults are lifted
+	deadline := time.Now().Add(5 * time.Second)
+	for network.Counters().Resent == 0 && time.Now().Before(deadline) {
+		clock.Advance(time.Second)
+		time.Sleep(time.Millisecond)
+	}
+	if network.Counters().Resent == 0 {
+		t.Fatal("the lost request wasn't sent again")
+	}
+	transport.SetFaults(Faults{})
+	for {
+		select {
+		case <-entered:
+			network.Account(0).Exit()
+			return
+		case <-time.After(time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("account 0 didn't enter after the faults were lifted")
+		}
+		clock.Advance(time.Second)
+	}
+}
@@ -0,0 +1,110 @@
+package mutex
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Delivery: every request, approval, revocation and give-back an account
+// receives is acknowledged to its sender, duplicates included, so the sender
+// knows which of its messages arrived whatever the transport. The
+// acknowledgements are counted for the approvals (Counters.Acked): sent,
+// delivered, acknowledged and suppressed as duplicates, the approvals of a
+// run over a lossy transport add up. With RequestTimeout set, the sender
+// keeps the messages not acknowledged yet and sends them again until they
+// are, or their receiver failed: after RequestTimeout, then twice as long
+// after each copy, up to maxResendWait times RequestTimeout. A message still
+// queued at a busy receiver isn't lost, and copying all of them every
+// RequestTimeout would only fill the queues faster than they drain. A copy
+// keeps the sequence number of the message, so the receiver drops it if it
+// already has the message and still acknowledges it, in case the
+// acknowledgement was the message lost.
+
+// maxResendWait caps the backoff of a message sent again, in RequestTimeouts
+const maxResendWait = 32
+
+// unacked is a sequenced message sent and not acknowledged yet, by its kind,
+// sender, receiver and sequence number
+type unacked struct {
+	kind string
+	from int
+	to   int
+	seq  int
+}
+
+// pendingMessage is a message kept for sending again, with when it was last
+// sent and how long it waits for its acknowledgement from then
+type pendingMessage struct {
+	message Message
+	sent    time.Time
+	wait    time.Duration
+}
+
+func sequenced(kind string) bool {
+	// the protocol messages numbered per destination and acknowledged
+	switch kind {
+	case "request", "approve", "revoke", "yield":
+		return true
+	}
+	return false
+}
+
+func (network *Network) track(message Message) {
+	// keep a message until it is acknowledged
+	network.delivery_mutex.Lock()
+	defer network.delivery_mutex.Unlock()
+	network.unacked[unacked{message.Kind, message.From, message.To, message.Seq}] = pendingMessage{message: message, sent: network.clock().Now(), wait: network.RequestTimeout}
+}
+
+func (network *Network) acknowledge(to int, message Message) {
+	// tell the sender of a sequenced message that it arrived
+	network.send(Message{Kind: "ack", From: to, To: message.From, Seq: message.Seq, Acks: message.Kind})
+}
+
+func (network *Network) receiveAck(ack Message) {
+	network.delivery_mutex.Lock()
+	delete(network.unacked, unacked{ack.Acks, ack.To, ack.From, ack.Seq})
+	network.delivery_mutex.Unlock()
+
+	if ack.Acks == "approve" {
+		// Update metrics
+		atomic.AddInt64(&network.counters.Acked, 1)
+	}
+}
+
+func (network *Network) resend(stop <-chan struct{}) {
+	// send again the messages not acknowledged within their wait, and double
+	// it; those from or to an account that failed or left are given up
+	ticker := network.clock().NewTicker(network.RequestTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+		case <-stop:
+			return
+		}
+		now := network.clock().Now()
+		again := make([]Message, 0)
+		network.delivery_mutex.Lock()
+		for key, pending := range network.unacked {
+			switch {
+			case network.isDead(key.from) || network.isDead(key.to):
+				delete(network.unacked, key)
+			case now.Sub(pending.sent) >= pending.wait:
+				pending.sent = now
+				pending.wait = min(2*pending.wait, maxResendWait*network.RequestTimeout)
+				network.unacked[key] = pending
+				again = append(again, pending.message)
+			}
+		}
+		network.delivery_mutex.Unlock()
+
+		for _, message := range again {
+			// a copy isn't counted in the traffic, so a lost message counts
+			// once sent and once received
+			network.transport.Send(message)
+		}
+		// Update metrics
+		atomic.AddInt64(&network.counters.Resent, int64(len(again)))
+	}
+}
@@ -0,0 +1,54 @@
+package mutex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApprovalsAcknowledged(t *testing.T) {
+	// every approval delivered is acknowledged back to the account that sent it
+	network := NewNetwork(Original, FullQuorums(4))
+	network.Start()
+	defer network.Stop()
+
+	for id := 0; id < network.Len(); id++ {
+		network.Account(id).Enter()
+		network.Account(id).Exit()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for network.Counters().Acked < network.Counters().Delivered && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	counters := network.Counters()
+	if counters.Delivered != 4*3 {
+		t.Fatalf("%d approvals delivered, expected %d", counters.Delivered, 4*3)
+	}
+	if counters.Acked != counters.Delivered {
+		t.Fatalf("%d of %d approvals delivered acknowledged", counters.Acked, counters.Delivered)
+	}
+}
+
+func TestResendBacksOff(t *testing.T) {
+	// every message is lost, acknowledgements included: the request of
+	// account 0 is sent again after 1, 2, 4, 8, 16 and 32 seconds, then every
+	// 32 seconds, instead of every second, which flooded the queues of busy
+	// receivers with copies until no acknowledgement came back in time
+	clock := NewVirtualClock(time.Now())
+	transport := NewFaultyTransport(NewChannelTransport(2), Faults{Drop: 1, Seed: 42})
+	network := NewNetworkOver(Original, FullQuorums(2), transport, nil)
+	network.TimeSource = clock
+	network.RequestTimeout = time.Second
+	network.Start()
+	defer network.Stop()
+
+	go network.Account(0).Enter()
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 100; i++ {
+		clock.Advance(time.Second)
+		time.Sleep(time.Millisecond)
+	}
+	// copies at 1, 3, 7, 15, 31, 63 and 95 seconds
+	if resent := network.Counters().Resent; resent == 0 || resent > 7 {
+		t.Fatalf("the lost request was sent again %d times in 100 seconds, expected 7 at most", resent)
+	}
+}
@@ -0,0 +1,81 @@
+package mutex
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// AccountState is the protocol state of an account, for diagnosing a run that
+// stopped making progress. It is read without stopping the account, so the
+// fields may be a moment apart.
+type AccountState struct {
+	ID          int
+	Local       bool
+	Failed      bool
+	Left        bool // left the network with Leave
+	Turn        int
+	HighestTurn int
+	RequestCS   bool
+	Deferred    []int // accounts whose requests wait for our release
+	Permits     []int // quorum members we hold a permission from
+	Missing     []int // quorum members whose approval we wait for
+	WantsToken  bool  // token-ring
+	HasToken    bool  // Suzuki-Kasami
+	InCS        bool  // Suzuki-Kasami
+}
+
+func (state AccountState) String() string {
+	if !state.Local {
+		return fmt.Sprintf("account %d: remote, failed %v", state.ID, state.Failed)
+	}
+	return fmt.Sprintf("account %d: turn %d (highest %d), requestCS %v, deferred %v, permits %v, waiting for %v, wants token %v, has token %v, in CS %v, failed %v, left %v",
+		state.ID, state.Turn, state.HighestTurn, state.RequestCS, state.Deferred, state.Permits, state.Missing, state.WantsToken, state.HasToken, state.InCS, state.Failed, state.Left)
+}
+
+// Diagnose returns the state of every account; only the accounts of this
+// process have more than their failure
+func (network *Network) Diagnose() []AccountState {
+	accounts := network.registry.all()
+	states := make([]AccountState, 0, len(accounts))
+	for _, account := range accounts {
+		state := AccountState{ID: account.id, Local: network.IsLocal(account.id), Left: network.HasLeft(account.id)}
+		state.Failed = network.isDead(account.id) && !state.Left
+		if !state.Local {
+			states = append(states, state)
+			continue
+		}
+		account.permit_mutex.Lock()
+		state.Turn = account.turn
+		state.HighestTurn = account.highestTurn
+		state.RequestCS = account.requestCS
+		account.permit_mutex.Unlock()
+		state.WantsToken = atomic.LoadInt32(&account.wantsToken) == 1
+
+		account.deferred_mutex.Lock()
+		for _, request := range account.deferred_queue {
+			state.Deferred = append(state.Deferred, request.id)
+		}
+		account.deferred_mutex.Unlock()
+
+		account.permit_mutex.Lock()
+		for id, held := range account.outstandingPermit {
+			if held {
+				state.Permits = append(state.Permits, id)
+			}
+		}
+		if account.requestCS {
+			state.Missing = account.missingPermits()
+		}
+		account.permit_mutex.Unlock()
+		sort.Ints(state.Permits)
+
+		account.sk_mutex.Lock()
+		state.HasToken = account.token != nil
+		state.InCS = account.inCS
+		account.sk_mutex.Unlock()
+
+		states = append(states, state)
+	}
+	return states
+}
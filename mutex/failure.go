@@ -0,0 +1,257 @@
+package mutex
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Crash-fault tolerance: accounts send each other heartbeats and an account
+// not heard from for FailureTimeout is declared failed. A request left
+// unanswered for RequestTimeout is sent again up to RequestRetries times, after
+// which the silent quorum members are declared failed too, unless their
+// heartbeats show they are alive and merely busy. A failed account is removed
+// from the approvals every other account waits for, its deferred requests are
+// dropped and the token skips it, so the remaining accounts keep committing.
+// The token ring regenerates its token after a failure under a new epoch and
+// drops the tokens of older epochs; until every process has seen the failure
+// an old token may still grant the CS. A Suzuki-Kasami token held by a failed
+// account is lost.
+
+func (network *Network) seen(id int) {
+	network.failure_mutex.Lock()
+	network.lastSeen[id] = network.clock().Now()
+	network.failure_mutex.Unlock()
+}
+
+func (network *Network) isDead(id int) bool {
+	// whether the account failed or left: no one waits for it any more
+	network.failure_mutex.Lock()
+	defer network.failure_mutex.Unlock()
+	return network.dead[id] || network.left[id]
+}
+
+func (network *Network) alive(id int) bool {
+	// whether heartbeats show the account is alive
+	if network.HeartbeatInterval <= 0 || network.FailureTimeout <= 0 {
+		return false
+	}
+	network.failure_mutex.Lock()
+	defer network.failure_mutex.Unlock()
+	return !network.dead[id] && network.clock().Since(network.lastSeen[id]) < network.FailureTimeout
+}
+
+// Failed returns the accounts declared failed so far
+func (network *Network) Failed() []int {
+	network.failure_mutex.Lock()
+	defer network.failure_mutex.Unlock()
+	failed := make([]int, 0, len(network.dead))
+	for id := range network.registry.all() {
+		if network.dead[id] {
+			failed = append(failed, id)
+		}
+	}
+	return failed
+}
+
+// Halt stops a local account that can't go on (e.g. its goroutine panicked):
+// it no longer sends heartbeats and the other accounts stop waiting for it
+func (network *Network) Halt(id int) {
+	atomic.StoreInt32(&network.Account(id).halted, 1)
+	network.markDead(id)
+}
+
+func (network *Network) markDead(id int) {
+	network.failure_mutex.Lock()
+	if network.dead[id] {
+		network.failure_mutex.Unlock()
+		return
+	}
+	network.dead[id] = true
+	network.failure_mutex.Unlock()
+
+	fmt.Fprintln(network.Output, "Participant", id, "failed")
+	atomic.AddInt64(&network.counters.PeerFailures, 1)
+	network.observe("failed", id, -1)
+	for _, account := range network.registry.all() {
+		if network.IsLocal(account.id) && account.id != id {
+			account.forgetPeer(id)
+		}
+	}
+	if network.Algorithm() == TokenRing {
+		network.regenerateToken()
+	}
+	if network.OnFailure != nil {
+		network.OnFailure(id)
+	}
+}
+
+func (network *Network) regenerateToken() {
+	// the token may have been lost with the failed account: the epoch is the
+	// number of failures and departures (and switches to the token ring), and
+	// the first live
+	// account injects the token of a new epoch if it runs here. A token of
+	// that epoch may have reached us first from a process that saw the failure
+	// before us.
+	epoch := network.tokenGeneration()
+	for {
+		current := atomic.LoadInt64(&network.tokenEpoch)
+		if current >= epoch {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&network.tokenEpoch, current, epoch) {
+			break
+		}
+	}
+	first := network.nextAlive(network.Len() - 1)
+	if network.IsLocal(first) && !network.isDead(first) {
+		network.send(Message{Kind: "token", From: first, To: first, Turn: int(epoch)})
+	}
+}
+
+func (network *Network) tokenGeneration() int64 {
+	// token-ring: the epoch of the current token, one more after every
+	// failure, departure and switch to the token ring
+	network.failure_mutex.Lock()
+	defer network.failure_mutex.Unlock()
+	return int64(len(network.dead)+len(network.left)) + atomic.LoadInt64(&network.tokenSwitches)
+}
+
+func (network *Network) currentToken(epoch int) bool {
+	// drop the tokens of an epoch before the last failure; a newer epoch means
+	// another process has seen a failure we haven't yet
+	for {
+		current := atomic.LoadInt64(&network.tokenEpoch)
+		if int64(epoch) < current {
+			return false
+		}
+		if int64(epoch) == current || atomic.CompareAndSwapInt64(&network.tokenEpoch, current, int64(epoch)) {
+			return true
+		}
+	}
+}
+
+func (account *Account) forgetPeer(id int) {
+	// stop answering and expecting a failed account; with the optimized
+	// algorithm a vote it held goes to the next request in line
+	account.deferred_mutex.Lock()
+	queue := account.deferred_queue[:0]
+	for _, request := range account.deferred_queue {
+		if request.id != id {
+			queue = append(queue, request)
+		}
+	}
+	account.deferred_queue = queue
+	account.permit_mutex.Lock()
+	delete(account.grantedPermit, id)
+	var votes, claims []grant
+	if account.network.Algorithm() == Optimized {
+		votes, claims = account.serve()
+	}
+	account.permit_mutex.Unlock()
+	account.deferred_mutex.Unlock()
+	account.sendVotes(votes, claims)
+
+	// wake up the account if it is waiting for the failed one
+	select {
+	case account.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (network *Network) heartbeat(stop <-chan struct{}) {
+	// tell the accounts of the other processes that our accounts are alive;
+	// the accounts of this process see each other fail directly
+	ticker := network.clock().NewTicker(network.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+		case <-stop:
+			return
+		}
+		accounts := network.registry.all()
+		for _, account := range accounts {
+			if !network.IsLocal(account.id) || atomic.LoadInt32(&account.halted) == 1 {
+				continue
+			}
+			for id := range accounts {
+				if !network.IsLocal(id) && !network.isDead(id) {
+					network.send(Message{Kind: "heartbeat", From: account.id, To: id})
+					atomic.AddInt64(&network.counters.Heartbeats, 1)
+				}
+			}
+		}
+	}
+}
+
+func (network *Network) detectFailures(stop <-chan struct{}) {
+	// declare failed the accounts of other processes not heard from recently
+	ticker := network.clock().NewTicker(network.FailureTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+		case <-stop:
+			return
+		}
+		for id := range network.registry.all() {
+			if network.IsLocal(id) {
+				continue
+			}
+			network.failure_mutex.Lock()
+			silent := !network.dead[id] && network.clock().Since(network.lastSeen[id]) > network.FailureTimeout
+			network.failure_mutex.Unlock()
+			if silent {
+				network.markDead(id)
+			}
+		}
+	}
+}
+
+func (account *Account) retryRequests() bool {
+	// send our last request again to the quorum members that haven't answered;
+	// it keeps its sequence number, so a receiver that already has it drops it.
+	// The network also sends again every message left unacknowledged.
+	account.permit_mutex.Lock()
+	targets := account.missingPermits()
+	resend := make([]Message, 0, len(targets))
+	for _, qid := range targets {
+		if request, ok := account.lastRequest[qid]; ok {
+			resend = append(resend, request)
+		}
+	}
+	account.permit_mutex.Unlock()
+
+	for _, request := range resend {
+		account.network.observe("retry", account.id, request.To)
+		account.network.send(request)
+	}
+	atomic.AddInt64(&account.network.counters.Retries, int64(len(resend)))
+	return len(resend) > 0
+}
+
+func (account *Account) suspectSilentPeers() {
+	// out of retries: the quorum members of other processes still missing are
+	// declared failed unless their heartbeats show they are only slow to
+	// answer; the accounts of this process report their own crashes
+	account.permit_mutex.Lock()
+	targets := account.missingPermits()
+	account.permit_mutex.Unlock()
+	for _, qid := range targets {
+		if !account.network.IsLocal(qid) && !account.network.alive(qid) {
+			account.network.markDead(qid)
+		}
+	}
+}
+
+func (network *Network) nextAlive(id int) int {
+	// token-ring: the account after id that hasn't failed
+	n := network.Len()
+	for k := 1; k < n; k++ {
+		next := (id + k) % n
+		if !network.isDead(next) {
+			return next
+		}
+	}
+	return id
+}
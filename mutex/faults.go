@@ -0,0 +1,210 @@
+package mutex
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Faults is the unreliable delivery a FaultyTransport injects into the
+// protocol messages: requests, approvals, revocations, give-backs, their
+// acknowledgements and tokens. Heartbeats,
+// snapshot messages and data payloads are delivered as they are, so failure
+// detection and the replication of the bank stay reliable.
+type Faults struct {
+	Drop      float64       // probability a message is lost
+	Duplicate float64       // probability a message is delivered twice
+	Reorder   float64       // probability a message is held back behind the next one to its account
+	Delay     time.Duration // each message is delayed by up to this long, uniformly
+	// the faults are drawn from the seed, the sender, the receiver and the
+	// number of messages sent between them so far, so the same seed injects
+	// the same faults into the same message whatever the scheduling
+	Seed int64
+}
+
+// Enabled reports whether any fault is injected
+func (faults Faults) Enabled() bool {
+	return faults.Drop > 0 || faults.Duplicate > 0 || faults.Reorder > 0 || faults.Delay > 0
+}
+
+// Validate checks the probabilities and the delay
+func (faults Faults) Validate() error {
+	for _, p := range []float64{faults.Drop, faults.Duplicate, faults.Reorder} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("probability %v out of [0, 1]", p)
+		}
+	}
+	if faults.Delay < 0 {
+		return fmt.Errorf("negative delay %s", faults.Delay)
+	}
+	return nil
+}
+
+// FaultCounts is how many faults a FaultyTransport injected
+type FaultCounts struct {
+	Seed       int64 `json:"seed"`
+	Messages   int64 `json:"messages"` // protocol messages the faults were drawn for
+	Dropped    int64 `json:"dropped"`
+	Duplicated int64 `json:"duplicated"`
+	Reordered  int64 `json:"reordered"`
+	Delayed    int64 `json:"delayed"`
+}
+
+func (counts FaultCounts) String() string {
+	return fmt.Sprintf("%d of %d protocol messages dropped, %d duplicated, %d reordered, %d delayed (seed %d)", counts.Dropped, counts.Messages, counts.Duplicated, counts.Reordered, counts.Delayed, counts.Seed)
+}
+
+// reorderWait bounds how long a message held back for reordering waits for
+// the next message to its account
+const reorderWait = 10 * time.Millisecond
+
+// FaultyTransport injects Faults into the messages sent over another
+// transport
+type FaultyTransport struct {
+	Transport
+	// Clock times the delays and the reordering (the wall clock when nil)
+	Clock  Clock
+	faults Faults
+	mutex  sync.Mutex
+	links  map[[2]int]uint64 // messages sent from one account to another
+	held   map[int]*heldMessage
+	counts FaultCounts
+}
+
+// heldMessage is a message held back until the next one to its account is
+// sent, with how many times it is delivered
+type heldMessage struct {
+	message Message
+	copies  int
+}
+
+// NewFaultyTransport wraps the transport; a zero seed draws from the clock
+func NewFaultyTransport(transport Transport, faults Faults) *FaultyTransport {
+	if faults.Seed == 0 {
+		faults.Seed = time.Now().UnixNano()
+	}
+	return &FaultyTransport{
+		Transport: transport,
+		faults:    faults,
+		links:     make(map[[2]int]uint64),
+		held:      make(map[int]*heldMessage),
+		counts:    FaultCounts{Seed: faults.Seed},
+	}
+}
+
+// SetOrdering sets the delivery order of the wrapped transport, if it has one
+func (transport *FaultyTransport) SetOrdering(ordering Ordering, seed int64) {
+	if ordered, ok := transport.Transport.(interface{ SetOrdering(Ordering, int64) }); ok {
+		ordered.SetOrdering(ordering, seed)
+	}
+}
+
+// SetFaults changes the faults injected from now on, keeping the seed; a
+// chaos experiment turns them on and off mid-run
+func (transport *FaultyTransport) SetFaults(faults Faults) {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	faults.Seed = transport.faults.Seed
+	transport.faults = faults
+}
+
+func (transport *FaultyTransport) reserve(fanIn []int) {
+	if sized, ok := transport.Transport.(interface{ reserve([]int) }); ok {
+		sized.reserve(fanIn)
+	}
+}
+
+func (transport *FaultyTransport) Send(message Message) error {
+	switch message.Kind {
+	case "request", "approve", "revoke", "yield", "ack", "token", "sk-token":
+	default:
+		return transport.Transport.Send(message)
+	}
+
+	transport.mutex.Lock()
+	link := [2]int{message.From, message.To}
+	n := transport.links[link]
+	transport.links[link] = n + 1
+	draw := func(i uint64) float64 {
+		return faultDraw(transport.faults.Seed, message.From, message.To, n, i)
+	}
+	faults := transport.faults
+	transport.counts.Messages++
+	if draw(0) < faults.Drop {
+		transport.counts.Dropped++
+		transport.mutex.Unlock()
+		return nil
+	}
+	copies := 1
+	if draw(1) < faults.Duplicate {
+		transport.counts.Duplicated++
+		copies = 2
+	}
+	if draw(2) < faults.Reorder && transport.held[message.To] == nil {
+		transport.counts.Reordered++
+		held := &heldMessage{message: message, copies: copies}
+		transport.held[message.To] = held
+		transport.mutex.Unlock()
+		clockOr(transport.Clock).AfterFunc(reorderWait, func() { transport.release(message.To, held) })
+		return nil
+	}
+	held := transport.held[message.To]
+	delete(transport.held, message.To)
+	transport.mutex.Unlock()
+
+	var err error
+	for i := 0; i < copies; i++ {
+		err = transport.deliver(message, time.Duration(draw(3+uint64(i))*float64(faults.Delay)))
+	}
+	if held != nil {
+		for i := 0; i < held.copies; i++ {
+			transport.deliver(held.message, 0)
+		}
+	}
+	return err
+}
+
+func (transport *FaultyTransport) release(to int, held *heldMessage) {
+	// no message to the account overtook the held one in time
+	transport.mutex.Lock()
+	still := transport.held[to] == held
+	if still {
+		delete(transport.held, to)
+	}
+	transport.mutex.Unlock()
+	if still {
+		for i := 0; i < held.copies; i++ {
+			transport.deliver(held.message, 0)
+		}
+	}
+}
+
+func (transport *FaultyTransport) deliver(message Message, delay time.Duration) error {
+	// send the message now or after its delay
+	if delay <= 0 {
+		return transport.Transport.Send(message)
+	}
+	transport.mutex.Lock()
+	transport.counts.Delayed++
+	transport.mutex.Unlock()
+	clockOr(transport.Clock).AfterFunc(delay, func() { transport.Transport.Send(message) })
+	return nil
+}
+
+// Counts returns the faults injected so far
+func (transport *FaultyTransport) Counts() FaultCounts {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	return transport.counts
+}
+
+func faultDraw(seed int64, from int, to int, n uint64, i uint64) float64 {
+	// a number in [0, 1) for draw i of the n-th message from one account to
+	// another, mixed with splitmix64
+	x := uint64(seed) ^ uint64(from)<<48 ^ uint64(to)<<32 ^ n<<4 ^ i
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
@@ -0,0 +1,181 @@
+package mutex
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Join adds an account to the running network and returns its id, the next
+// one after the accounts created so far. The new account asks every account
+// for the CS and every account asks it from now on, so any two quorums still
+// intersect. Like SwitchAlgorithm, the caller must drain the network first;
+// every account must run in this process over the channel transport, which
+// the new account gets a mailbox of.
+func (network *Network) Join() (int, error) {
+	if err := network.reconfigurable("add accounts"); err != nil {
+		return -1, err
+	}
+	base := network.transport
+	if faulty, ok := base.(*FaultyTransport); ok {
+		base = faulty.Transport
+	}
+	transport, ok := base.(*ChannelTransport)
+	if !ok {
+		return -1, fmt.Errorf("accounts can only join over the channel transport")
+	}
+
+	accounts := network.registry.all()
+	id := len(accounts)
+	n_accounts := id + 1
+	quorum := make([]int, n_accounts)
+	for i := range quorum {
+		quorum[i] = i
+	}
+	for i, members := range network.quorums {
+		network.quorums[i] = append(append([]int(nil), members...), id)
+	}
+	network.quorums = append(network.quorums, quorum)
+
+	for _, account := range accounts {
+		account.permit_mutex.Lock()
+		account.quorum = append(append([]int(nil), account.quorum...), id)
+		account.permit_mutex.Unlock()
+
+		// Suzuki-Kasami: one more request number to track, in the token too
+		account.sk_mutex.Lock()
+		account.rn = append(account.rn, 0)
+		if account.token != nil {
+			account.token.ln = append(account.token.ln, 0)
+		}
+		account.sk_mutex.Unlock()
+	}
+
+	account := newAccount(network, id, quorum, n_accounts)
+	transport.add(id)
+	network.registry.add(account, true, n_accounts)
+	network.seen(id)
+	network.run(account)
+	if atomic.LoadInt32(&network.circulating) == 1 {
+		go account.circulateToken(network.stop)
+	}
+	return id, nil
+}
+
+// Leave takes an account out of the running network for good: it no longer
+// asks for or answers requests, the other accounts stop waiting for it as if
+// it had failed, and its id isn't reused. It first claims back the votes it
+// gave (RevokePermits) and waits up to a second for their holders, idle in a
+// drained network, to give them back; the permissions it held go with it. A
+// Suzuki-Kasami token at rest there moves to the next live account and the
+// token ring regenerates its token. The caller must drain the network first.
+func (network *Network) Leave(id int) error {
+	if err := network.reconfigurable("remove accounts"); err != nil {
+		return err
+	}
+	if id < 0 || id >= network.Len() {
+		return fmt.Errorf("no account %d", id)
+	}
+	if network.isDead(id) {
+		return fmt.Errorf("account %d already left or failed", id)
+	}
+	account := network.Account(id)
+	account.RevokePermits()
+	deadline := network.clock().Now().Add(time.Second)
+	for account.votesOut() > 0 && network.clock().Now().Before(deadline) {
+		network.clock().Sleep(time.Millisecond)
+	}
+
+	network.failure_mutex.Lock()
+	network.left[id] = true
+	network.failure_mutex.Unlock()
+
+	atomic.StoreInt32(&account.halted, 1)
+	close(account.gone)
+	account.permit_mutex.Lock()
+	account.outstandingPermit = make(map[int]bool)
+	account.grantedPermit = make(map[int]grant)
+	account.permit_mutex.Unlock()
+	for _, other := range network.registry.all() {
+		if other.id != id {
+			other.forgetPeer(id)
+		}
+	}
+
+	switch network.Algorithm() {
+	case TokenRing:
+		network.regenerateToken()
+	case SuzukiKasami:
+		account.sk_mutex.Lock()
+		token := account.token
+		account.token = nil
+		account.sk_mutex.Unlock()
+		if next := network.nextAlive(id); token != nil && next != id {
+			heir := network.Account(next)
+			heir.sk_mutex.Lock()
+			heir.token = token
+			heir.sk_mutex.Unlock()
+		}
+	}
+	return nil
+}
+
+func (account *Account) votesOut() int {
+	// how many accounts hold our vote
+	account.permit_mutex.Lock()
+	defer account.permit_mutex.Unlock()
+	return len(account.grantedPermit)
+}
+
+// CanLeave reports whether the account can leave without breaking mutual
+// exclusion: the quorums of the accounts still in the network, less the
+// accounts that left or failed, must still intersect. The token-based
+// algorithms have no quorums.
+func (network *Network) CanLeave(id int) bool {
+	switch network.Algorithm() {
+	case TokenRing, SuzukiKasami:
+		return true
+	}
+	gone := func(other int) bool {
+		return other == id || network.isDead(other)
+	}
+	members := make([]map[int]bool, 0)
+	for _, account := range network.registry.all() {
+		if gone(account.id) {
+			continue
+		}
+		live := make(map[int]bool)
+		account.permit_mutex.Lock()
+		for _, member := range account.quorum {
+			if !gone(member) {
+				live[member] = true
+			}
+		}
+		account.permit_mutex.Unlock()
+		members = append(members, live)
+	}
+	for i := range members {
+		for j := i + 1; j < len(members); j++ {
+			if !overlap(members[i], members[j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func overlap(a map[int]bool, b map[int]bool) bool {
+	for id := range a {
+		if b[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// HasLeft reports whether the account left the network with Leave
+func (network *Network) HasLeft(id int) bool {
+	network.failure_mutex.Lock()
+	defer network.failure_mutex.Unlock()
+	return network.left[id]
+}
@@ -0,0 +1,97 @@
+package mutex
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type Request struct {
+	// a request to enter the critical section, for the given accounts only
+	// (resource mode) or for the whole CS (nil resources); an aged request
+	// goes before the others, and a boost marks the pending request of its
+	// account aged; a background request goes after the others, aging aside
+	turn       int
+	id         int
+	seq        int
+	resources  []int
+	aged       bool
+	boost      bool
+	background bool
+}
+
+type Signal struct {
+	// an approval, a revocation or a give-back sent by account id; an approval
+	// may only be good for the entry it answers (resource mode), and a
+	// revocation or a give-back names the approval by its sequence number,
+	// the revocation with the request waiting for the permission (optimized)
+	id      int
+	seq     int
+	once    bool
+	grant   int
+	waiting Request
+}
+
+type sequencer struct {
+	// numbers the messages of one kind sent to each destination
+	mutex sync.Mutex
+	next  map[int]int
+}
+
+func newSequencer() sequencer {
+	return sequencer{next: make(map[int]int)}
+}
+
+func (s *sequencer) stamp(to int) int {
+	// return the next sequence number for a message to the given account
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	seq := s.next[to]
+	s.next[to] = seq + 1
+	return seq
+}
+
+type inbox struct {
+	// delivers the messages of one kind from each sender in sequence order,
+	// holding back messages that overtook an earlier one and dropping duplicates
+	next       map[int]int
+	pending    map[int]map[int]func()
+	duplicates *int64
+}
+
+func newInbox(duplicates *int64) inbox {
+	return inbox{
+		next:       make(map[int]int),
+		pending:    make(map[int]map[int]func()),
+		duplicates: duplicates,
+	}
+}
+
+func (in *inbox) accept(from int, seq int, deliver func()) {
+	// deliver the message (and any held back ones it unblocks) if it is the
+	// next one expected from the sender
+	held := in.pending[from]
+	if seq < in.next[from] || held[seq] != nil {
+		atomic.AddInt64(in.duplicates, 1)
+		return
+	}
+	if seq > in.next[from] {
+		if held == nil {
+			held = make(map[int]func())
+			in.pending[from] = held
+		}
+		held[seq] = deliver
+		return
+	}
+
+	deliver()
+	in.next[from]++
+	for {
+		next, ok := held[in.next[from]]
+		if !ok {
+			return
+		}
+		delete(held, in.next[from])
+		next()
+		in.next[from]++
+	}
+}
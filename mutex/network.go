@@ -0,0 +1,494 @@
+// Package mutex implements the distributed mutual exclusion protocols used by
+// the bank simulation: Ricart-Agrawala, its quorum-based Roucairol-Carvalho
+// optimization and two token-based algorithms, a token ring and
+// Suzuki-Kasami. Accounts exchange messages through a Network, over in-process
+// channels or TCP between processes.
+package mutex
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Algorithm selects the protocol run by the accounts of a network
+type Algorithm string
+
+const (
+	// Original is Ricart-Agrawala: every entry asks every other account
+	Original Algorithm = "original"
+	// Optimized asks the quorum only, each member voting for one requester at
+	// a time (Maekawa), and keeps the votes received until they are claimed
+	// back (Roucairol-Carvalho)
+	Optimized Algorithm = "optimized"
+	// TokenRing passes a single token around a fixed ring of accounts
+	TokenRing Algorithm = "token-ring"
+	// SuzukiKasami broadcasts requests for a single token, which its holder
+	// hands to the next requester
+	SuzukiKasami Algorithm = "suzuki-kasami"
+)
+
+// Observer is told about every protocol message and CS entry or release with
+// the Lamport clock of the account at the event; it is called from the account
+// goroutines, so it must be safe for concurrent use
+type Observer interface {
+	Observe(kind string, account int, peer int, clock int)
+}
+
+// Counters are the messages exchanged by the accounts of a network
+type Counters struct {
+	Requests        int64
+	Approvals       int64 // approvals sent
+	Delivered       int64 // approvals accepted by the requester
+	Acked           int64 // approvals the requester acknowledged, duplicates included
+	Revokes         int64
+	GivenBack       int64 // optimized: votes given back to their arbiter
+	Duplicates      int64
+	TokenPasses     int64
+	IdleTokenPasses int64
+	Heartbeats      int64
+	Retries         int64 // requests sent again after RequestTimeout
+	Resent          int64 // sequenced messages sent again, unacknowledged after RequestTimeout
+	PeerFailures    int64 // accounts declared failed
+	Prefetched      int64 // requests sent ahead of the next entry by Prefetch, also counted in Requests
+	PrefetchRevoked int64 // prefetched approvals given back to a requester before the entry
+	Boosts          int64 // boosts sent for requests waiting longer than Aging
+}
+
+// Network routes the messages between the accounts of a run over a
+// Transport; only the local accounts run in this process
+type Network struct {
+	algorithm atomic.Value // Algorithm, changed by SwitchAlgorithm
+	quorums   [][]int      // the quorums of the permission-based algorithms
+	registry  registry
+	transport Transport
+	// TokenHop is the simulated latency of passing the token (token-ring only)
+	TokenHop time.Duration
+	// SlowAccounts, if set, simulates stragglers: each listed account waits its
+	// delay before it approves a request or passes the token on
+	SlowAccounts map[int]time.Duration
+	// Observer, if set, is told about the protocol events
+	Observer Observer
+	// OnData, if set, receives the payloads broadcast by other processes
+	OnData func(from int, data []byte)
+	// TimeSource times the delays, timeouts and heartbeats (the wall clock
+	// when nil); Clock is the Lamport clock of an account
+	TimeSource Clock
+	// Output is where the network reports errors and failed accounts
+	// (os.Stdout by default)
+	Output io.Writer
+
+	// failure detection, disabled when zero: how often heartbeats are sent,
+	// how long an account may stay silent before it is declared failed, and
+	// how long and how many more times a request waits for its approvals
+	HeartbeatInterval time.Duration
+	FailureTimeout    time.Duration
+	RequestTimeout    time.Duration
+	RequestRetries    int
+	// aging, disabled when zero: a request waiting longer than this for its
+	// approvals is boosted ahead of the requests that haven't waited as long
+	// (permission-based algorithms)
+	Aging time.Duration
+	// OnFailure, if set, is told about every account declared failed
+	OnFailure func(id int)
+	// snapshots: OnRecord returns the state of this process when it records a
+	// snapshot and OnSnapshot receives the states of every process with the
+	// number of payloads that were in flight
+	OnRecord   func(snapshot int) []byte
+	OnSnapshot func(snapshot int, parts [][]byte, inFlight int)
+
+	counters      Counters
+	traffic       [2]int64 // protocol messages sent to and received from other processes, see Traffic
+	sites         int
+	failure_mutex sync.Mutex
+	dead          map[int]bool
+	left          map[int]bool // accounts that left the network with Leave
+	lastSeen      map[int]time.Time
+	tokenEpoch    int64 // token-ring: the token is regenerated after each failure and switch
+	tokenSwitches int64 // token-ring: switches to the token ring after the start
+	circulateOnce sync.Once
+	circulating   int32 // token-ring: set once the local accounts pass the token around
+
+	delivery_mutex sync.Mutex
+	unacked        map[unacked]pendingMessage // with RequestTimeout: the sequenced messages sent and not acknowledged yet
+
+	snapshot_mutex sync.Mutex
+	snapshots      map[int]*snapshot
+	snapshotSeq    int64
+	stop           chan struct{}
+	stopOnce       sync.Once
+}
+
+// NewNetwork creates one account per quorum, account i asking quorums[i] for
+// the CS; the original and Suzuki-Kasami algorithms ignore the quorums and ask
+// every account. All the accounts run in this process.
+func NewNetwork(algorithm Algorithm, quorums [][]int) *Network {
+	return NewNetworkOver(algorithm, quorums, NewChannelTransport(len(quorums)), nil)
+}
+
+// NewNetworkOver creates the accounts like NewNetwork, running only the local
+// ones (all of them if local is nil) and reaching the others through the
+// transport, which the network closes when stopped
+func NewNetworkOver(algorithm Algorithm, quorums [][]int, transport Transport, local []int) *Network {
+	network := &Network{
+		quorums:   quorums,
+		registry:  registry{local: make(map[int]bool), routes: make(map[int]*routes)},
+		transport: transport,
+		TokenHop:  time.Millisecond,
+		Output:    os.Stdout,
+		dead:      make(map[int]bool),
+		left:      make(map[int]bool),
+		lastSeen:  make(map[int]time.Time),
+		unacked:   make(map[unacked]pendingMessage),
+		snapshots: make(map[int]*snapshot),
+		stop:      make(chan struct{}),
+	}
+	network.algorithm.Store(algorithm)
+	if algorithm == Original || algorithm == SuzukiKasami {
+		quorums = FullQuorums(len(quorums))
+	}
+	if sized, ok := transport.(interface{ reserve([]int) }); ok {
+		sized.reserve(FanIn(quorums))
+	}
+	runs := make(map[int]bool)
+	for _, id := range local {
+		runs[id] = true
+	}
+	for i := range quorums {
+		account := newAccount(network, i, quorums[i], len(quorums))
+		network.registry.add(account, local == nil || runs[i], len(quorums))
+	}
+	if algorithm == SuzukiKasami && len(quorums) > 0 {
+		// the first account starts with the token
+		network.Account(0).token = &skToken{ln: make([]int, len(quorums))}
+	}
+	return network
+}
+
+func (network *Network) Algorithm() Algorithm {
+	return network.algorithm.Load().(Algorithm)
+}
+
+func (network *Network) Len() int {
+	return network.registry.len()
+}
+
+func (network *Network) Account(id int) *Account {
+	return network.registry.get(id)
+}
+
+func (network *Network) Counters() Counters {
+	// snapshot of the message counters
+	return Counters{
+		Requests:        atomic.LoadInt64(&network.counters.Requests),
+		Approvals:       atomic.LoadInt64(&network.counters.Approvals),
+		Delivered:       atomic.LoadInt64(&network.counters.Delivered),
+		Acked:           atomic.LoadInt64(&network.counters.Acked),
+		Revokes:         atomic.LoadInt64(&network.counters.Revokes),
+		GivenBack:       atomic.LoadInt64(&network.counters.GivenBack),
+		Duplicates:      atomic.LoadInt64(&network.counters.Duplicates),
+		TokenPasses:     atomic.LoadInt64(&network.counters.TokenPasses),
+		IdleTokenPasses: atomic.LoadInt64(&network.counters.IdleTokenPasses),
+		Heartbeats:      atomic.LoadInt64(&network.counters.Heartbeats),
+		Retries:         atomic.LoadInt64(&network.counters.Retries),
+		Resent:          atomic.LoadInt64(&network.counters.Resent),
+		PeerFailures:    atomic.LoadInt64(&network.counters.PeerFailures),
+		Prefetched:      atomic.LoadInt64(&network.counters.Prefetched),
+		PrefetchRevoked: atomic.LoadInt64(&network.counters.PrefetchRevoked),
+		Boosts:          atomic.LoadInt64(&network.counters.Boosts),
+	}
+}
+
+// Traffic returns how many protocol messages the local accounts sent to and
+// received from the accounts of other processes. Once they are equal summed
+// over every process, no message is in flight. The token of the token ring,
+// which goes around until the network stops, is left out, like the
+// heartbeats, the snapshots and the payloads.
+func (network *Network) Traffic() (int64, int64) {
+	return atomic.LoadInt64(&network.traffic[0]), atomic.LoadInt64(&network.traffic[1])
+}
+
+func countsAsTraffic(kind string) bool {
+	switch kind {
+	case "request", "approve", "revoke", "yield", "sk-token":
+		return true
+	}
+	return false
+}
+
+// IsLocal reports whether the account runs in this process
+func (network *Network) IsLocal(id int) bool {
+	return network.registry.isLocal(id)
+}
+
+func (network *Network) send(message Message) {
+	if network.isDead(message.To) {
+		return
+	}
+	message.Clock = int(atomic.LoadInt64(&network.Account(message.From).clock))
+	if countsAsTraffic(message.Kind) && !network.IsLocal(message.To) {
+		atomic.AddInt64(&network.traffic[0], 1)
+	}
+	if network.RequestTimeout > 0 && sequenced(message.Kind) {
+		network.track(message)
+	}
+	err := network.transport.Send(message)
+	select {
+	case <-network.stop:
+		// the other processes may be gone once the run is over
+	default:
+		if err != nil {
+			fmt.Fprintln(network.Output, "Error sending", message.Kind, "to participant", message.To, err)
+		}
+	}
+}
+
+// Broadcast sends a payload from a local account to every account running in
+// another process, where it is handed to OnData
+func (network *Network) Broadcast(from int, data []byte) {
+	network.snapshot_mutex.Lock()
+	defer network.snapshot_mutex.Unlock()
+	for id := range network.registry.all() {
+		if !network.IsLocal(id) {
+			network.send(Message{Kind: "data", From: from, To: id, Data: data})
+		}
+	}
+}
+
+// SendData sends a payload from a local account to a single account, which
+// receives it through OnData like a broadcast one
+func (network *Network) SendData(from int, to int, data []byte) {
+	network.snapshot_mutex.Lock()
+	defer network.snapshot_mutex.Unlock()
+	network.send(Message{Kind: "data", From: from, To: to, Data: data})
+}
+
+func (network *Network) dispatch(account *Account, stop <-chan struct{}) {
+	// route the messages received by a local account to its protocol
+	id := account.id
+	routes := network.registry.route(id)
+	for {
+		var message Message
+		select {
+		case message = <-network.transport.Receive(id):
+		case <-stop:
+			return
+		case <-account.gone:
+			return
+		}
+
+		// any message shows the sender is alive; a failed account is ignored
+		// even if it was only slow
+		if network.isDead(message.From) {
+			continue
+		}
+		network.seen(message.From)
+		network.witness(id, message.Clock)
+		if countsAsTraffic(message.Kind) && !network.IsLocal(message.From) {
+			atomic.AddInt64(&network.traffic[1], 1)
+		}
+		if sequenced(message.Kind) {
+			network.acknowledge(id, message)
+		}
+
+		switch message.Kind {
+		case "request":
+			select {
+			case routes.request <- Request{turn: message.Turn, id: message.From, seq: message.Seq, resources: message.Resources, aged: message.Aged, boost: message.Boost, background: message.Background}:
+			case <-stop:
+				return
+			}
+		case "approve":
+			select {
+			case routes.approve <- Signal{id: message.From, seq: message.Seq, once: message.Once}:
+			case <-stop:
+				return
+			}
+		case "revoke":
+			waiting := Request{turn: message.Turn, id: message.Requester, aged: message.Aged, background: message.Background}
+			select {
+			case routes.revoke <- Signal{id: message.From, seq: message.Seq, grant: message.Grant, waiting: waiting}:
+			case <-stop:
+				return
+			}
+		case "yield":
+			select {
+			case routes.yield <- Signal{id: message.From, seq: message.Seq, grant: message.Grant}:
+			case <-stop:
+				return
+			}
+		case "ack":
+			network.receiveAck(message)
+		case "token":
+			routes.token <- message.Turn
+		case "sk-token":
+			routes.skToken <- &skToken{ln: message.LN, queue: message.Queue}
+		case "heartbeat":
+		case "marker":
+			network.receiveMarker(message)
+		case "snapshot-state":
+			network.receiveSnapshotPart(message)
+		case "data":
+			network.countInFlight(message)
+			if network.OnData != nil {
+				network.OnData(message.From, message.Data)
+			}
+		default:
+			fmt.Fprintln(network.Output, "Unknown message kind:", message.Kind)
+		}
+	}
+}
+
+func (network *Network) observe(kind string, account int, peer int) {
+	if network.Observer != nil {
+		network.Observer.Observe(kind, account, peer, network.Tick(account))
+	}
+}
+
+// Tick advances the Lamport clock of an account for a new event of it and
+// returns the clock of the event
+func (network *Network) Tick(id int) int {
+	return int(atomic.AddInt64(&network.Account(id).clock, 1))
+}
+
+// Clock returns the Lamport clock of an account
+func (network *Network) Clock(id int) int {
+	return int(atomic.LoadInt64(&network.Account(id).clock))
+}
+
+// AdvanceClock moves the Lamport clock of an account to at least the given
+// clock, e.g. to resume it where an earlier run left it
+func (network *Network) AdvanceClock(id int, clock int) {
+	network.witness(id, clock)
+}
+
+func (network *Network) witness(id int, clock int) {
+	// a received message moves the clock of the receiver past the sender's
+	account := network.Account(id)
+	for {
+		current := atomic.LoadInt64(&account.clock)
+		if int64(clock) <= current || atomic.CompareAndSwapInt64(&account.clock, current, int64(clock)) {
+			return
+		}
+	}
+}
+
+// Start runs the goroutines receiving the messages of the local accounts and,
+// for the token ring, starts circulating the token from the first account
+func (network *Network) Start() {
+	for id := range network.registry.all() {
+		network.seen(id)
+	}
+	if network.HeartbeatInterval > 0 {
+		go network.heartbeat(network.stop)
+	}
+	if network.FailureTimeout > 0 {
+		go network.detectFailures(network.stop)
+	}
+	if network.RequestTimeout > 0 {
+		go network.resend(network.stop)
+	}
+	for _, account := range network.registry.all() {
+		if network.IsLocal(account.id) {
+			network.run(account)
+		}
+	}
+	if network.Algorithm() == TokenRing {
+		network.startTokenRing(0)
+	}
+}
+
+func (network *Network) startTokenRing(epoch int) {
+	// token-ring: pass the token around the accounts of this process, the
+	// first live account starting with a token of the given epoch
+	network.circulateOnce.Do(func() {
+		atomic.StoreInt32(&network.circulating, 1)
+		for _, account := range network.registry.all() {
+			if network.IsLocal(account.id) {
+				go account.circulateToken(network.stop)
+			}
+		}
+	})
+	first := network.nextAlive(network.Len() - 1)
+	if network.IsLocal(first) {
+		network.registry.route(first).token <- epoch
+	}
+}
+
+func (network *Network) run(account *Account) {
+	// start the goroutines receiving the messages of a local account
+	go network.dispatch(account, network.stop)
+	go account.listen(network.stop)
+}
+
+// Stop ends the goroutines started by Start and closes the transport; no
+// account may be inside or waiting for the CS
+func (network *Network) Stop() {
+	network.stopOnce.Do(func() {
+		close(network.stop)
+		network.transport.Close()
+	})
+}
+
+// Sites is the number of accounts taking part in the distributed protocol in
+// hybrid mode, 0 otherwise
+func (network *Network) Sites() int {
+	return network.sites
+}
+
+// ApplyGroups switches to hybrid mode: the accounts of each group are
+// co-located and share a local lock, and the lowest account of the group is
+// its site in the distributed protocol. The quorums of the sites are
+// restricted to sites; two quorums sharing an account now share the site of
+// that account, so the site quorums still intersect. It must be called before
+// Start and returns the number of sites.
+func (network *Network) ApplyGroups(groups [][]int) int {
+	accounts := network.registry.all()
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		site := group[0]
+		for _, id := range group {
+			if id < site {
+				site = id
+			}
+		}
+		lock := &sync.Mutex{}
+		for _, id := range group {
+			if accounts[id].site != nil {
+				fmt.Fprintln(network.Output, "Account", id, "is listed in more than one group")
+				continue
+			}
+			accounts[id].site = accounts[site]
+			accounts[id].group = lock
+		}
+	}
+
+	sites := 0
+	for _, account := range accounts {
+		if account.siteAccount() != account {
+			continue
+		}
+		sites++
+		members := make(map[int]bool)
+		quorum := make([]int, 0, len(account.quorum))
+		for _, qid := range account.quorum {
+			site := accounts[qid].siteAccount().id
+			if !members[site] {
+				members[site] = true
+				quorum = append(quorum, site)
+			}
+		}
+		account.quorum = quorum
+	}
+	network.sites = sites
+	return sites
+}
+
+func (network *Network) clock() Clock {
+	return clockOr(network.TimeSource)
+}
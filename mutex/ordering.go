@@ -0,0 +1,138 @@
+package mutex
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Ordering is the delivery order a transport guarantees for the messages
+// addressed to an account. The protocols number their requests, approvals and
+// revocations per sender, so those stay in order under any mode; what the
+// other modes expose is what relies on the channels themselves, such as an
+// approval overtaken by a revocation or a snapshot marker overtaking the
+// payloads sent before it.
+type Ordering string
+
+const (
+	// FIFO delivers the messages from one account to another in the order
+	// they were sent, as the channel and TCP transports always did
+	FIFO Ordering = "fifo"
+	// Causal never delivers a message before one that causally precedes it,
+	// whoever sent it (Raynal-Schiper-Toueg); it assumes no message is lost
+	Causal Ordering = "causal"
+	// Unordered delivers any of the messages waiting for an account
+	Unordered Ordering = "unordered"
+)
+
+// Orderings lists the ordering modes, e.g. to run a check under each of them
+var Orderings = []Ordering{FIFO, Causal, Unordered}
+
+// orderer picks the next message delivered to each account of a transport;
+// the mailboxes of the transport share it
+type orderer struct {
+	mutex    sync.Mutex
+	ordering Ordering
+	random   *rand.Rand
+	// causal: the messages from account k to account l each local account
+	// knows were sent, and the messages delivered to it from each sender
+	sent      map[int]map[[2]int]int
+	delivered map[int]map[int]int
+}
+
+func newOrderer() *orderer {
+	return &orderer{
+		ordering:  FIFO,
+		sent:      make(map[int]map[[2]int]int),
+		delivered: make(map[int]map[int]int),
+	}
+}
+
+func (order *orderer) set(ordering Ordering, seed int64) {
+	// unordered delivery draws from the seed, or from the clock when it is 0
+	order.mutex.Lock()
+	defer order.mutex.Unlock()
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	order.ordering = ordering
+	order.random = rand.New(rand.NewSource(seed))
+}
+
+func (order *orderer) stamp(message *Message) {
+	// causal: attach what the sender knows was sent so far and count the
+	// message as sent
+	order.mutex.Lock()
+	defer order.mutex.Unlock()
+	if order.ordering != Causal {
+		return
+	}
+	sent := order.matrix(message.From)
+	message.Sent = make([][3]int, 0, len(sent))
+	for edge, count := range sent {
+		message.Sent = append(message.Sent, [3]int{edge[0], edge[1], count})
+	}
+	sent[[2]int{message.From, message.To}]++
+}
+
+func (order *orderer) matrix(id int) map[[2]int]int {
+	// the caller must hold mutex
+	sent, ok := order.sent[id]
+	if !ok {
+		sent = make(map[[2]int]int)
+		order.sent[id] = sent
+	}
+	return sent
+}
+
+func (order *orderer) next(id int, queue []Message) int {
+	// the index of the message of the queue delivered next to the account, or
+	// -1 if none of them may be delivered yet; the message counts as
+	// delivered from now on
+	order.mutex.Lock()
+	defer order.mutex.Unlock()
+	if len(queue) == 0 {
+		return -1
+	}
+	switch order.ordering {
+	case Unordered:
+		return order.random.Intn(len(queue))
+	case Causal:
+		delivered := order.delivered[id]
+		for index, message := range queue {
+			if order.deliverable(id, delivered, message) {
+				order.deliver(id, message)
+				return index
+			}
+		}
+		return -1
+	default:
+		return 0
+	}
+}
+
+func (order *orderer) deliverable(id int, delivered map[int]int, message Message) bool {
+	// every message to the account the sender knew of was delivered
+	for _, entry := range message.Sent {
+		if entry[1] == id && delivered[entry[0]] < entry[2] {
+			return false
+		}
+	}
+	return true
+}
+
+func (order *orderer) deliver(id int, message Message) {
+	// what the sender knew was sent is now known to the account too
+	delivered, ok := order.delivered[id]
+	if !ok {
+		delivered = make(map[int]int)
+		order.delivered[id] = delivered
+	}
+	delivered[message.From]++
+	sent := order.matrix(id)
+	for _, entry := range message.Sent {
+		edge := [2]int{entry[0], entry[1]}
+		sent[edge] = max(sent[edge], entry[2])
+	}
+	sent[[2]int{message.From, id}] = max(sent[[2]int{message.From, id}], delivered[message.From])
+}
@@ -0,0 +1,68 @@
+package mutex
+
+import "sync/atomic"
+
+// Prefetch asks the quorum for the CS ahead of time while the account is idle
+// but knows it will need the CS soon, so the approvals are already there when
+// it calls Enter. Until then the speculative requests don't hold anything up:
+// the account answers every request at once, and answering a quorum member
+// gives back the approval that member granted or will grant it, so Enter asks
+// that member again. Only the permission-based algorithms prefetch; the call
+// does nothing while the account is waiting for or inside the CS, or in
+// hybrid mode while a co-located account uses the site. The network must not
+// switch algorithms while speculative requests are outstanding.
+func (account *Account) Prefetch() {
+	switch account.network.Algorithm() {
+	case Original, Optimized:
+	default:
+		return
+	}
+	if account.group != nil {
+		if !account.group.TryLock() {
+			return
+		}
+		defer account.group.Unlock()
+	}
+	site := account.siteAccount()
+	if site.requestCS {
+		return
+	}
+
+	// the turn Enter will take at the earliest; it takes a new one then, as
+	// the turns seen in the meantime must not have priority over it
+	site.permit_mutex.Lock()
+	turn := site.turn + site.highestTurn + 1
+	targets := make([]int, 0, len(site.quorum))
+	for _, qid := range site.missingPermits() {
+		// a member still owing a revoked approval is asked again on Enter
+		if !site.prefetched[qid] && site.stale[qid] == 0 {
+			site.prefetched[qid] = true
+			targets = append(targets, qid)
+		}
+	}
+	site.permit_mutex.Unlock()
+
+	for _, qid := range targets {
+		site.request(qid, turn)
+	}
+
+	// Update metrics
+	atomic.AddInt64(&site.network.counters.Requests, int64(len(targets)))
+	atomic.AddInt64(&site.network.counters.Prefetched, int64(len(targets)))
+}
+
+func (account *Account) revokePrefetch(from int) bool {
+	// answering a request gives back the speculative approval of the
+	// requester: it may enter before us now. An approval still on its way is
+	// dropped when it arrives. The caller must hold permit_mutex.
+	if !account.prefetched[from] {
+		return false
+	}
+	delete(account.prefetched, from)
+	if !account.outstandingPermit[from] {
+		account.stale[from]++
+	}
+	account.outstandingPermit[from] = false
+	atomic.AddInt64(&account.network.counters.PrefetchRevoked, 1)
+	return true
+}
@@ -0,0 +1,145 @@
+package mutex
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// QuorumGenerators are the quorum constructions selectable by name
+var QuorumGenerators = map[string]func(n_accounts int) [][]int{
+	"maekawa": MaekawaQuorums,
+	"grid":    GridQuorums,
+	"full":    FullQuorums,
+}
+
+// FullQuorums makes every account the quorum of every account
+func FullQuorums(n_accounts int) [][]int {
+	quorums := make([][]int, n_accounts)
+	for i := 0; i < n_accounts; i++ {
+		quorums[i] = make([]int, n_accounts)
+		for j := 0; j < n_accounts; j++ {
+			quorums[i][j] = j
+		}
+	}
+	return quorums
+}
+
+// GridQuorums lays the accounts out row by row in a square grid; the quorum of
+// an account is its row plus its column, so any two quorums share at least
+// one account
+func GridQuorums(n_accounts int) [][]int {
+	side := int(math.Ceil(math.Sqrt(float64(n_accounts))))
+	quorums := make([][]int, n_accounts)
+	for i := 0; i < n_accounts; i++ {
+		row, col := i/side, i%side
+		members := make(map[int]bool)
+		for j := row * side; j < (row+1)*side && j < n_accounts; j++ {
+			members[j] = true
+		}
+		for j := col; j < n_accounts; j += side {
+			members[j] = true
+		}
+		for j := range members {
+			quorums[i] = append(quorums[i], j)
+		}
+		sort.Ints(quorums[i])
+	}
+	return quorums
+}
+
+// MaekawaQuorums builds quorums of about √N accounts from the lines of a
+// finite projective plane of prime order p, the smallest with p²+p+1 points
+// for the accounts: any two lines meet in a point, so any two quorums share
+// an account. Points past the last account stand for account point mod N,
+// which keeps the intersections. The quorum of an account is a line through
+// its point.
+func MaekawaQuorums(n_accounts int) [][]int {
+	if n_accounts <= 2 {
+		return FullQuorums(n_accounts)
+	}
+	p := 2
+	for p*p+p+1 < n_accounts || !isPrime(p) {
+		p++
+	}
+
+	// the points (and lines) of the plane are the triples whose first
+	// non-zero coordinate is 1
+	points := make([][3]int, 0, p*p+p+1)
+	points = append(points, [3]int{0, 0, 1})
+	for y := 0; y < p; y++ {
+		points = append(points, [3]int{0, 1, y})
+	}
+	for y := 0; y < p; y++ {
+		for z := 0; z < p; z++ {
+			points = append(points, [3]int{1, y, z})
+		}
+	}
+
+	quorums := make([][]int, n_accounts)
+	for i := 0; i < n_accounts; i++ {
+		for _, line := range points {
+			if incident(points[i], line, p) {
+				members := make(map[int]bool)
+				for j, point := range points {
+					if incident(point, line, p) {
+						members[j%n_accounts] = true
+					}
+				}
+				for j := range members {
+					quorums[i] = append(quorums[i], j)
+				}
+				sort.Ints(quorums[i])
+				break
+			}
+		}
+	}
+	return quorums
+}
+
+func incident(point [3]int, line [3]int, p int) bool {
+	return (point[0]*line[0]+point[1]*line[1]+point[2]*line[2])%p == 0
+}
+
+func isPrime(n int) bool {
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return n >= 2
+}
+
+// ValidateQuorums checks that the quorums only name existing accounts and
+// pairwise intersect; without a common member two accounts could be granted
+// the CS at the same time
+func ValidateQuorums(quorums [][]int) error {
+	n_accounts := len(quorums)
+	members := make([]map[int]bool, n_accounts)
+	for i, quorum := range quorums {
+		members[i] = make(map[int]bool)
+		for _, id := range quorum {
+			if id < 0 || id >= n_accounts {
+				return fmt.Errorf("quorum of account %d names account %d, which doesn't exist", i, id)
+			}
+			members[i][id] = true
+		}
+	}
+	for i := 0; i < n_accounts; i++ {
+		for j := i + 1; j < n_accounts; j++ {
+			if !intersect(members[i], quorums[j]) {
+				return fmt.Errorf("quorums of accounts %d and %d don't intersect, so both could enter the CS at the same time", i, j)
+			}
+		}
+	}
+	return nil
+}
+
+func intersect(members map[int]bool, quorum []int) bool {
+	for _, id := range quorum {
+		if members[id] {
+			return true
+		}
+	}
+	return false
+}
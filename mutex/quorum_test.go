@@ -0,0 +1,91 @@
+package mutex
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// originalTest4 is the quorum file tests/test_4 shipped with: the quorums of
+// accounts 0 and 8 (among others) share no account
+var originalTest4 = [][]int{
+	{0, 1, 2, 3},
+	{0, 1, 4, 5},
+	{0, 2, 6, 7},
+	{0, 3, 8, 9},
+	{1, 2, 3, 4},
+	{1, 5, 6, 7},
+	{2, 4, 8, 9},
+	{3, 5, 7, 9},
+	{4, 6, 8, 9},
+	{5, 6, 7, 8},
+}
+
+func TestValidateQuorumsRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		quorums [][]int
+		message string
+	}{
+		{"original tests/test_4", originalTest4, "accounts 0 and 8 don't intersect"},
+		{"disjoint pairs", [][]int{{0, 1}, {0, 1}, {2, 3}, {2, 3}}, "accounts 0 and 2 don't intersect"},
+		{"empty quorum", [][]int{{0, 1}, {}}, "accounts 0 and 1 don't intersect"},
+		{"unknown account", [][]int{{0, 1}, {1, 2}}, "names account 2"},
+		{"negative account", [][]int{{0, -1}, {0, 1}}, "names account -1"},
+	}
+	for _, test := range tests {
+		err := ValidateQuorums(test.quorums)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: ValidateQuorums returned %v, expected %q", test.name, err, test.message)
+		}
+	}
+}
+
+func TestGeneratedQuorumsIntersect(t *testing.T) {
+	// every pair of generated quorums shares an account, for square and
+	// non-square numbers of accounts, and Maekawa quorums stay about √N
+	generators := map[string]func(int) [][]int{
+		"full":    FullQuorums,
+		"grid":    GridQuorums,
+		"maekawa": MaekawaQuorums,
+	}
+	for name, generate := range generators {
+		for n := 1; n <= 60; n++ {
+			t.Run(fmt.Sprintf("%s/%d", name, n), func(t *testing.T) {
+				quorums := generate(n)
+				if len(quorums) != n {
+					t.Fatalf("%d quorums for %d accounts", len(quorums), n)
+				}
+				if err := ValidateQuorums(quorums); err != nil {
+					t.Fatal(err)
+				}
+				for i := range quorums {
+					for j := range quorums {
+						if !shareAccount(quorums[i], quorums[j]) {
+							t.Fatalf("quorums %v of account %d and %v of account %d don't intersect", quorums[i], i, quorums[j], j)
+						}
+					}
+				}
+			})
+		}
+	}
+	for _, n := range []int{10, 31, 50, 100} {
+		for i, quorum := range MaekawaQuorums(n) {
+			if float64(len(quorum)) > 2*math.Sqrt(float64(n))+1 {
+				t.Errorf("%d accounts: the Maekawa quorum of account %d has %d members", n, i, len(quorum))
+			}
+		}
+	}
+}
+
+func shareAccount(a []int, b []int) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package mutex
+
+import "sync"
+
+// registry holds the accounts of a network, which of them run in this process
+// and the channels the messages received by each local account are routed
+// to. Accounts may join while the network runs, so the goroutines of the
+// protocol read it under its lock and range over copies.
+type registry struct {
+	mutex    sync.RWMutex
+	accounts []*Account
+	local    map[int]bool
+	routes   map[int]*routes
+}
+
+// routes are the channels the messages received by a local account are
+// routed to
+type routes struct {
+	request chan Request  // requests to enter the critical section
+	approve chan Signal   // approvals to enter the critical section
+	revoke  chan Signal   // revoking a standing permission granted earlier
+	yield   chan Signal   // optimized: a permission given back after a revocation
+	token   chan int      // token-ring: the token, by its epoch
+	skToken chan *skToken // Suzuki-Kasami: the token
+}
+
+func newRoutes(n_accounts int) *routes {
+	// approvals only answer the requests of the receiver, so two slots per
+	// account (a prefetched approval given back and the one replacing it) are
+	// enough for a listener never to block on an approval while the receiver
+	// is still sending its requests
+	return &routes{
+		request: make(chan Request),
+		approve: make(chan Signal, 2*n_accounts),
+		revoke:  make(chan Signal),
+		yield:   make(chan Signal),
+		token:   make(chan int, n_accounts),
+		skToken: make(chan *skToken, 1),
+	}
+}
+
+func (registry *registry) add(account *Account, local bool, n_accounts int) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.accounts = append(registry.accounts, account)
+	registry.routes[account.id] = newRoutes(n_accounts)
+	if local {
+		registry.local[account.id] = true
+	}
+}
+
+func (registry *registry) get(id int) *Account {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	return registry.accounts[id]
+}
+
+func (registry *registry) all() []*Account {
+	// a copy of the accounts, by id
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	return append([]*Account(nil), registry.accounts...)
+}
+
+func (registry *registry) len() int {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	return len(registry.accounts)
+}
+
+func (registry *registry) isLocal(id int) bool {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	return registry.local[id]
+}
+
+func (registry *registry) locals() []int {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	ids := make([]int, 0, len(registry.local))
+	for id := range registry.local {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (registry *registry) route(id int) *routes {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	return registry.routes[id]
+}
@@ -0,0 +1,71 @@
+package mutex
+
+import "sort"
+
+// EnterFor blocks until the account holds the critical section for the given
+// accounts (resource mode): with the permission-based algorithms, only the
+// requests sharing one of them, or for the whole CS, wait for each other, so
+// transfers between disjoint accounts run in parallel. Conflicting requests
+// are served in the order of their (turn, id) priority, the same for every
+// account, so no cycle of requests can wait on each other whatever order
+// their resources are requested in. An approval given while the approver asks
+// for other resources is only good for that entry, so the RC optimization
+// can't reuse it for them later. The token-based algorithms have a single
+// token and enter the whole CS. Release it with Exit.
+func (account *Account) EnterFor(resources ...int) {
+	if account.group != nil {
+		account.group.Lock()
+	}
+	site := account.siteAccount()
+	request := site.NewRequest()
+	request.resources = normalizeResources(resources)
+	site.askCS(request)
+}
+
+// Resources returns the accounts the account requested or holds the CS for,
+// nil for the whole CS
+func (account *Account) Resources() []int {
+	site := account.siteAccount()
+	site.permit_mutex.Lock()
+	defer site.permit_mutex.Unlock()
+	return append([]int(nil), site.resources...)
+}
+
+func normalizeResources(resources []int) []int {
+	// the resources sorted without duplicates, an empty set meaning every
+	// resource
+	if len(resources) == 0 {
+		return nil
+	}
+	sorted := append([]int(nil), resources...)
+	sort.Ints(sorted)
+	unique := sorted[:1]
+	for _, id := range sorted[1:] {
+		if id != unique[len(unique)-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// ResourcesOverlap reports whether two resource sets conflict: they share a
+// resource or either of them is nil, the whole CS
+func ResourcesOverlap(a []int, b []int) bool {
+	if a == nil || b == nil {
+		return true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (account *Account) conflicts(resources []int) bool {
+	// whether a request for the resources conflicts with ours; the caller
+	// must hold permit_mutex
+	return ResourcesOverlap(account.resources, resources)
+}
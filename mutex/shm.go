@@ -0,0 +1,344 @@
+//go:build unix
+
+package mutex
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// SharedMemoryTransport carries the messages between processes of the same
+// host through a ring buffer per account, a file of the given directory
+// (/dev/shm on Linux keeps it in memory) mapped by the process hosting the
+// account and by every process sending to it. Messages are JSON records
+// prefixed by their length; the senders take turns through a spin lock in the
+// ring's header, and the host polls the ring for new records.
+type SharedMemoryTransport struct {
+	dir       string
+	mailboxes map[int]*mailbox // accounts hosted by this process
+	// how long to wait for the ring of an account whose process hasn't
+	// created it yet
+	OpenTimeout time.Duration
+
+	order    *orderer
+	mutex    sync.RWMutex // held for reading while a ring is written to
+	rings    map[int]*ring
+	closed   bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     sync.WaitGroup
+
+	output       io.Writer // where messages that can't be decoded are reported
+	output_mutex sync.Mutex
+}
+
+// the layout of a ring file: a header of the sender lock, whether the host
+// is ready and the bytes written and read so far, then the records
+const (
+	ringLock   = 0
+	ringReady  = 4
+	ringWrite  = 8
+	ringRead   = 16
+	ringHeader = 64
+	// RingSize is the size of the ring file of each account
+	RingSize = 1 << 20
+)
+
+type ring struct {
+	file *os.File
+	data []byte
+}
+
+func (r *ring) word(offset int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&r.data[offset]))
+}
+
+func (r *ring) counter(offset int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&r.data[offset]))
+}
+
+func (r *ring) copyIn(at uint64, record []byte) {
+	// copy a record to the ring, wrapping around its end
+	capacity := uint64(len(r.data) - ringHeader)
+	for len(record) > 0 {
+		start := ringHeader + int(at%capacity)
+		n := copy(r.data[start:], record)
+		record = record[n:]
+		at += uint64(n)
+	}
+}
+
+func (r *ring) copyOut(at uint64, record []byte) {
+	capacity := uint64(len(r.data) - ringHeader)
+	for len(record) > 0 {
+		start := ringHeader + int(at%capacity)
+		n := copy(record, r.data[start:])
+		record = record[n:]
+		at += uint64(n)
+	}
+}
+
+func (r *ring) close() {
+	syscall.Munmap(r.data)
+	r.file.Close()
+}
+
+// NewSharedMemoryTransport hosts the local accounts, creating their rings in
+// dir, and reaches the other accounts of the run through the rings their
+// processes create there
+func NewSharedMemoryTransport(dir string, n_accounts int, local []int) (*SharedMemoryTransport, error) {
+	if len(local) == 0 {
+		return nil, fmt.Errorf("no local account")
+	}
+	transport := &SharedMemoryTransport{
+		dir:         dir,
+		mailboxes:   make(map[int]*mailbox),
+		OpenTimeout: 10 * time.Second,
+		order:       newOrderer(),
+		rings:       make(map[int]*ring),
+		stop:        make(chan struct{}),
+		output:      os.Stdout,
+	}
+	for _, id := range local {
+		if id < 0 || id >= n_accounts {
+			return nil, fmt.Errorf("no account %d", id)
+		}
+		r, err := transport.create(id)
+		if err != nil {
+			transport.Close()
+			return nil, err
+		}
+		transport.rings[id] = r
+		transport.mailboxes[id] = newMailbox(id, transport.order)
+	}
+	for id := range transport.mailboxes {
+		transport.done.Add(1)
+		go transport.poll(id, transport.rings[id])
+	}
+	return transport, nil
+}
+
+func (transport *SharedMemoryTransport) path(id int) string {
+	return filepath.Join(transport.dir, fmt.Sprintf("account-%d.ring", id))
+}
+
+func (transport *SharedMemoryTransport) create(id int) (*ring, error) {
+	// a fresh ring, renamed into place so no sender maps it half set up
+	temp := transport.path(id) + ".new"
+	file, err := os.OpenFile(temp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(RingSize); err != nil {
+		file.Close()
+		return nil, err
+	}
+	r, err := mapRing(file)
+	if err != nil {
+		return nil, err
+	}
+	atomic.StoreUint32(r.word(ringReady), 1)
+	if err := os.Rename(temp, transport.path(id)); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func mapRing(file *os.File) (*ring, error) {
+	data, err := syscall.Mmap(int(file.Fd()), 0, RingSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &ring{file: file, data: data}, nil
+}
+
+func (transport *SharedMemoryTransport) open(id int) error {
+	// map the ring of an account of another process, waiting for its process
+	// to create it
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	if _, ok := transport.rings[id]; ok || transport.closed {
+		return nil
+	}
+	deadline := time.Now().Add(transport.OpenTimeout)
+	for {
+		file, err := os.OpenFile(transport.path(id), os.O_RDWR, 0)
+		if err == nil {
+			r, err := mapRing(file)
+			if err != nil {
+				return err
+			}
+			if atomic.LoadUint32(r.word(ringReady)) == 1 {
+				transport.rings[id] = r
+				return nil
+			}
+			r.close()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no ring for account %d in %s", id, transport.dir)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// SetOutput sets where the transport reports the messages it can't decode
+// (os.Stdout by default)
+func (transport *SharedMemoryTransport) SetOutput(output io.Writer) {
+	transport.output_mutex.Lock()
+	defer transport.output_mutex.Unlock()
+	transport.output = output
+}
+
+func (transport *SharedMemoryTransport) report(args ...any) {
+	transport.output_mutex.Lock()
+	output := transport.output
+	transport.output_mutex.Unlock()
+	fmt.Fprintln(output, args...)
+}
+
+// SetOrdering changes the delivery order to the local accounts (FIFO by
+// default), drawing the unordered deliveries from the seed; every process of
+// the run must use the same ordering, set before any message is sent
+func (transport *SharedMemoryTransport) SetOrdering(ordering Ordering, seed int64) {
+	transport.order.set(ordering, seed)
+}
+
+// Send appends the message to the ring of its account. It only waits while
+// the ring is full, until the host drains it into the account's mailbox.
+func (transport *SharedMemoryTransport) Send(message Message) error {
+	transport.order.stamp(&message)
+	if box, ok := transport.mailboxes[message.To]; ok {
+		box.put(message)
+		return nil
+	}
+	if message.To < 0 {
+		return fmt.Errorf("no account %d", message.To)
+	}
+	if err := transport.open(message.To); err != nil {
+		return err
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(record, uint32(len(data)))
+	copy(record[4:], data)
+
+	// the ring stays mapped until we are done with it
+	transport.mutex.RLock()
+	defer transport.mutex.RUnlock()
+	r, ok := transport.rings[message.To]
+	if !ok {
+		return fmt.Errorf("transport closed")
+	}
+	capacity := uint64(len(r.data) - ringHeader)
+	if uint64(len(record)) > capacity {
+		return fmt.Errorf("message of %d bytes too large for the ring", len(data))
+	}
+	for {
+		for !atomic.CompareAndSwapUint32(r.word(ringLock), 0, 1) {
+			runtime.Gosched()
+		}
+		write := atomic.LoadUint64(r.counter(ringWrite))
+		if write-atomic.LoadUint64(r.counter(ringRead))+uint64(len(record)) <= capacity {
+			r.copyIn(write, record)
+			atomic.StoreUint64(r.counter(ringWrite), write+uint64(len(record)))
+			atomic.StoreUint32(r.word(ringLock), 0)
+			return nil
+		}
+		atomic.StoreUint32(r.word(ringLock), 0)
+		select {
+		case <-transport.stop:
+			return fmt.Errorf("transport closed")
+		case <-time.After(50 * time.Microsecond):
+		}
+	}
+}
+
+func (transport *SharedMemoryTransport) poll(id int, r *ring) {
+	// move the records of a local account's ring to its mailbox, spinning
+	// briefly and then backing off while the ring stays empty
+	defer transport.done.Done()
+	box := transport.mailboxes[id]
+	idle := 0
+	for {
+		read := atomic.LoadUint64(r.counter(ringRead))
+		write := atomic.LoadUint64(r.counter(ringWrite))
+		if read == write {
+			idle++
+			var wait time.Duration
+			switch {
+			case idle < 100:
+				runtime.Gosched()
+				continue
+			case idle < 1000:
+				wait = 10 * time.Microsecond
+			default:
+				wait = time.Millisecond
+			}
+			select {
+			case <-transport.stop:
+				return
+			case <-time.After(wait):
+			}
+			continue
+		}
+		idle = 0
+		for read < write {
+			var header [4]byte
+			r.copyOut(read, header[:])
+			data := make([]byte, binary.LittleEndian.Uint32(header[:]))
+			r.copyOut(read+4, data)
+			read += 4 + uint64(len(data))
+			var message Message
+			if err := json.Unmarshal(data, &message); err != nil {
+				transport.report("Error decoding a message for account", id, err)
+				continue
+			}
+			box.put(message)
+		}
+		atomic.StoreUint64(r.counter(ringRead), read)
+	}
+}
+
+func (transport *SharedMemoryTransport) reserve(fanIn []int) {
+	reserveMailboxes(transport.mailboxes, fanIn)
+}
+
+func (transport *SharedMemoryTransport) Receive(id int) <-chan Message {
+	return transport.mailboxes[id].out
+}
+
+// Close stops polling the rings of the local accounts and removes them
+func (transport *SharedMemoryTransport) Close() error {
+	transport.stopOnce.Do(func() { close(transport.stop) })
+	transport.done.Wait()
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	transport.closed = true
+	for id, r := range transport.rings {
+		if _, ok := transport.mailboxes[id]; ok {
+			atomic.StoreUint32(r.word(ringReady), 0)
+			os.Remove(transport.path(id))
+		}
+		r.close()
+	}
+	transport.rings = make(map[int]*ring)
+	for _, box := range transport.mailboxes {
+		box.close()
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package mutex
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// SharedMemoryTransport needs the memory-mapped files of a unix system
+type SharedMemoryTransport struct {
+	OpenTimeout time.Duration
+}
+
+const RingSize = 1 << 20
+
+func NewSharedMemoryTransport(dir string, n_accounts int, local []int) (*SharedMemoryTransport, error) {
+	return nil, fmt.Errorf("the shared memory transport needs a unix system")
+}
+
+func (transport *SharedMemoryTransport) SetOutput(output io.Writer) {}
+
+func (transport *SharedMemoryTransport) SetOrdering(ordering Ordering, seed int64) {}
+
+func (transport *SharedMemoryTransport) Send(message Message) error {
+	return fmt.Errorf("the shared memory transport needs a unix system")
+}
+
+func (transport *SharedMemoryTransport) Receive(id int) <-chan Message {
+	return nil
+}
+
+func (transport *SharedMemoryTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,162 @@
+package mutex
+
+import "sync/atomic"
+
+// Chandy-Lamport snapshots of the processes of a run. The nodes are the
+// processes: the accounts of one process share their state in memory, so a
+// process records it at once through OnRecord. A recording process sends a
+// marker from each of its accounts to every account of the other processes
+// before any of them sends another payload; a process records when the
+// first marker reaches it and is done when a marker arrived on every channel
+// into it. The payloads received on a channel between the recording and its
+// marker were in flight when the snapshot was taken. Every process then sends
+// its part to the others, so each one ends up with the whole snapshot and
+// hands it to OnSnapshot.
+
+type snapshot struct {
+	recorded bool
+	done     bool
+	markers  map[[2]int]bool // channels (from, to) the marker arrived on
+	inFlight int
+	parts    map[int][]byte // the state of each process, by its first account
+	covered  map[int]bool   // accounts of the processes whose part arrived
+}
+
+func (network *Network) snapshotState(id int) *snapshot {
+	// the caller must hold snapshot_mutex
+	state, ok := network.snapshots[id]
+	if !ok {
+		state = &snapshot{
+			markers: make(map[[2]int]bool),
+			parts:   make(map[int][]byte),
+			covered: make(map[int]bool),
+		}
+		network.snapshots[id] = state
+	}
+	return state
+}
+
+// Snapshot starts a snapshot of every process from this one; the processes
+// must have distinct initiators or take turns
+func (network *Network) Snapshot() int {
+	id := int(atomic.AddInt64(&network.snapshotSeq, 1))
+	network.snapshot_mutex.Lock()
+	defer network.snapshot_mutex.Unlock()
+	network.record(id, network.snapshotState(id))
+	return id
+}
+
+func (network *Network) firstLocal() int {
+	for id := range network.registry.all() {
+		if network.IsLocal(id) {
+			return id
+		}
+	}
+	return -1
+}
+
+func (network *Network) record(id int, state *snapshot) {
+	// record our state and send the markers; the caller holds snapshot_mutex,
+	// which Broadcast takes too, so no payload overtakes a marker
+	state.recorded = true
+	var part []byte
+	if network.OnRecord != nil {
+		part = network.OnRecord(id)
+	}
+	first := network.firstLocal()
+	state.parts[first] = part
+	accounts := network.registry.all()
+	locals := network.registry.locals()
+	for _, local := range locals {
+		state.covered[local] = true
+	}
+	for _, from := range locals {
+		for to := range accounts {
+			if !network.IsLocal(to) && !network.isDead(to) {
+				network.send(Message{Kind: "marker", From: from, To: to, Turn: id})
+			}
+		}
+	}
+	network.completeSnapshot(id, state)
+}
+
+func (network *Network) completeSnapshot(id int, state *snapshot) {
+	// send our part once a marker arrived on every channel into this process,
+	// and hand the snapshot over once every process sent its part; the caller
+	// holds snapshot_mutex
+	accounts := network.registry.all()
+	if !state.done {
+		locals := network.registry.locals()
+		for _, to := range locals {
+			for from := range accounts {
+				if !network.IsLocal(from) && !network.isDead(from) && !state.markers[[2]int{from, to}] {
+					return
+				}
+			}
+		}
+		state.done = true
+		first := network.firstLocal()
+		for to := range accounts {
+			if !network.IsLocal(to) && !network.isDead(to) {
+				network.send(Message{Kind: "snapshot-state", From: first, To: to, Turn: id, Seq: state.inFlight, Queue: locals, Data: state.parts[first]})
+			}
+		}
+	}
+
+	for account := range accounts {
+		if !state.covered[account] && !network.isDead(account) {
+			return
+		}
+	}
+	delete(network.snapshots, id)
+	if network.OnSnapshot != nil {
+		parts := make([][]byte, 0, len(state.parts))
+		for _, part := range state.parts {
+			parts = append(parts, part)
+		}
+		network.OnSnapshot(id, parts, state.inFlight)
+	}
+}
+
+func (network *Network) receiveMarker(message Message) {
+	network.snapshot_mutex.Lock()
+	defer network.snapshot_mutex.Unlock()
+	state := network.snapshotState(message.Turn)
+	state.markers[[2]int{message.From, message.To}] = true
+	if !state.recorded {
+		network.record(message.Turn, state)
+		return
+	}
+	network.completeSnapshot(message.Turn, state)
+}
+
+func (network *Network) receiveSnapshotPart(message Message) {
+	network.snapshot_mutex.Lock()
+	defer network.snapshot_mutex.Unlock()
+	state, ok := network.snapshots[message.Turn]
+	if !ok {
+		// every account of a process receives the part: keep the first copy
+		return
+	}
+	if _, ok := state.parts[message.From]; ok {
+		return
+	}
+	state.parts[message.From] = message.Data
+	state.inFlight += message.Seq
+	for _, id := range message.Queue {
+		state.covered[id] = true
+	}
+	network.completeSnapshot(message.Turn, state)
+}
+
+func (network *Network) countInFlight(message Message) {
+	// a payload received after we recorded and before the marker of its
+	// channel was in flight when the snapshot was taken
+	network.snapshot_mutex.Lock()
+	defer network.snapshot_mutex.Unlock()
+	for _, state := range network.snapshots {
+		if state.recorded && !state.done && !state.markers[[2]int{message.From, message.To}] {
+			state.inFlight++
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package mutex
+
+import "sync/atomic"
+
+// Suzuki-Kasami: an account without the token broadcasts a numbered request
+// and waits for the token; the holder passes the token on when it leaves the
+// CS, so an entry costs n-1 requests and one token message, or nothing when
+// the account already holds the token
+
+type skToken struct {
+	// the request number of the last entry of every account, and the accounts
+	// the token goes to next
+	ln    []int
+	queue []int
+}
+
+func (account *Account) skAsk() {
+	// ask for the token unless we already hold it
+	account.sk_mutex.Lock()
+	if account.token != nil {
+		account.inCS = true
+		account.sk_mutex.Unlock()
+		return
+	}
+	account.rn[account.id]++
+	request := Request{turn: account.rn[account.id], id: account.id}
+	account.sk_mutex.Unlock()
+
+	network := account.network
+	var sentCount int64 = 0
+	for _, qid := range account.quorum {
+		if qid == account.id || network.isDead(qid) {
+			continue
+		}
+		request.seq = account.requestSeq.stamp(qid)
+		network.observe("request", account.id, qid)
+		network.send(Message{Kind: "request", From: account.id, To: qid, Turn: request.turn, Seq: request.seq})
+		sentCount++
+	}
+	atomic.AddInt64(&network.counters.Requests, sentCount)
+
+	token := <-network.registry.route(account.id).skToken
+	account.sk_mutex.Lock()
+	account.token = token
+	account.inCS = true
+	account.sk_mutex.Unlock()
+}
+
+func (account *Account) skRelease() {
+	// record our entry in the token, queue the accounts with an outstanding
+	// request and hand the token to the first of them
+	account.sk_mutex.Lock()
+	account.inCS = false
+	token := account.token
+	token.ln[account.id] = account.rn[account.id]
+	queued := make(map[int]bool)
+	for _, id := range token.queue {
+		queued[id] = true
+	}
+	// start after our own id so every account gets its turn
+	n := len(account.rn)
+	for k := 1; k < n; k++ {
+		id := (account.id + k) % n
+		if !queued[id] && account.rn[id] == token.ln[id]+1 {
+			token.queue = append(token.queue, id)
+		}
+	}
+	// failed accounts never get the token
+	for len(token.queue) > 0 && account.network.isDead(token.queue[0]) {
+		token.queue = token.queue[1:]
+	}
+	if len(token.queue) == 0 {
+		account.sk_mutex.Unlock()
+		return
+	}
+	next := token.queue[0]
+	token.queue = token.queue[1:]
+	account.token = nil
+	account.sk_mutex.Unlock()
+	account.skSend(token, next)
+}
+
+func (account *Account) skReceiveRequest(request Request) {
+	// remember the highest request number of the requester and give it the
+	// token if we hold it without using it
+	account.sk_mutex.Lock()
+	if request.turn > account.rn[request.id] {
+		account.rn[request.id] = request.turn
+	}
+	token := account.token
+	if token == nil || account.inCS || account.rn[request.id] != token.ln[request.id]+1 {
+		account.sk_mutex.Unlock()
+		return
+	}
+	account.token = nil
+	account.sk_mutex.Unlock()
+	account.skSend(token, request.id)
+}
+
+func (account *Account) skSend(token *skToken, to int) {
+	account.slowDown()
+	account.network.observe("token", account.id, to)
+	account.network.send(Message{Kind: "sk-token", From: account.id, To: to, LN: token.ln, Queue: token.queue})
+	atomic.AddInt64(&account.network.counters.TokenPasses, 1)
+}
+
+func (account *Account) skWaiting() int {
+	// the accounts with an outstanding request, as far as we know
+	account.sk_mutex.Lock()
+	defer account.sk_mutex.Unlock()
+	if account.token == nil {
+		return 0
+	}
+	waiting := 0
+	for id, number := range account.rn {
+		if id != account.id && number == account.token.ln[id]+1 {
+			waiting++
+		}
+	}
+	return waiting
+}
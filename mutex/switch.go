@@ -0,0 +1,96 @@
+package mutex
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// SwitchAlgorithm makes the accounts run another algorithm from now on, e.g.
+// to compare two algorithms on the same phase of a workload. The caller must
+// drain the network first: no account may be inside or waiting for the CS
+// while it switches. Every account must run in this process and hybrid mode
+// isn't supported, since the accounts of other processes or sites would keep
+// the previous algorithm.
+func (network *Network) SwitchAlgorithm(algorithm Algorithm) error {
+	switch algorithm {
+	case Original, Optimized, TokenRing, SuzukiKasami:
+	default:
+		return fmt.Errorf("unknown algorithm %q", algorithm)
+	}
+	if err := network.reconfigurable("switch algorithms"); err != nil {
+		return err
+	}
+	previous := network.Algorithm()
+	if previous == algorithm {
+		return nil
+	}
+
+	// the permission-based algorithms start again without any standing
+	// permission; the original and Suzuki-Kasami algorithms ask every account
+	accounts := network.registry.all()
+	quorums := network.quorums
+	if algorithm == Original || algorithm == SuzukiKasami {
+		quorums = FullQuorums(len(accounts))
+	}
+	for _, account := range accounts {
+		account.permit_mutex.Lock()
+		account.outstandingPermit = make(map[int]bool)
+		account.grantedPermit = make(map[int]grant)
+		account.early = make(map[int]Signal)
+		account.single = make(map[int]bool)
+		account.deferred_revokes = account.deferred_revokes[:0]
+		account.prefetched = make(map[int]bool)
+		account.stale = make(map[int]int)
+		account.entered = false
+		account.permit_mutex.Unlock()
+		account.deferred_mutex.Lock()
+		account.deferred_queue = account.deferred_queue[:0]
+		account.deferred_mutex.Unlock()
+		account.requestCS = false
+		account.quorum = quorums[account.id]
+
+		// a Suzuki-Kasami token at rest goes away with its algorithm
+		account.sk_mutex.Lock()
+		account.token = nil
+		account.sk_mutex.Unlock()
+	}
+
+	network.algorithm.Store(algorithm)
+
+	switch algorithm {
+	case TokenRing:
+		// the tokens still passed around under the previous token ring are of
+		// an older epoch
+		atomic.AddInt64(&network.tokenSwitches, 1)
+		epoch := network.tokenGeneration()
+		atomic.StoreInt64(&network.tokenEpoch, epoch)
+		network.startTokenRing(int(epoch))
+	case SuzukiKasami:
+		// every request was served, so the token records each account's own
+		// request number as its last entry and late requests look served
+		first := network.nextAlive(len(accounts) - 1)
+		token := &skToken{ln: make([]int, len(accounts))}
+		for _, account := range accounts {
+			account.sk_mutex.Lock()
+			token.ln[account.id] = account.rn[account.id]
+			account.sk_mutex.Unlock()
+		}
+		account := accounts[first]
+		account.sk_mutex.Lock()
+		account.token = token
+		account.sk_mutex.Unlock()
+	}
+	return nil
+}
+
+func (network *Network) reconfigurable(action string) error {
+	// whether the network can change while it runs: the accounts of other
+	// processes or sites wouldn't see the change
+	if len(network.registry.locals()) != network.Len() {
+		return fmt.Errorf("every account must run in this process to %s", action)
+	}
+	if network.sites > 0 {
+		return fmt.Errorf("hybrid mode can't %s", action)
+	}
+	return nil
+}
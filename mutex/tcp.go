@@ -0,0 +1,209 @@
+package mutex
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// TCPTransport carries the messages of the accounts hosted by this process to
+// the processes hosting the other accounts, as JSON lines over one TCP
+// connection per peer process
+type TCPTransport struct {
+	addresses []string         // address of the process hosting each account
+	mailboxes map[int]*mailbox // accounts hosted by this process
+	listener  net.Listener
+	// how long to keep dialing a peer process that isn't listening yet
+	DialTimeout time.Duration
+
+	order *orderer
+	mutex sync.Mutex
+	peers map[string]*tcpPeer
+
+	output       io.Writer // where messages for accounts not hosted here are reported
+	output_mutex sync.Mutex
+}
+
+type tcpPeer struct {
+	mutex   sync.Mutex
+	conn    net.Conn
+	encoder *json.Encoder
+	reached bool // a peer that went away isn't waited for again
+}
+
+// NewTCPTransport hosts the local accounts, which must share one address of
+// the list, and starts accepting connections from the other processes
+func NewTCPTransport(addresses []string, local []int) (*TCPTransport, error) {
+	if len(local) == 0 {
+		return nil, fmt.Errorf("no local account")
+	}
+	transport := &TCPTransport{
+		addresses:   addresses,
+		mailboxes:   make(map[int]*mailbox),
+		DialTimeout: 10 * time.Second,
+		order:       newOrderer(),
+		peers:       make(map[string]*tcpPeer),
+		output:      os.Stdout,
+	}
+	for _, id := range local {
+		if id < 0 || id >= len(addresses) {
+			return nil, fmt.Errorf("account %d has no address", id)
+		}
+		if addresses[id] != addresses[local[0]] {
+			return nil, fmt.Errorf("local accounts %d and %d have different addresses", local[0], id)
+		}
+		transport.mailboxes[id] = newMailbox(id, transport.order)
+	}
+
+	// accept connections on every interface at the port of our address
+	_, port, err := net.SplitHostPort(addresses[local[0]])
+	if err != nil {
+		return nil, err
+	}
+	transport.listener, err = net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	go transport.accept()
+	return transport, nil
+}
+
+func (transport *TCPTransport) accept() {
+	for {
+		conn, err := transport.listener.Accept()
+		if err != nil {
+			return
+		}
+		go transport.read(conn)
+	}
+}
+
+func (transport *TCPTransport) read(conn net.Conn) {
+	// deliver the messages of a peer process to our accounts
+	defer conn.Close()
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		var message Message
+		if err := decoder.Decode(&message); err != nil {
+			return
+		}
+		box, ok := transport.mailboxes[message.To]
+		if !ok {
+			transport.report("Received a message for account", message.To, "which is not hosted here")
+			continue
+		}
+		box.put(message)
+	}
+}
+
+func (transport *TCPTransport) peer(address string) *tcpPeer {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	peer, ok := transport.peers[address]
+	if !ok {
+		peer = &tcpPeer{}
+		transport.peers[address] = peer
+	}
+	return peer
+}
+
+// SetOutput sets where the transport reports the messages it can't deliver
+// (os.Stdout by default)
+func (transport *TCPTransport) SetOutput(output io.Writer) {
+	transport.output_mutex.Lock()
+	defer transport.output_mutex.Unlock()
+	transport.output = output
+}
+
+func (transport *TCPTransport) report(args ...any) {
+	transport.output_mutex.Lock()
+	output := transport.output
+	transport.output_mutex.Unlock()
+	fmt.Fprintln(output, args...)
+}
+
+// SetOrdering changes the delivery order to the local accounts (FIFO by
+// default), drawing the unordered deliveries from the seed; every process of
+// the run must use the same ordering, set before any message is sent
+func (transport *TCPTransport) SetOrdering(ordering Ordering, seed int64) {
+	transport.order.set(ordering, seed)
+}
+
+func (transport *TCPTransport) Send(message Message) error {
+	if box, ok := transport.mailboxes[message.To]; ok {
+		transport.order.stamp(&message)
+		box.put(message)
+		return nil
+	}
+	if message.To < 0 || message.To >= len(transport.addresses) {
+		return fmt.Errorf("no account %d", message.To)
+	}
+	transport.order.stamp(&message)
+
+	address := transport.addresses[message.To]
+	peer := transport.peer(address)
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+
+	// a broken connection is dialed again once
+	for attempt := 0; attempt < 2; attempt++ {
+		if peer.conn == nil {
+			conn, err := transport.dial(address, peer.reached)
+			if err != nil {
+				return err
+			}
+			peer.conn = conn
+			peer.reached = true
+			peer.encoder = json.NewEncoder(conn)
+		}
+		err := peer.encoder.Encode(message)
+		if err == nil {
+			return nil
+		}
+		peer.conn.Close()
+		peer.conn = nil
+	}
+	return fmt.Errorf("sending to %s failed", address)
+}
+
+func (transport *TCPTransport) dial(address string, once bool) (net.Conn, error) {
+	// the peer process may not be listening yet
+	deadline := time.Now().Add(transport.DialTimeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil || once || time.Now().After(deadline) {
+			return conn, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (transport *TCPTransport) reserve(fanIn []int) {
+	reserveMailboxes(transport.mailboxes, fanIn)
+}
+
+func (transport *TCPTransport) Receive(id int) <-chan Message {
+	return transport.mailboxes[id].out
+}
+
+func (transport *TCPTransport) Close() error {
+	err := transport.listener.Close()
+	transport.mutex.Lock()
+	for _, peer := range transport.peers {
+		peer.mutex.Lock()
+		if peer.conn != nil {
+			peer.conn.Close()
+		}
+		peer.mutex.Unlock()
+	}
+	transport.mutex.Unlock()
+	for _, box := range transport.mailboxes {
+		box.close()
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package mutex
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenRingVisitsAccountsInOrder(t *testing.T) {
+	// accounts 3, 2 and 1 ask for the CS while account 0 holds the token:
+	// they enter in ring order, and once nobody needs the CS the token goes
+	// on around the ring, its hops counted as idle
+	network := NewNetwork(TokenRing, FullQuorums(4))
+	network.Start()
+	defer network.Stop()
+
+	network.Account(0).Enter()
+	var order []int
+	var order_mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, id := range []int{3, 2, 1} {
+		wg.Add(1)
+		go func(account *Account) {
+			defer wg.Done()
+			account.Enter()
+			order_mutex.Lock()
+			order = append(order, account.ID())
+			order_mutex.Unlock()
+			account.Exit()
+		}(network.Account(id))
+	}
+	for _, id := range []int{3, 2, 1} {
+		for atomic.LoadInt32(&network.Account(id).wantsToken) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	network.Account(0).Exit()
+	wg.Wait()
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Fatalf("entry order %v, expected [1 2 3]", order)
+	}
+
+	counters := network.Counters()
+	time.Sleep(10 * network.TokenHop)
+	later := network.Counters()
+	idle := later.IdleTokenPasses - counters.IdleTokenPasses
+	if idle == 0 {
+		t.Fatal("the token stopped circulating")
+	}
+	if later.TokenPasses-counters.TokenPasses < idle {
+		t.Fatal("more idle passes than passes")
+	}
+	if later.Requests != 0 || later.Approvals != 0 {
+		t.Fatalf("%d requests and %d approvals in a token ring", later.Requests, later.Approvals)
+	}
+}
+
+func TestTokenRingExclusion(t *testing.T) {
+	// the account holding the token keeps it until it leaves the CS
+	network := NewNetwork(TokenRing, FullQuorums(3))
+	network.TokenHop = 0
+	network.Start()
+	defer network.Stop()
+
+	network.Account(1).Enter()
+	entered := make(chan struct{})
+	go func() {
+		network.Account(2).Enter()
+		close(entered)
+	}()
+	select {
+	case <-entered:
+		t.Fatal("account 2 entered the CS while account 1 was inside")
+	case <-time.After(100 * time.Millisecond):
+	}
+	network.Account(1).Exit()
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("account 2 didn't enter the CS after account 1 left it")
+	}
+	network.Account(2).Exit()
+}
+
+func TestSuzukiKasamiMessages(t *testing.T) {
+	// an entry costs n-1 requests and the token, or nothing when the account
+	// holds the token already
+	network := NewNetwork(SuzukiKasami, FullQuorums(5))
+	network.Start()
+	defer network.Stop()
+
+	for _, test := range []struct {
+		account  int
+		requests int64
+		passes   int64
+	}{
+		{0, 0, 0}, // account 0 starts with the token
+		{3, 4, 1},
+		{3, 0, 0},
+		{1, 4, 1},
+	} {
+		before := network.Counters()
+		network.Account(test.account).Enter()
+		network.Account(test.account).Exit()
+		after := network.Counters()
+		if requests, passes := after.Requests-before.Requests, after.TokenPasses-before.TokenPasses; requests != test.requests || passes != test.passes {
+			t.Fatalf("entry of account %d: %d requests and %d token passes, expected %d and %d", test.account, requests, passes, test.requests, test.passes)
+		}
+	}
+}
+
+func TestSuzukiKasamiExclusion(t *testing.T) {
+	// the holder inside the CS hands the token to the waiting requesters only
+	// when it leaves, one at a time
+	network := NewNetwork(SuzukiKasami, FullQuorums(4))
+	network.Start()
+	defer network.Stop()
+
+	network.Account(2).Enter()
+	entered := make(chan int, 2)
+	for _, id := range []int{1, 3} {
+		go func(account *Account) {
+			account.Enter()
+			entered <- account.ID()
+			time.Sleep(50 * time.Millisecond)
+			entered <- -1
+			account.Exit()
+		}(network.Account(id))
+	}
+	select {
+	case id := <-entered:
+		t.Fatalf("account %d entered the CS while account 2 was inside", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+	network.Account(2).Exit()
+	for i := 0; i < 2; i++ {
+		select {
+		case id := <-entered:
+			if id < 0 {
+				t.Fatal("an account left the CS it didn't enter")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the waiting accounts didn't enter the CS")
+		}
+		// the other account stays out until this one leaves
+		if id := <-entered; id != -1 {
+			t.Fatalf("account %d entered the CS while another account was inside", id)
+		}
+	}
+}
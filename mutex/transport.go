@@ -0,0 +1,227 @@
+package mutex
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Message is the wire form of everything accounts send each other
+type Message struct {
+	Kind  string `json:"kind"` // request, approve, revoke, yield, ack, token, sk-token, heartbeat, marker, snapshot-state or data
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Turn  int    `json:"turn,omitempty"`
+	Seq   int    `json:"seq,omitempty"`
+	LN    []int  `json:"ln,omitempty"`    // sk-token only
+	Queue []int  `json:"queue,omitempty"` // sk-token only
+	Data  []byte `json:"data,omitempty"`  // data only: application payload
+	Clock int    `json:"clock,omitempty"` // Lamport clock of the sender
+	// request only, in resource mode: the accounts the CS is requested for
+	Resources []int `json:"resources,omitempty"`
+	// approve only: the permission is given back when the requester releases
+	// the CS instead of standing
+	Once bool `json:"once,omitempty"`
+	// request only, with aging: the requester waited longer than
+	// Network.Aging, and a boost only upgrades its pending request
+	Aged  bool `json:"aged,omitempty"`
+	Boost bool `json:"boost,omitempty"`
+	// request and revoke only: the request is for background work and goes
+	// after the others
+	Background bool `json:"background,omitempty"`
+	// revoke and yield only: the approval claimed or given back, by its
+	// sequence number; a revocation also carries the request waiting for the
+	// permission, its turn, aged and background flags in Turn, Aged and
+	// Background
+	Grant     int `json:"grant,omitempty"`
+	Requester int `json:"requester,omitempty"`
+	// ack only: the kind of the message acknowledged, by its sequence number
+	// in Seq
+	Acks string `json:"acks,omitempty"`
+	// causal ordering only: how many messages the sender knew were sent from
+	// each account to each other, as from, to and count
+	Sent [][3]int `json:"sent,omitempty"`
+}
+
+// Transport carries the messages between accounts, which may live in other
+// processes. Send must not block on the receiver: the protocol relies on an
+// account being able to answer while its own messages are still in flight.
+// Over bounded channels two accounts approving each other at once would each
+// block handing its approval to the other, whose goroutine is blocked the same
+// way, so the transports here queue the messages in unbounded mailboxes.
+type Transport interface {
+	Send(message Message) error
+	// Receive returns the messages addressed to an account of this process
+	Receive(id int) <-chan Message
+	Close() error
+}
+
+// mailbox is an unbounded queue of the messages addressed to one account,
+// handed to the account in the order of the transport
+type mailbox struct {
+	id     int
+	order  *orderer
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	queue  []Message
+	closed bool
+	out    chan Message
+	done   chan struct{}
+}
+
+// FanIn returns how many protocol messages can be in flight to each account
+// at once under the quorums: a request and a revocation or boost from every
+// account asking it, an approval from each member of its own quorum, and the
+// token. The mailboxes are sized to it up front so they don't grow under load.
+// That is only an allocation: a mailbox takes any number of messages, which
+// is what keeps Send from waiting on the receiver (see Transport).
+func FanIn(quorums [][]int) []int {
+	fanIn := make([]int, len(quorums))
+	for i, members := range quorums {
+		for _, member := range members {
+			if member == i || member < 0 || member >= len(quorums) {
+				continue
+			}
+			fanIn[member] += 2
+			fanIn[i]++
+		}
+	}
+	for i := range fanIn {
+		fanIn[i]++
+	}
+	return fanIn
+}
+
+func newMailbox(id int, order *orderer) *mailbox {
+	box := &mailbox{id: id, order: order, out: make(chan Message), done: make(chan struct{})}
+	box.cond = sync.NewCond(&box.mutex)
+	go box.pump()
+	return box
+}
+
+func (box *mailbox) put(message Message) {
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+	if box.closed {
+		return
+	}
+	box.queue = append(box.queue, message)
+	box.cond.Signal()
+}
+
+func (box *mailbox) reserve(capacity int) {
+	// room for the messages expected at once, kept as the queue drains
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+	if cap(box.queue) < capacity {
+		box.queue = append(make([]Message, 0, capacity), box.queue...)
+	}
+}
+
+func reserveMailboxes(mailboxes map[int]*mailbox, fanIn []int) {
+	for id, box := range mailboxes {
+		if id < len(fanIn) {
+			box.reserve(fanIn[id])
+		}
+	}
+}
+
+func (box *mailbox) pump() {
+	// hand the queued messages to the receiver in order; a message held back
+	// by the ordering waits for the next one to arrive
+	defer close(box.out)
+	for {
+		box.mutex.Lock()
+		index := -1
+		for !box.closed {
+			if index = box.order.next(box.id, box.queue); index >= 0 {
+				break
+			}
+			box.cond.Wait()
+		}
+		if box.closed {
+			box.mutex.Unlock()
+			return
+		}
+		message := box.queue[index]
+		box.queue = append(box.queue[:index], box.queue[index+1:]...)
+		box.mutex.Unlock()
+		select {
+		case box.out <- message:
+		case <-box.done:
+			return
+		}
+	}
+}
+
+func (box *mailbox) close() {
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+	if box.closed {
+		return
+	}
+	box.closed = true
+	close(box.done)
+	box.cond.Signal()
+}
+
+// ChannelTransport delivers the messages between accounts of the same process
+type ChannelTransport struct {
+	mutex     sync.RWMutex // accounts may join while messages are sent
+	mailboxes map[int]*mailbox
+	order     *orderer
+}
+
+func NewChannelTransport(n_accounts int) *ChannelTransport {
+	transport := &ChannelTransport{mailboxes: make(map[int]*mailbox), order: newOrderer()}
+	for i := 0; i < n_accounts; i++ {
+		transport.mailboxes[i] = newMailbox(i, transport.order)
+	}
+	return transport
+}
+
+// SetOrdering changes the delivery order of the transport (FIFO by default),
+// drawing the unordered deliveries from the seed; it must be called before
+// any message is sent
+func (transport *ChannelTransport) SetOrdering(ordering Ordering, seed int64) {
+	transport.order.set(ordering, seed)
+}
+
+func (transport *ChannelTransport) reserve(fanIn []int) {
+	transport.mutex.RLock()
+	defer transport.mutex.RUnlock()
+	reserveMailboxes(transport.mailboxes, fanIn)
+}
+
+func (transport *ChannelTransport) Send(message Message) error {
+	transport.mutex.RLock()
+	box, ok := transport.mailboxes[message.To]
+	transport.mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("no account %d", message.To)
+	}
+	transport.order.stamp(&message)
+	box.put(message)
+	return nil
+}
+
+func (transport *ChannelTransport) Receive(id int) <-chan Message {
+	transport.mutex.RLock()
+	defer transport.mutex.RUnlock()
+	return transport.mailboxes[id].out
+}
+
+func (transport *ChannelTransport) add(id int) {
+	// a mailbox for an account joining the network
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	transport.mailboxes[id] = newMailbox(id, transport.order)
+}
+
+func (transport *ChannelTransport) Close() error {
+	transport.mutex.RLock()
+	defer transport.mutex.RUnlock()
+	for _, box := range transport.mailboxes {
+		box.close()
+	}
+	return nil
+}
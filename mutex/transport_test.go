@@ -0,0 +1,66 @@
+package mutex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendDoesntWaitForTheReceiver(t *testing.T) {
+	// the goroutine of account 0 is busy (here it never reads) while account
+	// 1 sends it more approvals than its mailbox was sized for: Send must
+	// still return, or account 1 couldn't take the messages sent to it either
+	transport := NewChannelTransport(2)
+	defer transport.Close()
+	fanIn := FanIn(FullQuorums(2))
+	transport.reserve(fanIn)
+
+	sent := make(chan struct{})
+	go func() {
+		for seq := 0; seq < 100*fanIn[0]; seq++ {
+			transport.Send(Message{Kind: "approve", From: 1, To: 0, Seq: seq})
+		}
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send blocked on an account that doesn't read its messages")
+	}
+	for seq := 0; seq < 100*fanIn[0]; seq++ {
+		if message := <-transport.Receive(0); message.Seq != seq {
+			t.Fatalf("received approval %d, expected %d", message.Seq, seq)
+		}
+	}
+}
+
+func TestAccountsApprovingEachOtherDontDeadlock(t *testing.T) {
+	// two accounts ask each other for the CS at the same moment, over and
+	// over, so each sends its approval while the other sends its own; with
+	// a channel per account each would block handing it over
+	for _, algorithm := range []Algorithm{Original, Optimized} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			network := NewNetwork(algorithm, FullQuorums(2))
+			network.Start()
+			defer network.Stop()
+
+			done := make(chan struct{}, 2)
+			for id := 0; id < 2; id++ {
+				go func(account *Account) {
+					for i := 0; i < 1000; i++ {
+						account.Enter()
+						account.Exit()
+					}
+					done <- struct{}{}
+				}(network.Account(id))
+			}
+			expired := time.After(30 * time.Second)
+			for finished := 0; finished < 2; finished++ {
+				select {
+				case <-done:
+				case <-expired:
+					t.Fatal("the accounts deadlocked approving each other")
+				}
+			}
+		})
+	}
+}
@@ -24,12 +24,12 @@ function Run-Test {
     
     # Run original algorithm
     Write-Host "  Running original algorithm..."
-    go run main_og.go $testPath "original"
+    go run ./cmd/banksim $testPath "original"
     Move-Item -Path "metrics_original.json" -Destination $resultPath -Force
     
     # Run optimized algorithm
     Write-Host "  Running optimized algorithm..."
-    go run main_updated.go $testPath "optimized"
+    go run ./cmd/banksim $testPath "optimized"
     Move-Item -Path "metrics_optimized.json" -Destination $resultPath -Force
     
     # Generate visualizations
@@ -19,12 +19,12 @@ run_test() {
     
     # Run original algorithm
     echo "  Running original algorithm..."
-    go run main.go "$test_path" "original"
+    go run ./cmd/banksim "$test_path" "original"
     mv metrics_original.json "$result_path/"
     
     # Run optimized algorithm
     echo "  Running optimized algorithm..."
-    go run main3.go "$test_path" "optimized"
+    go run ./cmd/banksim "$test_path" "optimized"
     mv metrics_optimized.json "$result_path/"
     
     # Generate visualizations
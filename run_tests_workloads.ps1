@@ -3,7 +3,7 @@ $TEST_DIR = "tests"
 # Directory for results (using the workload specific name)
 $RESULTS_DIR = "results_workload"
 # Name of the optimized algorithm's main file
-$OPTIMIZED_MAIN = "main_updated.go"
+$OPTIMIZED_MAIN = "./cmd/banksim"
 # Name of the metrics file generated by the optimized algorithm
 $OPTIMIZED_METRICS_FILE = "metrics_optimized.json"
 # Name of the visualization script (using the workload specific name)